@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A crossManualRef is a :ref: or :doc: role in one manual referring to a page of another.
+type crossManualRef struct {
+	roleUse
+	// The manual the role is in, and the manual it refers to.
+	from, to string
+	// The file the role refers to.
+	target string
+	broken bool
+}
+
+// crossManualRefs returns the references in idx which cross manual boundaries, sorted by the manuals
+// they cross between, then by where they are.
+func crossManualRefs(idx *index) []crossManualRef {
+	defined := make(map[string]string)
+	for _, l := range idx.labels {
+		name := strings.ToLower(l.name)
+		if _, ok := defined[name]; !ok {
+			defined[name] = l.source
+		}
+	}
+
+	var refs []crossManualRef
+	for _, u := range idx.roles {
+		r := crossManualRef{roleUse: u, from: manual(u.source, idx.root)}
+		switch u.name {
+		case "ref":
+			source, ok := defined[strings.ToLower(u.target())]
+			if !ok {
+				// Undefined labels are reported by checkRefLabels, and there's no telling which manual they were meant for.
+				continue
+			}
+			r.target = source
+		case "doc":
+			r.target = docPath(u.source, u.target(), idx.root)
+			r.broken = !idx.exists(r.target)
+		default:
+			continue
+		}
+		r.to = manual(r.target, idx.root)
+		if r.from != "" && r.to != "" && r.from != r.to {
+			refs = append(refs, r)
+		}
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		a, b := refs[i], refs[j]
+		if a.from != b.from {
+			return a.from < b.from
+		}
+		if a.to != b.to {
+			return a.to < b.to
+		}
+		if a.source != b.source {
+			return a.source < b.source
+		}
+		return a.line < b.line
+	})
+	return refs
+}
+
+// checkCrossManual ensures no manual has more references into another manual than the max-cross-manual
+// flag allows, reporting each reference over the limit.
+func checkCrossManual(idx *index, diags chan<- diagnostic) {
+	if *maxCrossManualFlag <= 0 {
+		return
+	}
+	counts := make(map[[2]string]int)
+	for _, r := range crossManualRefs(idx) {
+		pair := [2]string{r.from, r.to}
+		counts[pair]++
+		if counts[pair] > *maxCrossManualFlag {
+			diags <- diagnostic{Path: r.source, Line: r.line, Column: r.column, Rule: ruleCrossManual,
+				Message: fmt.Sprintf("Reference from %v into %v is over the %v references allowed between manuals.",
+					r.from, r.to, *maxCrossManualFlag)}
+		}
+	}
+}
+
+// writeCrossManualReport writes the references which cross manual boundaries to w, grouped by the manuals
+// they cross between.
+func writeCrossManualReport(w io.Writer, refs []crossManualRef, root string) error {
+	if len(refs) == 0 {
+		_, err := fmt.Fprintln(w, "No references cross manual boundaries.")
+		return err
+	}
+	for i, r := range refs {
+		if i == 0 || r.from != refs[i-1].from || r.to != refs[i-1].to {
+			count := 0
+			for _, o := range refs[i:] {
+				if o.from == r.from && o.to == r.to {
+					count++
+				}
+			}
+			if i > 0 {
+				if _, err := fmt.Fprintln(w); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "%v -> %v (%v)\n", r.from, r.to, count); err != nil {
+				return err
+			}
+		}
+		broken := ""
+		if r.broken {
+			broken = " (broken)"
+		}
+		if _, err := fmt.Fprintf(w, "  %v:%v: :%v:`%v` -> %v%v\n", reportPath(r.source, root), r.line, r.name, r.text,
+			reportPath(r.target, root), broken); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveCrossManualReport writes the cross-manual report of idx to the file at path.
+func saveCrossManualReport(path string, idx *index) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeCrossManualReport(f, crossManualRefs(idx), idx.root); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// crossManualIndex is a repository whose user manual refers to its admin manual.
+func crossManualIndex() *index {
+	return &index{
+		root: "/a",
+		files: []string{
+			"/a/user-manual/transfer/transfer.rst",
+			"/a/admin-manual/install/install.rst",
+		},
+		labels: []labelDef{
+			{name: "transfer", source: "/a/user-manual/transfer/transfer.rst", line: 1},
+			{name: "install", source: "/a/admin-manual/install/install.rst", line: 1},
+		},
+		roles: []roleUse{
+			{role: role{name: "ref", text: "Installing <install>", column: 5}, source: "/a/user-manual/transfer/transfer.rst", line: 9},
+			{role: role{name: "ref", text: "transfer", column: 5}, source: "/a/user-manual/transfer/transfer.rst", line: 4},
+			{role: role{name: "doc", text: "/admin-manual/upgrade/upgrade", column: 1}, source: "/a/user-manual/transfer/transfer.rst", line: 12},
+			{role: role{name: "ref", text: "missing", column: 1}, source: "/a/user-manual/transfer/transfer.rst", line: 14},
+			{role: role{name: "ref", text: "Transfers <transfer>", column: 1}, source: "/a/admin-manual/install/install.rst", line: 3},
+		},
+	}
+}
+
+func TestCrossManualRefs(t *testing.T) {
+
+	refs := crossManualRefs(crossManualIndex())
+	if len(refs) != 3 {
+		t.Fatalf("crossManualRefs -> %v, expected 3 references", refs)
+	}
+	if refs[0].from != "admin-manual" || refs[1].line != 9 || refs[2].line != 12 || !refs[2].broken {
+		t.Errorf("crossManualRefs -> %v, expected the admin manual's reference, then the user manual's", refs)
+	}
+
+	var b bytes.Buffer
+	if err := writeCrossManualReport(&b, refs, "/a"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "admin-manual -> user-manual (1)\n" +
+		"  admin-manual/install/install.rst:3: :ref:`Transfers <transfer>` -> user-manual/transfer/transfer.rst\n" +
+		"\n" +
+		"user-manual -> admin-manual (2)\n" +
+		"  user-manual/transfer/transfer.rst:9: :ref:`Installing <install>` -> admin-manual/install/install.rst\n" +
+		"  user-manual/transfer/transfer.rst:12: :doc:`/admin-manual/upgrade/upgrade` -> admin-manual/upgrade/upgrade.rst (broken)\n"
+	if b.String() != expected {
+		t.Errorf("writeCrossManualReport wrote:\n%v\nexpected:\n%v", b.String(), expected)
+	}
+
+}
+
+func TestCheckCrossManual(t *testing.T) {
+
+	defer func(max int) { *maxCrossManualFlag = max }(*maxCrossManualFlag)
+
+	*maxCrossManualFlag = 0
+	if found := runCrossCheck(checkCrossManual, crossManualIndex()); len(found) != 0 {
+		t.Errorf("checkCrossManual found %v without a limit, expected no problems", found)
+	}
+
+	*maxCrossManualFlag = 1
+	found := runCrossCheck(checkCrossManual, crossManualIndex())
+	if len(found) != 1 || found[0].Line != 12 {
+		t.Errorf("checkCrossManual found %v, expected the second reference into the admin manual", found)
+	}
+
+}
@@ -0,0 +1,1738 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// repeatedHyphens matches the runs of hyphens left by empty parts of an anchor convention.
+var repeatedHyphens = regexp.MustCompile(`-{2,}`)
+
+// conventionalAnchor makes the anchor the page at path should have, following convention.
+// In the convention, <manual> is replaced with the name of the manual without any "-manual" suffix,
+// <chapter> with the name of the chapter directory, and <page> with the name of the file.
+func conventionalAnchor(path, root, convention string) string {
+	rel := relParts(path, root)
+	page := strings.TrimSuffix(rel[len(rel)-1], filepath.Ext(path))
+	manualName, chapter := "", ""
+	if len(rel) > 1 {
+		manualName = strings.TrimSuffix(rel[0], "-manual")
+	}
+	if len(rel) > 2 {
+		chapter = rel[len(rel)-2]
+	}
+	anchor := strings.NewReplacer("<manual>", manualName, "<chapter>", chapter, "<page>", page).Replace(convention)
+	anchor = repeatedHyphens.ReplaceAllString(anchor, "-")
+	return strings.ToLower(strings.Trim(anchor, "-"))
+}
+
+// checkAnchorConvention ensures the anchor at the top of each page follows the anchor convention,
+// so the label namespace stays predictable. Pages in the root of the repository are exempt.
+func checkAnchorConvention(path string, lines <-chan line, diags chan<- diagnostic) {
+	first, ok := <-lines
+	for range lines {
+	}
+	if !ok || *anchorConventionFlag == "" || manual(path, repo.root) == "" {
+		return
+	}
+	name, isLabel := label(first.text)
+	if !isLabel {
+		return
+	}
+	expected := conventionalAnchor(path, repo.root, *anchorConventionFlag)
+	if name != expected {
+		diags <- diagnostic{Line: first.num, Column: 1, Rule: ruleAnchorConvention,
+			Message: fmt.Sprintf("Anchor %q doesn't follow the naming convention, expected %q.", name, expected)}
+	}
+}
+
+// fixAnchorNames renames the anchors at the top of pages which don't follow the anchor convention,
+// and rewrites the :ref: roles referring to them, so no reference is broken. Anchors defined more than once,
+// or whose conventional name is already taken, are left for the duplicate label rule to report.
+func fixAnchorNames(idx *index) (func(path string, lines []line) ([]line, []fix), []string) {
+	if *anchorConventionFlag == "" {
+		return nil, nil
+	}
+	labels := append([]labelDef(nil), idx.labels...)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].source < labels[j].source })
+	defined := make(map[string]int)
+	for _, l := range labels {
+		defined[strings.ToLower(l.name)]++
+	}
+
+	// The new names of the anchors renamed, by their old name in lowercase, and the anchor renamed in each page.
+	renames := make(map[string]string)
+	pages := make(map[string]string)
+	for _, l := range labels {
+		if l.line != 1 || manual(l.source, idx.root) == "" {
+			continue
+		}
+		expected := conventionalAnchor(l.source, idx.root, *anchorConventionFlag)
+		if l.name == expected || defined[strings.ToLower(l.name)] > 1 || defined[expected] > 0 {
+			continue
+		}
+		defined[expected]++
+		renames[strings.ToLower(l.name)] = expected
+		pages[l.source] = l.name
+	}
+
+	changed := make(map[string]bool)
+	for path := range pages {
+		changed[path] = true
+	}
+	for _, u := range idx.roles {
+		if _, ok := renames[strings.ToLower(u.target())]; ok && u.name == "ref" {
+			changed[u.source] = true
+		}
+	}
+	var paths []string
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return func(path string, lines []line) ([]line, []fix) {
+		var r directiveReader
+		var fixes []fix
+		for i, l := range lines {
+			r.next(l)
+			if old, ok := pages[path]; ok && l.num == 1 {
+				if name, isAnchor := pageAnchor(l.text); isAnchor && name == old {
+					lines[i].text = strings.Replace(l.text, "_"+old+":", "_"+renames[strings.ToLower(old)]+":", 1)
+					fixes = append(fixes, fix{line: l.num, column: 1,
+						message: fmt.Sprintf("Renamed anchor %q to %q, following the naming convention.", old, renames[strings.ToLower(old)])})
+				}
+			}
+			if r.inBody(l, literalDirectives...) {
+				continue
+			}
+			text, retargeted := retargetRefs(lines[i].text, renames)
+			if len(retargeted) > 0 {
+				lines[i].text = text
+				for _, old := range retargeted {
+					fixes = append(fixes, fix{line: l.num,
+						message: fmt.Sprintf("Changed :ref: to %q to refer to its new name %q.", old, renames[strings.ToLower(old)])})
+				}
+			}
+		}
+		return lines, fixes
+	}, paths
+}
+
+// retargetRefs changes the targets of the :ref: roles in text which are renamed, given the new names by their
+// old ones in lowercase, returning the changed text and the targets changed.
+func retargetRefs(text string, renames map[string]string) (string, []string) {
+	var retargeted []string
+	matches := rolePattern.FindAllStringSubmatchIndex(text, -1)
+	// The roles are changed from the last, so the positions of the others stay the same.
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		if text[m[2]:m[3]] != "ref" {
+			continue
+		}
+		start, end := m[4], m[5]
+		if t := explicitTargetPattern.FindStringSubmatchIndex(text[start:end]); t != nil {
+			start, end = start+t[4], start+t[5]
+		}
+		old := strings.TrimSpace(text[start:end])
+		name, ok := renames[strings.ToLower(old)]
+		if !ok {
+			continue
+		}
+		text = text[:start] + name + text[end:]
+		retargeted = append([]string{old}, retargeted...)
+	}
+	return text, retargeted
+}
+
+// backToTopPattern matches a 'Back to the top' link.
+var backToTopPattern = regexp.MustCompile("^:ref:`Back to the top <[^>]+>`$")
+
+// checkPlaceholder ensures pages have some content, rather than being empty,
+// or only having an anchor, a title and a 'Back to the top' link, which are usually stubs.
+func checkPlaceholder(path string, lines <-chan line, diags chan<- diagnostic) {
+	var hr headingReader
+	// The lines which could be content, until they're found to be part of a heading.
+	content := make(map[int]bool)
+	nonBlank := false
+	for l := range lines {
+		text := strings.TrimSpace(l.text)
+		if text == "" {
+			continue
+		}
+		nonBlank = true
+		if h := hr.next(l); h != nil {
+			delete(content, h.line)
+			delete(content, h.line-1)
+			continue
+		}
+		if _, isLabel := label(text); isLabel || backToTopPattern.MatchString(text) {
+			continue
+		}
+		content[l.num] = true
+	}
+	if !nonBlank {
+		diags <- diagnostic{Line: 1, Column: 1, Rule: rulePlaceholder, Message: "Page is empty."}
+	} else if len(content) == 0 {
+		diags <- diagnostic{Line: 1, Column: 1, Rule: rulePlaceholder, Message: "Page has no content besides its anchor and title."}
+	}
+}
+
+// checkHeadingUnderlines ensures the underline and any overline of each section title
+// are at least as long as the title, and that overlines match their underlines.
+func checkHeadingUnderlines(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	var hr headingReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		h := hr.next(l)
+		if h == nil {
+			continue
+		}
+		width := utf8.RuneCountInString(h.title)
+		if len(h.underline) < width {
+			diags <- diagnostic{Line: h.line + 1, Column: 1, Rule: ruleHeadingUnderline,
+				Message: fmt.Sprintf("Underline of %q is %v characters, shorter than the title's %v.", h.title, len(h.underline), width)}
+		}
+		if h.overline == "" {
+			continue
+		}
+		if len(h.overline) < width {
+			diags <- diagnostic{Line: h.line - 1, Column: 1, Rule: ruleHeadingUnderline,
+				Message: fmt.Sprintf("Overline of %q is %v characters, shorter than the title's %v.", h.title, len(h.overline), width)}
+		} else if h.overline != h.underline {
+			diags <- diagnostic{Line: h.line - 1, Column: 1, Rule: ruleHeadingUnderline,
+				Message: fmt.Sprintf("Overline of %q doesn't match its underline.", h.title)}
+		}
+	}
+}
+
+// fixHeadingUnderlines makes the underline and any overline of each section title exactly as long
+// as the title, keeping their adornment character. Titles with an overline can be indented,
+// and their adornment then covers the indentation too.
+func fixHeadingUnderlines(path string, lines []line) ([]line, []fix) {
+	var r directiveReader
+	var hr headingReader
+	var fixes []fix
+	for _, l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		h := hr.next(l)
+		if h == nil {
+			continue
+		}
+		title := lines[h.line-1].text
+		if h.overline == "" {
+			title = strings.TrimSpace(title)
+		}
+		adornment := strings.Repeat(string(h.char), utf8.RuneCountInString(strings.TrimRight(title, " \t")))
+		if lines[h.line].text != adornment {
+			lines[h.line].text = adornment
+			fixes = append(fixes, fix{line: h.line + 1, message: fmt.Sprintf("Made the underline of %q as long as the title.", h.title)})
+		}
+		if h.overline != "" && lines[h.line-2].text != adornment {
+			lines[h.line-2].text = adornment
+			fixes = append(fixes, fix{line: h.line - 1, message: fmt.Sprintf("Made the overline of %q as long as the title.", h.title)})
+		}
+	}
+	return lines, fixes
+}
+
+// style describes the adornment of a heading, such as "=" with an overline or "-" without.
+func (h *heading) style() string {
+	if h.overline != "" {
+		return fmt.Sprintf("%c with overline", h.char)
+	}
+	return fmt.Sprintf("%c", h.char)
+}
+
+// checkHeadingHierarchy ensures section levels aren't skipped. As in docutils, each heading style
+// is given the next level the first time it's used, so a style first used below its level,
+// or a style coming more than one level below the current section, scrambles the structure.
+func checkHeadingHierarchy(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	var hr headingReader
+	var styles []string
+	current := 0
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		h := hr.next(l)
+		if h == nil {
+			continue
+		}
+		level := 0
+		for i, s := range styles {
+			if s == h.style() {
+				level = i + 1
+			}
+		}
+		if level == 0 {
+			styles = append(styles, h.style())
+			level = len(styles)
+		}
+		if level > current+1 {
+			diags <- diagnostic{Line: h.line, Column: 1, Rule: ruleHeadingHierarchy,
+				Message: fmt.Sprintf("Heading %q (%v) is level %v, skipping from level %v.", h.title, h.style(), level, current)}
+		}
+		current = level
+	}
+}
+
+// adornmentStyle returns the heading style written as in the adornments flag, where an adornment
+// written twice has an overline.
+func adornmentStyle(adornment string) string {
+	if len(adornment) == 2 && adornment[0] == adornment[1] {
+		return fmt.Sprintf("%c with overline", adornment[0])
+	}
+	return adornment
+}
+
+// checkAdornments ensures headings use the adornment given with the adornments flag for their level,
+// with levels given to styles in the order they're first used, as in docutils.
+func checkAdornments(path string, lines <-chan line, diags chan<- diagnostic) {
+	var policy []string
+	for _, a := range splitList(*adornmentsFlag) {
+		policy = append(policy, adornmentStyle(a))
+	}
+	var r directiveReader
+	var hr headingReader
+	var styles []string
+	for l := range lines {
+		r.next(l)
+		if len(policy) == 0 || r.inBody(l, literalDirectives...) {
+			continue
+		}
+		h := hr.next(l)
+		if h == nil {
+			continue
+		}
+		level := 0
+		for i, s := range styles {
+			if s == h.style() {
+				level = i + 1
+			}
+		}
+		if level == 0 {
+			styles = append(styles, h.style())
+			level = len(styles)
+		}
+		switch {
+		case level > len(policy):
+			diags <- diagnostic{Line: h.line, Column: 1, Rule: ruleAdornment,
+				Message: fmt.Sprintf("Heading %q is level %v, but only %v levels of headings are allowed.", h.title, level, len(policy))}
+		case h.style() != policy[level-1]:
+			diags <- diagnostic{Line: h.line, Column: 1, Rule: ruleAdornment,
+				Message: fmt.Sprintf("Heading %q is adorned with %v, but level %v headings use %v.", h.title, h.style(), level, policy[level-1])}
+		}
+	}
+}
+
+// trimTrailingWhitespace removes the spaces and tabs text ends in, except the one following a backslash,
+// which escapes it, and the one after the "|" of an empty line in a line block, which are intentional.
+func trimTrailingWhitespace(text string) string {
+	trimmed := strings.TrimRight(text, " \t")
+	if len(trimmed) == len(text) {
+		return text
+	}
+	escapes := len(trimmed) - len(strings.TrimRight(trimmed, "\\"))
+	if escapes%2 == 1 || strings.TrimSpace(trimmed) == "|" {
+		return text[:len(trimmed)+1]
+	}
+	return trimmed
+}
+
+// checkTrailingWhitespace ensures no lines end in spaces or tabs, other than intentional ones.
+func checkTrailingWhitespace(path string, lines <-chan line, diags chan<- diagnostic) {
+	for l := range lines {
+		trimmed := trimTrailingWhitespace(l.text)
+		if len(trimmed) != len(l.text) {
+			diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(trimmed) + 1, Rule: ruleTrailingWhitespace,
+				Message: "Line has trailing whitespace."}
+		}
+	}
+}
+
+// fixTrailingWhitespace removes the spaces and tabs lines end in, other than intentional ones.
+func fixTrailingWhitespace(path string, lines []line) ([]line, []fix) {
+	var fixes []fix
+	for i, l := range lines {
+		if trimmed := trimTrailingWhitespace(l.text); trimmed != l.text {
+			lines[i].text = trimmed
+			fixes = append(fixes, fix{line: l.num, message: "Removed trailing whitespace."})
+		}
+	}
+	return lines, fixes
+}
+
+// checkWhitespaceLines reports lines containing only spaces or tabs inside the body of a directive.
+// Such lines after the end of the body, before a line the directive doesn't indent, aren't reported.
+func checkWhitespaceLines(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	// The whitespace-only lines since the last line which wasn't blank, and the directive they'd be in.
+	var pending []line
+	var in *directive
+	for l := range lines {
+		r.next(l)
+		if strings.TrimSpace(l.text) == "" {
+			if l.text != "" && len(r.open) > 0 {
+				if len(pending) == 0 {
+					in = r.open[len(r.open)-1]
+				}
+				pending = append(pending, l)
+			}
+			continue
+		}
+		if len(pending) > 0 && indentation(l.text) > in.indent {
+			for _, p := range pending {
+				diags <- diagnostic{Line: p.num, Column: 1, Rule: ruleWhitespaceLine,
+					Message: fmt.Sprintf("Line in the body of the %v directive contains only whitespace.", in.name)}
+			}
+		}
+		pending = nil
+	}
+}
+
+// checkBlankLines ensures runs of blank lines are no longer than the max-blank-lines flag allows.
+func checkBlankLines(path string, lines <-chan line, diags chan<- diagnostic) {
+	run := 0
+	for l := range lines {
+		if strings.TrimSpace(l.text) != "" {
+			run = 0
+			continue
+		}
+		run++
+		if *maxBlankLinesFlag > 0 && run == *maxBlankLinesFlag+1 {
+			diags <- diagnostic{Line: l.num, Column: 1, Rule: ruleBlankLines,
+				Message: fmt.Sprintf("More than %v consecutive blank lines.", *maxBlankLinesFlag)}
+		}
+	}
+}
+
+// fixBlankLines shortens runs of blank lines longer than the max-blank-lines flag allows, removing the lines over the limit.
+func fixBlankLines(path string, lines []line) ([]line, []fix) {
+	if *maxBlankLinesFlag < 1 {
+		return lines, nil
+	}
+	var kept []line
+	var fixes []fix
+	run := 0
+	for _, l := range lines {
+		if strings.TrimSpace(l.text) != "" {
+			run = 0
+			kept = append(kept, l)
+			continue
+		}
+		run++
+		if run <= *maxBlankLinesFlag {
+			kept = append(kept, l)
+		} else if run == *maxBlankLinesFlag+1 {
+			fixes = append(fixes, fix{line: l.num, message: fmt.Sprintf("Removed blank lines over the maximum of %v.", *maxBlankLinesFlag)})
+		}
+	}
+	return kept, fixes
+}
+
+// checkSplitMarkup reports inline markup which starts on one line of a paragraph and ends on a later one.
+func checkSplitMarkup(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	var paragraph []line
+	check := func() {
+		// The paragraph's lines joined, and the offset each starts at.
+		text := ""
+		var starts []int
+		for _, l := range paragraph {
+			if text != "" {
+				text += "\n"
+			}
+			starts = append(starts, len(text))
+			text += l.text
+		}
+		for _, m := range markupSpanPattern.FindAllStringSubmatchIndex(text, -1) {
+			span := text[m[2]:m[3]]
+			if !strings.Contains(span, "\n") {
+				continue
+			}
+			i := len(starts) - 1
+			for starts[i] > m[2] {
+				i--
+			}
+			l := paragraph[i]
+			diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(text[starts[i]:m[2]]) + 1, Rule: ruleSplitMarkup,
+				Message: fmt.Sprintf("%v is split across a line break.", markupKind(span))}
+		}
+		paragraph = nil
+	}
+	for l := range lines {
+		r.next(l)
+		text := strings.TrimSpace(l.text)
+		if text == "" || r.inBody(l, literalDirectives...) || strings.HasPrefix(text, "..") ||
+			strings.HasPrefix(text, "|") || strings.HasPrefix(text, "+") || isAdornment(l.text) {
+			check()
+			continue
+		}
+		paragraph = append(paragraph, l)
+	}
+	check()
+}
+
+// checkFloatingLabels ensures labels are followed by a section heading or a figure, after at most one
+// blank line, or by another label which is.
+func checkFloatingLabels(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	// The labels waiting for what follows them, the blank lines since the last of them, and, when
+	// that's text which could be a title, the text.
+	var labels []line
+	blanks := 0
+	var title *line
+	report := func() {
+		for _, l := range labels {
+			name, _ := label(l.text)
+			diags <- diagnostic{Line: l.num, Column: indentation(l.text) + 1, Rule: ruleFloatingLabel,
+				Message: fmt.Sprintf("Label %q isn't followed by a section heading or a figure.", name)}
+		}
+		labels, title = nil, nil
+	}
+	for l := range lines {
+		r.next(l)
+		if len(labels) == 0 {
+			if _, ok := label(l.text); ok && !r.inBody(l, literalDirectives...) {
+				labels, blanks = []line{l}, 0
+			}
+			continue
+		}
+		blank := strings.TrimSpace(l.text) == ""
+		switch {
+		case title != nil:
+			if isAdornment(l.text) {
+				labels, title = nil, nil
+			} else {
+				report()
+			}
+		case blank:
+			blanks++
+			if blanks > 1 {
+				report()
+			}
+			continue
+		default:
+			if _, ok := label(l.text); ok {
+				labels, blanks = append(labels, l), 0
+				continue
+			}
+			m := directivePattern.FindStringSubmatch(l.text)
+			if isAdornment(l.text) || (m != nil && strings.ToLower(m[2]) == "figure") {
+				labels = nil
+			} else if m != nil || strings.HasPrefix(strings.TrimSpace(l.text), "..") {
+				report()
+			} else {
+				text := l
+				title = &text
+			}
+			continue
+		}
+		if _, ok := label(l.text); ok && !r.inBody(l, literalDirectives...) {
+			labels, blanks = []line{l}, 0
+		}
+	}
+	report()
+}
+
+// checkTabs ensures .rst files don't use tab characters, since directive bodies are indentation
+// sensitive and tabs render unpredictably. Indentation mixing tabs and spaces is called out.
+func checkTabs(path string, lines <-chan line, diags chan<- diagnostic) {
+	for l := range lines {
+		i := strings.IndexByte(l.text, '\t')
+		if i < 0 {
+			continue
+		}
+		message := "Line contains a tab character."
+		leading := l.text[:len(l.text)-len(strings.TrimLeft(l.text, " \t"))]
+		if strings.Contains(leading, " ") && strings.Contains(leading, "\t") {
+			message = "Line is indented with a mix of tabs and spaces."
+		} else if strings.Contains(leading, "\t") {
+			message = "Line is indented with tabs."
+		}
+		diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(l.text[:i]) + 1, Rule: ruleTabs, Message: message}
+	}
+}
+
+// expandIndentation replaces the tabs in the leading whitespace of text with spaces, advancing to the next
+// multiple of width, leaving any tabs after the indentation alone.
+func expandIndentation(text string, width int) string {
+	var b strings.Builder
+	n := 0
+	for i, c := range text {
+		switch c {
+		case ' ':
+			n++
+			b.WriteByte(' ')
+		case '\t':
+			spaces := width - n%width
+			n += spaces
+			b.WriteString(strings.Repeat(" ", spaces))
+		default:
+			return b.String() + text[i:]
+		}
+	}
+	return b.String()
+}
+
+// fixTabs replaces tabs in the indentation of lines with spaces, as tab stops every tab-width columns.
+// Literal blocks and the bodies of literal directives are left alone, since their tabs can be
+// part of the sample, like the recipes of a Makefile.
+func fixTabs(path string, lines []line) ([]line, []fix) {
+	if *tabWidthFlag < 1 {
+		return lines, nil
+	}
+	var r directiveReader
+	var fixes []fix
+	// While in a literal block, or the paragraph introducing one, the paragraph's indentation.
+	literal := -1
+	for i, l := range lines {
+		r.next(l)
+		blank := strings.TrimSpace(l.text) == ""
+		if literal >= 0 && !blank && indentation(l.text) <= literal {
+			literal = -1
+		}
+		if literal >= 0 || r.inBody(l, literalDirectives...) {
+			continue
+		}
+		if !blank && introducesLiteral(l) {
+			literal = indentation(l.text)
+		}
+		if expanded := expandIndentation(l.text, *tabWidthFlag); expanded != l.text {
+			lines[i].text = expanded
+			fixes = append(fixes, fix{line: l.num, message: "Replaced the tabs indenting the line with spaces."})
+		}
+	}
+	return lines, fixes
+}
+
+// isTableLine reports whether text is part of a grid or simple table.
+func isTableLine(text string) bool {
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, "|") || strings.HasPrefix(trimmed, "+") {
+		return true
+	}
+	return strings.Trim(trimmed, "= ") == "" && strings.Contains(trimmed, "= ")
+}
+
+// checkLineLength ensures lines aren't longer than the maximum line length, to keep diffs reviewable.
+// Lines with URLs, and table rows, are exempt since they can't be wrapped.
+func checkLineLength(path string, lines <-chan line, diags chan<- diagnostic) {
+	for l := range lines {
+		length := utf8.RuneCountInString(l.text)
+		if *maxLineLengthFlag <= 0 || length <= *maxLineLengthFlag {
+			continue
+		}
+		if strings.Contains(l.text, "://") || isTableLine(l.text) {
+			continue
+		}
+		diags <- diagnostic{Line: l.num, Column: *maxLineLengthFlag + 1, Rule: ruleLineLength,
+			Message: fmt.Sprintf("Line is %v characters, longer than the maximum of %v.", length, *maxLineLengthFlag)}
+	}
+}
+
+// checkFinalNewline ensures the last line of a file ends with a newline.
+func checkFinalNewline(path string, lines <-chan line, diags chan<- diagnostic) {
+	var last line
+	for l := range lines {
+		last = l
+	}
+	if last.num > 0 && last.eol == "" {
+		diags <- diagnostic{Line: last.num, Column: utf8.RuneCountInString(last.text) + 1, Rule: ruleFinalNewline,
+			Message: "File doesn't end with a newline."}
+	}
+}
+
+// fixFinalNewline ends files with exactly one newline, removing any blank lines at the end,
+// and adding a line ending to the last line if it has none.
+func fixFinalNewline(path string, lines []line) ([]line, []fix) {
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1].text) == "" {
+		end--
+	}
+	if end == 0 {
+		return lines, nil
+	}
+	var fixes []fix
+	if end < len(lines) {
+		fixes = append(fixes, fix{line: end + 1, message: "Removed the blank lines at the end of the file."})
+		lines = lines[:end]
+	}
+	if last := &lines[end-1]; last.eol == "" {
+		last.eol = lineEndings[*lineEndingsFlag].eol
+		fixes = append(fixes, fix{line: end, message: "Added a newline at the end of the file."})
+	}
+	return lines, fixes
+}
+
+// A lineEnding is one of the line endings which can be given with the line-endings flag.
+type lineEnding struct {
+	eol   string
+	short string
+	name  string
+}
+
+// lineEndings are the line endings which can be given with the line-endings flag.
+var lineEndings = map[string]lineEnding{
+	"lf":   {"\n", "LF", "Unix (LF)"},
+	"crlf": {"\r\n", "CRLF", "Windows (CRLF)"},
+}
+
+// checkLineEndings ensures lines end as the line-endings flag requires, with "\n" by default rather than "\r\n",
+// reporting the first line with the other line ending.
+func checkLineEndings(path string, lines <-chan line, diags chan<- diagnostic) {
+	want, other := lineEndings["lf"], lineEndings["crlf"]
+	if *lineEndingsFlag == "crlf" {
+		want, other = other, want
+	}
+	var first line
+	total, wrong := 0, 0
+	for l := range lines {
+		if l.eol == "" {
+			continue
+		}
+		total++
+		if l.eol != want.eol {
+			if wrong == 0 {
+				first = l
+			}
+			wrong++
+		}
+	}
+	if wrong == 0 {
+		return
+	}
+	message := fmt.Sprintf("File has %v line endings.", other.name)
+	if wrong < total {
+		message = fmt.Sprintf("File mixes %v and %v line endings, with %v of %v lines ending in %v.",
+			other.name, want.name, wrong, total, other.short)
+	}
+	diags <- diagnostic{Line: first.num, Column: utf8.RuneCountInString(first.text) + 1, Rule: ruleLineEndings, Message: message}
+}
+
+// fixLineEndings converts the line endings of every line to those the line-endings flag requires.
+// Files are rewritten whole, so the fix is reported once, with the number of lines converted.
+func fixLineEndings(path string, lines []line) ([]line, []fix) {
+	want := lineEndings[*lineEndingsFlag]
+	first, converted := 0, 0
+	for i, l := range lines {
+		if l.eol == "" || l.eol == want.eol {
+			continue
+		}
+		if converted == 0 {
+			first = l.num
+		}
+		converted++
+		lines[i].eol = want.eol
+	}
+	if converted == 0 {
+		return lines, nil
+	}
+	return lines, []fix{{line: first, message: fmt.Sprintf("Converted %v lines to %v line endings.", converted, want.name)}}
+}
+
+// checkEncoding ensures files are UTF-8 without a byte-order mark, reporting the first invalid byte.
+func checkEncoding(path string, lines <-chan line, diags chan<- diagnostic) {
+	invalid := false
+	for l := range lines {
+		if l.num == 1 && strings.HasPrefix(l.text, "\uFEFF") {
+			diags <- diagnostic{Line: l.num, Column: 1, Rule: ruleEncoding, Message: "File starts with a UTF-8 byte-order mark."}
+		}
+		if invalid || utf8.ValidString(l.text) {
+			continue
+		}
+		invalid = true
+		i := 0
+		for i < len(l.text) {
+			r, size := utf8.DecodeRuneInString(l.text[i:])
+			if r == utf8.RuneError && size == 1 {
+				break
+			}
+			i += size
+		}
+		diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(l.text[:i]) + 1, Rule: ruleEncoding,
+			Message: fmt.Sprintf("File isn't valid UTF-8, with byte 0x%02X at offset %v.", l.text[i], l.offset+i)}
+	}
+}
+
+// suspiciousCharacters are the characters word processors insert which look like, or are invisible
+// next to, ordinary text, and their names.
+var suspiciousCharacters = map[rune]string{
+	'\u00A0': "non-breaking space",
+	'\u200B': "zero-width space",
+	'\u200C': "zero-width non-joiner",
+	'\u200D': "zero-width joiner",
+	'\u2060': "word joiner",
+	'\uFEFF': "zero-width no-break space",
+}
+
+// curlyQuotes are the typographic quotes and apostrophes word processors insert, and the straight quotes to use instead.
+var curlyQuotes = map[rune]struct{ name, straight string }{
+	'\u2018': {"left single quotation mark", "'"},
+	'\u2019': {"right single quotation mark", "'"},
+	'\u201A': {"single low-9 quotation mark", "'"},
+	'\u201B': {"single high-reversed-9 quotation mark", "'"},
+	'\u201C': {"left double quotation mark", "\""},
+	'\u201D': {"right double quotation mark", "\""},
+	'\u201E': {"double low-9 quotation mark", "\""},
+	'\u201F': {"double high-reversed-9 quotation mark", "\""},
+	'\u2032': {"prime", "'"},
+	'\u2033': {"double prime", "\""},
+}
+
+// checkSuspiciousCharacters reports each character in suspiciousCharacters.
+// A byte-order mark at the start of the file is left to checkEncoding.
+func checkSuspiciousCharacters(path string, lines <-chan line, diags chan<- diagnostic) {
+	for l := range lines {
+		column := 0
+		for i, r := range l.text {
+			column++
+			name, ok := suspiciousCharacters[r]
+			if !ok || (l.num == 1 && i == 0 && r == '\uFEFF') {
+				continue
+			}
+			diags <- diagnostic{Line: l.num, Column: column, Rule: ruleSuspiciousCharacter,
+				Message: fmt.Sprintf("Line contains a %v (U+%04X).", name, r)}
+		}
+	}
+}
+
+// checkCurlyQuotes reports each of the curlyQuotes, with the straight quote to use instead.
+// Those in code blocks and inline literals are called out, since they break the code.
+func checkCurlyQuotes(path string, lines <-chan line, diags chan<- diagnostic) {
+	var directives directiveReader
+	for l := range lines {
+		directives.next(l)
+		inCode := directives.inBody(l, literalDirectives...)
+		literals := inlineLiteralPattern.FindAllStringIndex(l.text, -1)
+		column := 0
+		for i, r := range l.text {
+			column++
+			q, ok := curlyQuotes[r]
+			if !ok {
+				continue
+			}
+			where := ""
+			for _, m := range literals {
+				if i >= m[0] && i < m[1] {
+					where = " in an inline literal"
+				}
+			}
+			if inCode {
+				where = " in a code block"
+			}
+			diags <- diagnostic{Line: l.num, Column: column, Rule: ruleCurlyQuote,
+				Message: fmt.Sprintf("Line contains a %v (U+%04X)%v, use %v instead.", q.name, r, where, q.straight)}
+		}
+	}
+}
+
+// checkCodeLanguage ensures code blocks give a language, and that it's one of the pygmentsLexers.
+func checkCodeLanguage(path string, lines <-chan line, diags chan<- diagnostic) {
+	var directives directiveReader
+	for l := range lines {
+		directives.next(l)
+		m := directivePattern.FindStringSubmatch(l.text)
+		if m == nil || !contains(codeDirectives, strings.ToLower(m[2])) || directives.inBody(l, literalDirectives...) {
+			continue
+		}
+		language := strings.TrimSpace(m[3])
+		if language == "" {
+			diags <- diagnostic{Line: l.num, Column: len(m[1]) + 1, Rule: ruleCodeLanguage,
+				Message: fmt.Sprintf("The %v directive doesn't give a language.", m[2])}
+		} else if !contains(pygmentsLexers, strings.ToLower(language)) {
+			diags <- diagnostic{Line: l.num, Column: len(m[1]) + 1, Rule: ruleCodeLanguage,
+				Message: fmt.Sprintf("The %v directive's language %q isn't known to Pygments.", m[2], language)}
+		}
+	}
+}
+
+// checkDirectiveNames reports directives whose names look like misspellings of known directives.
+func checkDirectiveNames(path string, lines <-chan line, diags chan<- diagnostic) {
+	var directives directiveReader
+	for l := range lines {
+		directives.next(l)
+		m := directivePattern.FindStringSubmatch(l.text)
+		if m == nil || directives.inBody(l, literalDirectives...) {
+			continue
+		}
+		if closest, ok := closestDirective(strings.ToLower(m[2])); ok {
+			diags <- diagnostic{Line: l.num, Column: len(m[1]) + 4, Rule: ruleDirectiveName,
+				Message: fmt.Sprintf("Unknown directive %q, did you mean %q?", m[2], closest)}
+		}
+	}
+}
+
+// checkRawHTML ensures pages don't use raw HTML, unless they're allowed to by the raw-html flag.
+func checkRawHTML(path string, lines <-chan line, diags chan<- diagnostic) {
+	rel := strings.Join(relParts(path, repo.root), "/")
+	allowed := false
+	for _, pattern := range splitList(*rawHTMLFlag) {
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			allowed = true
+		}
+	}
+	for l := range lines {
+		m := directivePattern.FindStringSubmatch(l.text)
+		if allowed || m == nil || m[2] != "raw" || !contains(strings.Fields(strings.ToLower(m[3])), "html") {
+			continue
+		}
+		diags <- diagnostic{Line: l.num, Column: len(m[1]) + 1, Rule: ruleRawHTML,
+			Message: "Raw HTML bypasses the theme, and breaks the PDF and EPUB builds."}
+	}
+}
+
+// A deprecation is a directive, role or directive option which is deprecated, and how to migrate from it.
+type deprecation struct {
+	// The directive, or the directive of the option.
+	directive string
+	role      string
+	option    string
+	hint      string
+}
+
+// parseDeprecations parses the deprecated flag, a comma separated list of directives like "name::",
+// roles like ":name:", and options like "directive:: :option:", each optionally followed by "=" and a hint.
+func parseDeprecations(list string) []deprecation {
+	var deprecations []deprecation
+	for _, e := range parseVocabulary(list) {
+		d := deprecation{hint: e.replacement}
+		fields := strings.Fields(e.phrase)
+		switch {
+		case len(fields) == 2 && strings.HasSuffix(fields[0], "::"):
+			d.directive, d.option = strings.TrimSuffix(fields[0], "::"), strings.Trim(fields[1], ":")
+		case strings.HasSuffix(e.phrase, "::"):
+			d.directive = strings.TrimSuffix(e.phrase, "::")
+		default:
+			d.role = strings.Trim(e.phrase, ":")
+		}
+		deprecations = append(deprecations, d)
+	}
+	return deprecations
+}
+
+// message describes the deprecated use of what, adding the hint when there is one.
+func (d deprecation) message(what string) string {
+	if d.hint == "" {
+		return what + " is deprecated."
+	}
+	return fmt.Sprintf("%v is deprecated, use %q instead.", what, d.hint)
+}
+
+// checkDeprecated ensures pages don't use the directives, roles and options given with the deprecated flag.
+func checkDeprecated(path string, lines <-chan line, diags chan<- diagnostic) {
+	deprecations := parseDeprecations(*deprecatedFlag)
+	var directives directiveReader
+	// While a directive's options can follow, its name and indentation.
+	directive, options := "", -1
+	for l := range lines {
+		directives.next(l)
+		if m := directivePattern.FindStringSubmatch(l.text); m != nil {
+			directive, options = strings.ToLower(m[2]), len(m[1])
+			for _, d := range deprecations {
+				if d.option == "" && d.directive == directive {
+					diags <- diagnostic{Line: l.num, Column: len(m[1]) + 1, Rule: ruleDeprecated,
+						Message: d.message(fmt.Sprintf("Directive %q", directive))}
+				}
+			}
+			continue
+		}
+		if m := optionPattern.FindStringSubmatch(l.text); m != nil && options >= 0 && indentation(l.text) > options {
+			for _, d := range deprecations {
+				if d.directive == directive && d.option == m[1] {
+					diags <- diagnostic{Line: l.num, Column: indentation(l.text) + 1, Rule: ruleDeprecated,
+						Message: d.message(fmt.Sprintf("Option %q of directive %q", m[1], directive))}
+				}
+			}
+			continue
+		}
+		options = -1
+		if directives.inBody(l, literalDirectives...) {
+			continue
+		}
+		for _, ro := range roles(l.text) {
+			for _, d := range deprecations {
+				if d.role != "" && d.role == ro.name {
+					diags <- diagnostic{Line: l.num, Column: ro.column, Rule: ruleDeprecated,
+						Message: d.message(fmt.Sprintf("Role %q", ro.name))}
+				}
+			}
+		}
+	}
+}
+
+// checkRoleNames ensures the roles used are known, defined earlier in the page, or given with the roles flag,
+// suggesting the intended role for misspellings.
+func checkRoleNames(path string, lines <-chan line, diags chan<- diagnostic) {
+	allowed := append(append(append([]string{}, knownRoles...), extensionNames(true)...), splitList(*rolesFlag)...)
+	var directives directiveReader
+	for l := range lines {
+		directives.next(l)
+		if directives.inBody(l, literalDirectives...) {
+			continue
+		}
+		if m := roleDefinitionPattern.FindStringSubmatch(l.text); m != nil {
+			allowed = append(allowed, m[1])
+			continue
+		}
+		for _, ro := range roles(l.text) {
+			if strings.Contains(ro.name, ":") || contains(allowed, ro.name) {
+				continue
+			}
+			message := fmt.Sprintf("Unknown role %q.", ro.name)
+			if closest, ok := closest(ro.name, allowed); ok {
+				message = fmt.Sprintf("Unknown role %q, did you mean %q?", ro.name, closest)
+			}
+			diags <- diagnostic{Line: l.num, Column: ro.column, Rule: ruleRoleName, Message: message}
+		}
+	}
+}
+
+// checkRefText ensures :ref: links have link text, and that they give their text explicitly, or leave it
+// to the section they refer to, as required by the ref-text flag. Back to the top links always give their text.
+func checkRefText(path string, lines <-chan line, diags chan<- diagnostic) {
+	var directives directiveReader
+	for l := range lines {
+		directives.next(l)
+		if directives.inBody(l, literalDirectives...) {
+			continue
+		}
+		for _, ro := range roles(l.text) {
+			if ro.name != "ref" {
+				continue
+			}
+			m := explicitTargetPattern.FindStringSubmatch(ro.text)
+			var message string
+			switch {
+			case m != nil && strings.TrimSpace(m[1]) == "":
+				message = fmt.Sprintf("Link to %q has empty link text.", ro.target())
+			case m == nil && *refTextFlag == "explicit":
+				message = fmt.Sprintf("Link to %q should give its link text, like \":ref:`Text <%v>`\".", ro.target(), ro.target())
+			case m != nil && *refTextFlag == "implicit" && m[1] != "Back to the top":
+				message = fmt.Sprintf("Link to %q should use the title it refers to, like \":ref:`%v`\".", ro.target(), ro.target())
+			default:
+				continue
+			}
+			diags <- diagnostic{Line: l.num, Column: ro.column, Rule: ruleRefText, Message: message}
+		}
+	}
+}
+
+// checkAdmonitions ensures admonitions are one of those allowed by the admonitions flag, have a blank line
+// before their body, and there are no more than allowed by the max-admonitions flag.
+func checkAdmonitions(path string, lines <-chan line, diags chan<- diagnostic) {
+	allowed := splitList(strings.ToLower(*admonitionsFlag))
+	var directives directiveReader
+	// The admonition on the previous line, waiting for a blank line, or options, before its body.
+	var opened *line
+	count := 0
+	for l := range lines {
+		directives.next(l)
+		if opened != nil && strings.TrimSpace(l.text) != "" && indentation(l.text) > indentation(opened.text) {
+			if optionPattern.MatchString(l.text) {
+				continue
+			}
+			diags <- diagnostic{Line: l.num, Column: indentation(l.text) + 1, Rule: ruleAdmonition,
+				Message: "Admonition body doesn't follow a blank line."}
+		}
+		opened = nil
+		if directives.inBody(l, literalDirectives...) {
+			continue
+		}
+		m := directivePattern.FindStringSubmatch(l.text)
+		if m == nil || !contains(admonitionDirectives, strings.ToLower(m[2])) {
+			continue
+		}
+		count++
+		if !contains(allowed, strings.ToLower(m[2])) {
+			diags <- diagnostic{Line: l.num, Column: len(m[1]) + 1, Rule: ruleAdmonition,
+				Message: fmt.Sprintf("Admonition %q isn't one of those allowed: %v.", m[2], strings.Join(allowed, ", "))}
+		}
+		if *maxAdmonitionsFlag > 0 && count == *maxAdmonitionsFlag+1 {
+			diags <- diagnostic{Line: l.num, Column: len(m[1]) + 1, Rule: ruleAdmonition,
+				Message: fmt.Sprintf("Page has more than %v admonitions.", *maxAdmonitionsFlag)}
+		}
+		if strings.TrimSpace(m[3]) == "" || strings.ToLower(m[2]) == "admonition" {
+			admonition := l
+			opened = &admonition
+		}
+	}
+}
+
+// emphasizedPattern matches bold or double quoted text, and the word following it.
+var emphasizedPattern = regexp.MustCompile(`(\*\*([^*]+)\*\*|"([^"]+)"|“([^”]+)”)(?:\s+([\w-]+))?`)
+
+// checkUILabels reports bold or quoted text which names an element of the user interface, either because it's
+// followed by one of the words in the ui-elements flag, or because it's a path through menus such as "A > B".
+func checkUILabels(path string, lines <-chan line, diags chan<- diagnostic) {
+	elements := splitList(strings.ToLower(*uiElementsFlag))
+	var directives directiveReader
+	for l := range lines {
+		directives.next(l)
+		if directives.inBody(l, literalDirectives...) {
+			continue
+		}
+		for _, m := range emphasizedPattern.FindAllStringSubmatchIndex(l.text, -1) {
+			text := ""
+			for i := 4; i <= 8; i += 2 {
+				if m[i] >= 0 {
+					text = l.text[m[i]:m[i+1]]
+				}
+			}
+			column := utf8.RuneCountInString(l.text[:m[0]]) + 1
+			if strings.Contains(text, " > ") {
+				diags <- diagnostic{Line: l.num, Column: column, Rule: ruleUILabel,
+					Message: fmt.Sprintf("Use :menuselection:`%v` for paths through menus.", strings.ReplaceAll(text, " > ", " --> "))}
+			} else if m[10] >= 0 && contains(elements, strings.ToLower(l.text[m[10]:m[11]])) {
+				diags <- diagnostic{Line: l.num, Column: column, Rule: ruleUILabel,
+					Message: fmt.Sprintf("Use :guilabel:`%v` for elements of the user interface.", text)}
+			}
+		}
+	}
+}
+
+// checkFootnotes ensures footnote references have a footnote in the same page, and footnotes are referred to.
+// Citations, which can be defined in any page, are checked by checkCitations.
+func checkFootnotes(path string, lines <-chan line, diags chan<- diagnostic) {
+	var directives directiveReader
+	var refs []nameRef
+	footnotes := make(map[string]nameRef)
+	var order []string
+	anonymous := make(map[string]int)
+	for l := range lines {
+		directives.next(l)
+		if directives.inBody(l, literalDirectives...) {
+			continue
+		}
+		text := l.text
+		if m := footnotePattern.FindStringSubmatchIndex(text); m != nil && !isCitation(text[m[2]:m[3]]) {
+			label := text[m[2]:m[3]]
+			if label == "#" || label == "*" {
+				anonymous[label]--
+			} else if _, ok := footnotes[label]; !ok {
+				footnotes[label] = nameRef{name: label, line: l.num, column: m[2]}
+				order = append(order, label)
+			}
+			text = strings.Repeat(" ", m[1]) + text[m[1]:]
+		}
+		for _, ref := range footnoteRefs(text) {
+			if isCitation(ref.name) {
+				continue
+			}
+			ref.line = l.num
+			if ref.name == "#" || ref.name == "*" {
+				anonymous[ref.name]++
+				continue
+			}
+			refs = append(refs, ref)
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, ref := range refs {
+		used[ref.name] = true
+		if _, ok := footnotes[ref.name]; !ok {
+			diags <- diagnostic{Line: ref.line, Column: ref.column, Rule: ruleFootnote,
+				Message: fmt.Sprintf("Footnote reference [%v]_ has no matching footnote.", ref.name)}
+		}
+	}
+	for _, label := range order {
+		if !used[label] {
+			f := footnotes[label]
+			diags <- diagnostic{Line: f.line, Column: f.column, Rule: ruleFootnote,
+				Message: fmt.Sprintf("Footnote [%v] isn't referred to.", label)}
+		}
+	}
+	for _, label := range []string{"#", "*"} {
+		if n := anonymous[label]; n > 0 {
+			diags <- diagnostic{Line: 1, Column: 1, Rule: ruleFootnote,
+				Message: fmt.Sprintf("Page has %v more [%v]_ references than [%v] footnotes.", n, label, label)}
+		} else if n < 0 {
+			diags <- diagnostic{Line: 1, Column: 1, Rule: ruleFootnote,
+				Message: fmt.Sprintf("Page has %v more [%v] footnotes than [%v]_ references.", -n, label, label)}
+		}
+	}
+}
+
+// todoPattern matches the words marking unfinished text.
+var todoPattern = regexp.MustCompile(`\b(TODO|FIXME)\b`)
+
+// isComment reports whether text starts a comment, which is explicit markup that isn't
+// a directive, label, hyperlink target, footnote, citation or substitution definition.
+func isComment(text string) bool {
+	trimmed := strings.TrimSpace(text)
+	if trimmed != ".." && !strings.HasPrefix(trimmed, ".. ") {
+		return false
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(trimmed, ".."))
+	return !directivePattern.MatchString(text) && !strings.HasPrefix(rest, "_") &&
+		!footnotePattern.MatchString(text) && !substitutionDefinitionPattern.MatchString(text)
+}
+
+// checkTodos reports todo directives, and comments containing TODO or FIXME.
+// With the fail-on-todo flag they're reported as errors.
+func checkTodos(path string, lines <-chan line, diags chan<- diagnostic) {
+	var sev severity
+	if *failOnTodoFlag {
+		sev = severityError
+	}
+	var directives directiveReader
+	// While in a comment, the indentation of its "..".
+	comment := -1
+	for l := range lines {
+		directives.next(l)
+		if comment >= 0 && strings.TrimSpace(l.text) != "" && indentation(l.text) <= comment {
+			comment = -1
+		}
+		if directives.inBody(l, literalDirectives...) {
+			continue
+		}
+		if comment < 0 && isComment(l.text) {
+			comment = indentation(l.text)
+		}
+		if comment >= 0 {
+			if loc := todoPattern.FindStringIndex(l.text); loc != nil {
+				diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(l.text[:loc[0]]) + 1, Rule: ruleTodo,
+					Message: fmt.Sprintf("Comment contains %v.", l.text[loc[0]:loc[1]]), severity: sev}
+			}
+			continue
+		}
+		if m := directivePattern.FindStringSubmatch(l.text); m != nil && strings.ToLower(m[2]) == "todo" {
+			diags <- diagnostic{Line: l.num, Column: len(m[1]) + 1, Rule: ruleTodo, Message: "Page has a todo directive.", severity: sev}
+		}
+	}
+}
+
+// checkDuplicateSections ensures no two headings in a page have the same title, which Sphinx
+// gives ambiguous anchors.
+func checkDuplicateSections(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	var hr headingReader
+	seen := make(map[string]int)
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		h := hr.next(l)
+		if h == nil {
+			continue
+		}
+		key := strings.ToLower(h.title)
+		if first, ok := seen[key]; ok {
+			diags <- diagnostic{Line: h.line, Column: 1, Rule: ruleDuplicateSection,
+				Message: fmt.Sprintf("Section title %q is also used on line %v.", h.title, first)}
+			continue
+		}
+		seen[key] = h.line
+	}
+}
+
+// minorWords are the words which aren't capitalized in the middle of a title case heading.
+var minorWords = []string{"a", "an", "and", "as", "at", "but", "by", "for", "from", "in", "into", "nor", "of", "on", "or",
+	"per", "the", "to", "via", "vs", "with"}
+
+// inlineMarkupPattern matches roles and inline literals, whose capitalization isn't checked.
+var inlineMarkupPattern = regexp.MustCompile("``[^`]+``|(:[\\w:.+-]+:)?`[^`]+`_{0,2}")
+
+// headingCaseProblem returns the first word of title which doesn't follow the capitalization style,
+// either "sentence" or "title", and whether it should be capitalized. Words in keep are left as they are.
+func headingCaseProblem(title, style string, keep []string) (string, bool, bool) {
+	words := strings.Fields(inlineMarkupPattern.ReplaceAllString(title, "``"))
+	first := true
+	for i, word := range words {
+		isFirst := first
+		first = strings.HasSuffix(word, ":")
+		bare := strings.TrimFunc(word, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		if bare == "" || !unicode.IsLetter([]rune(bare)[0]) || contains(keep, bare) {
+			continue
+		}
+		// Acronyms, and words with capitals after the first letter, keep their capitalization.
+		runes := []rune(bare)
+		if strings.IndexFunc(string(runes[1:]), unicode.IsUpper) >= 0 || strings.IndexFunc(bare, unicode.IsDigit) >= 0 {
+			continue
+		}
+		capitalized := unicode.IsUpper(runes[0])
+		lower := strings.ToLower(bare)
+		switch {
+		case isFirst && !capitalized:
+			return bare, true, true
+		case isFirst:
+		case style == "sentence" && capitalized:
+			return bare, false, true
+		case style == "title" && !capitalized && !(contains(minorWords, lower) && i < len(words)-1):
+			return bare, true, true
+		}
+	}
+	return "", false, false
+}
+
+// checkHeadingCase ensures headings follow the capitalization given with the heading-case flag.
+func checkHeadingCase(path string, lines <-chan line, diags chan<- diagnostic) {
+	style := *headingCaseFlag
+	keep := splitList(*headingWordsFlag)
+	var r directiveReader
+	var hr headingReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		h := hr.next(l)
+		if h == nil || style == "" {
+			continue
+		}
+		word, capitalize, ok := headingCaseProblem(h.title, style, keep)
+		if !ok {
+			continue
+		}
+		should := "be lowercase"
+		if capitalize {
+			should = "be capitalized"
+		}
+		diags <- diagnostic{Line: h.line, Column: 1, Rule: ruleHeadingCase,
+			Message: fmt.Sprintf("Heading %q isn't in %v case: %q should %v.", h.title, style, word, should)}
+	}
+}
+
+// isIdentifierJoin reports whether c joins a word to the rest of a file name, URL or identifier.
+func isIdentifierJoin(c byte) bool {
+	return c == '-' || c == '_' || c == '/' || c == '@' || c == '.' || c == '\\' || c == '='
+}
+
+// isDigit reports whether c is a decimal digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isWordByte reports whether c is part of a word.
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// proseText returns text with roles, inline literals and URLs replaced by spaces, leaving only prose.
+func proseText(text string) string {
+	blank := func(s string) string { return strings.Repeat(" ", len(s)) }
+	text = inlineMarkupPattern.ReplaceAllStringFunc(text, blank)
+	return urlPattern.ReplaceAllStringFunc(text, blank)
+}
+
+// urlPattern matches URLs and email addresses.
+var urlPattern = regexp.MustCompile(`(?:[A-Za-z][\w+.-]*://|mailto:|www\.)\S+|\S+@\S+\.\w+`)
+
+// termMatches finds the words of text which are term, ignoring case, but capitalized differently,
+// returning their offsets. Words joined to a file name, URL or identifier are skipped.
+func termMatches(text, term string) []int {
+	var found []int
+	lower, lowerTerm := strings.ToLower(text), strings.ToLower(term)
+	if len(lower) != len(text) {
+		return nil
+	}
+	for i := 0; ; {
+		j := strings.Index(lower[i:], lowerTerm)
+		if j < 0 {
+			return found
+		}
+		start, end := i+j, i+j+len(term)
+		i = end
+		if start > 0 && (isWordByte(text[start-1]) || isIdentifierJoin(text[start-1])) {
+			continue
+		}
+		if end < len(text) && (isWordByte(text[end]) || (isIdentifierJoin(text[end]) && end+1 < len(text) && isWordByte(text[end+1]))) {
+			continue
+		}
+		if text[start:end] != term {
+			found = append(found, start)
+		}
+	}
+}
+
+// checkTerms ensures the names given with the terms flag are capitalized as given in prose,
+// outside of code blocks, explicit markup, roles and inline literals.
+func checkTerms(path string, lines <-chan line, diags chan<- diagnostic) {
+	terms := splitList(*termsFlag)
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) || strings.HasPrefix(strings.TrimSpace(l.text), "..") {
+			continue
+		}
+		text := proseText(l.text)
+		for _, term := range terms {
+			for _, i := range termMatches(text, term) {
+				diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(text[:i]) + 1, Rule: ruleTerm,
+					Message: fmt.Sprintf("%q should be capitalized as %q.", text[i:i+len(term)], term)}
+			}
+		}
+	}
+}
+
+// A vocabularyEntry is a word or phrase to avoid, and its suggested replacement, if any.
+type vocabularyEntry struct {
+	phrase, replacement string
+}
+
+// parseVocabulary parses the vocabulary flag, a comma separated list of phrases, each optionally
+// followed by "=" and its replacement.
+func parseVocabulary(list string) []vocabularyEntry {
+	var entries []vocabularyEntry
+	for _, item := range splitList(list) {
+		parts := strings.SplitN(item, "=", 2)
+		e := vocabularyEntry{phrase: strings.TrimSpace(parts[0])}
+		if len(parts) == 2 {
+			e.replacement = strings.TrimSpace(parts[1])
+		}
+		if e.phrase != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// phraseMatches finds the occurrences of phrase in text as whole words, ignoring case, returning their offsets.
+func phraseMatches(text, phrase string) []int {
+	var found []int
+	lower, lowerPhrase := strings.ToLower(text), strings.ToLower(phrase)
+	if len(lower) != len(text) {
+		return nil
+	}
+	for i := 0; ; {
+		j := strings.Index(lower[i:], lowerPhrase)
+		if j < 0 {
+			return found
+		}
+		start, end := i+j, i+j+len(phrase)
+		i = start + 1
+		if start > 0 && isWordByte(text[start-1]) || end < len(text) && isWordByte(text[end]) && isWordByte(text[end-1]) {
+			continue
+		}
+		found = append(found, start)
+	}
+}
+
+// checkVocabulary reports the words and phrases given with the vocabulary flag which are used in prose.
+func checkVocabulary(path string, lines <-chan line, diags chan<- diagnostic) {
+	entries := parseVocabulary(*vocabularyFlag)
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) || strings.HasPrefix(strings.TrimSpace(l.text), "..") {
+			continue
+		}
+		text := proseText(l.text)
+		for _, e := range entries {
+			for _, i := range phraseMatches(text, e.phrase) {
+				message := fmt.Sprintf("Avoid %q.", text[i:i+len(e.phrase)])
+				if e.replacement != "" {
+					message = fmt.Sprintf("Use %q instead of %q.", e.replacement, text[i:i+len(e.phrase)])
+				}
+				diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(text[:i]) + 1, Rule: ruleVocabulary, Message: message}
+			}
+		}
+	}
+}
+
+// loadDictionary reads the words of the word lists at paths, one per line, in lowercase.
+// Lines starting with "#" are comments.
+func loadDictionary(paths []string) (map[string]bool, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	words := make(map[string]bool)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range splitLines(data) {
+			word := strings.TrimSpace(l.text)
+			if word != "" && !strings.HasPrefix(word, "#") {
+				words[strings.ToLower(word)] = true
+			}
+		}
+	}
+	return words, nil
+}
+
+// wordPattern matches a word of prose, which can contain apostrophes.
+var wordPattern = regexp.MustCompile(`\pL+(?:['’]\pL+)*`)
+
+// misspelled reports whether word isn't in dictionary. Acronyms, and words with capitals
+// after their first letter, aren't checked.
+func misspelled(word string, dictionary map[string]bool) bool {
+	runes := []rune(word)
+	if strings.IndexFunc(string(runes[1:]), unicode.IsUpper) >= 0 {
+		return false
+	}
+	lower := strings.ToLower(word)
+	if dictionary[lower] {
+		return false
+	}
+	for _, suffix := range []string{"'s", "’s"} {
+		if strings.HasSuffix(lower, suffix) && dictionary[strings.TrimSuffix(lower, suffix)] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSpelling reports the words of prose which aren't in the dictionaries given with the dictionaries flag.
+func checkSpelling(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if dictionary == nil || r.inBody(l, literalDirectives...) || strings.HasPrefix(strings.TrimSpace(l.text), "..") {
+			continue
+		}
+		text := proseText(l.text)
+		if m := optionPattern.FindStringSubmatchIndex(text); m != nil {
+			text = strings.Repeat(" ", m[3]+1) + text[m[3]+1:]
+		}
+		for _, m := range wordPattern.FindAllStringIndex(text, -1) {
+			// Words joined to digits or identifiers are part of something other than prose,
+			// though each part of a hyphenated word is checked.
+			if m[0] > 0 && (isIdentifierJoin(text[m[0]-1]) && text[m[0]-1] != '-' || isDigit(text[m[0]-1])) ||
+				m[1] < len(text) && (isIdentifierJoin(text[m[1]]) && text[m[1]] != '-' && m[1]+1 < len(text) && isWordByte(text[m[1]+1]) ||
+					text[m[1]] == '_' || isDigit(text[m[1]])) {
+				continue
+			}
+			if word := text[m[0]:m[1]]; misspelled(word, dictionary) {
+				diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(text[:m[0]]) + 1, Rule: ruleSpelling,
+					Message: fmt.Sprintf("%q isn't in the dictionary.", word)}
+			}
+		}
+	}
+}
+
+// acronymPattern matches an acronym, optionally plural, such as "AIP" or "DIPs".
+var acronymPattern = regexp.MustCompile(`\b([A-Z][A-Z0-9]*[A-Z])s?\b`)
+
+// expandedAt reports whether the acronym at text[start:end] is expanded, either by being in
+// parentheses after its expansion, or being followed by its expansion in parentheses.
+func expandedAt(text string, start, end int) bool {
+	before := strings.TrimRight(text[:start], " ")
+	if strings.HasSuffix(before, "(") && strings.HasPrefix(text[end:], ")") &&
+		strings.TrimSpace(strings.TrimSuffix(before, "(")) != "" {
+		return true
+	}
+	after := strings.TrimLeft(text[end:], " ")
+	if strings.HasPrefix(after, "(") {
+		if i := strings.Index(after, ")"); i > 0 && len(strings.Fields(after[1:i])) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAcronyms ensures acronyms are expanded the first time they're used in the prose of a page,
+// unless they're given with the acronyms flag. Headings are skipped, since acronyms are often used
+// in a page's title before they're expanded in its text.
+func checkAcronyms(path string, lines <-chan line, diags chan<- diagnostic) {
+	known := splitList(*acronymsFlag)
+	seen := make(map[string]bool)
+	var r directiveReader
+	var pending *line
+	check := func(l line) {
+		for _, ro := range roles(l.text) {
+			if ro.name == "abbr" {
+				if m := acronymPattern.FindStringSubmatch(ro.text); m != nil {
+					seen[m[1]] = true
+				}
+			}
+		}
+		text := proseText(l.text)
+		for _, m := range acronymPattern.FindAllStringSubmatchIndex(text, -1) {
+			acronym := text[m[2]:m[3]]
+			if seen[acronym] || contains(known, acronym) {
+				continue
+			}
+			seen[acronym] = true
+			if !expandedAt(text, m[0], m[1]) {
+				diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(text[:m[0]]) + 1, Rule: ruleAcronym,
+					Message: fmt.Sprintf("Acronym %q isn't expanded the first time it's used.", acronym)}
+			}
+		}
+	}
+	for l := range lines {
+		r.next(l)
+		if pending != nil && !isAdornment(l.text) {
+			check(*pending)
+		}
+		pending = nil
+		if r.inBody(l, literalDirectives...) || strings.HasPrefix(strings.TrimSpace(l.text), "..") || isAdornment(l.text) {
+			continue
+		}
+		current := l
+		pending = &current
+	}
+	if pending != nil {
+		check(*pending)
+	}
+}
+
+// checkFigureCaptions ensures figure directives have a caption.
+func checkFigureCaptions(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	literal := make(map[int]bool)
+	report := func(closed []*directive) {
+		for _, d := range closed {
+			if d.name == "figure" && !literal[d.line] && len(d.content()) == 0 {
+				diags <- diagnostic{Line: d.line, Column: d.indent + 1, Rule: ruleFigureCaption,
+					Message: fmt.Sprintf("Figure %q doesn't have a caption.", d.arg)}
+			}
+		}
+	}
+	for l := range lines {
+		report(r.next(l))
+		if r.inBody(l, literalDirectives...) {
+			literal[l.num] = true
+		}
+	}
+	report(r.end())
+}
+
+// checkAltText ensures image and figure directives have alt text.
+func checkAltText(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	literal := make(map[int]bool)
+	report := func(closed []*directive) {
+		for _, d := range closed {
+			if d.name != "image" && d.name != "figure" || literal[d.line] {
+				continue
+			}
+			alt, ok := d.options["alt"]
+			if !ok {
+				diags <- diagnostic{Line: d.line, Column: d.indent + 1, Rule: ruleAltText,
+					Message: fmt.Sprintf("The %v %q doesn't have alt text.", d.name, d.arg)}
+			} else if alt == "" {
+				diags <- diagnostic{Line: d.line, Column: d.indent + 1, Rule: ruleAltText,
+					Message: fmt.Sprintf("The %v %q has empty alt text.", d.name, d.arg)}
+			}
+		}
+	}
+	for l := range lines {
+		report(r.next(l))
+		if r.inBody(l, literalDirectives...) {
+			literal[l.num] = true
+		}
+	}
+	report(r.end())
+}
+
+// checkScreenshotFigures ensures images from an images directory are shown with figure directives.
+func checkScreenshotFigures(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		m := directivePattern.FindStringSubmatch(l.text)
+		if m == nil || strings.ToLower(m[2]) != "image" {
+			continue
+		}
+		target := strings.TrimSpace(m[3])
+		if contains(strings.Split(target, "/"), "images") && !strings.Contains(target, "://") {
+			diags <- diagnostic{Line: l.num, Column: len(m[1]) + 1, Rule: ruleScreenshotFigure,
+				Message: fmt.Sprintf("Use a figure directive for the screenshot %q, not an image directive.", target)}
+		}
+	}
+}
+
+// checkVersions reports versions in prose matching the version-pattern flag.
+func checkVersions(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if versionPattern == nil || r.inBody(l, literalDirectives...) || strings.HasPrefix(strings.TrimSpace(l.text), "..") {
+			continue
+		}
+		text := proseText(l.text)
+		for _, m := range versionPattern.FindAllStringIndex(text, -1) {
+			diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(text[:m[0]]) + 1, Rule: ruleVersion,
+				Message: fmt.Sprintf("Version %q is hard-coded, use a substitution like |version| instead.", text[m[0]:m[1]])}
+		}
+	}
+}
+
+// checkHTTPS ensures external links use HTTPS, for the domains in the https-domains flag
+// other than those in the http-domains flag.
+func checkHTTPS(path string, lines <-chan line, diags chan<- diagnostic) {
+	required, allowed := splitList(*httpsDomainsFlag), splitList(*httpDomainsFlag)
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		for _, m := range findURLs(l.text) {
+			link := l.text[m[0]:m[1]]
+			u, err := url.Parse(link)
+			if err != nil || u.Scheme != "http" || !hostMatches(u.Hostname(), required) || hostMatches(u.Hostname(), allowed) {
+				continue
+			}
+			diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(l.text[:m[0]]) + 1, Rule: ruleHTTPS,
+				Message: fmt.Sprintf("Link %q should use HTTPS.", link)}
+		}
+	}
+}
+
+// checkDeniedDomains ensures external links don't point to the domains given with the denied-domains flag.
+func checkDeniedDomains(path string, lines <-chan line, diags chan<- diagnostic) {
+	denied := splitList(*deniedDomainsFlag)
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if len(denied) == 0 || r.inBody(l, literalDirectives...) {
+			continue
+		}
+		for _, m := range findURLs(l.text) {
+			link := l.text[m[0]:m[1]]
+			u, err := url.Parse(link)
+			if err != nil || !hostMatches(u.Hostname(), denied) {
+				continue
+			}
+			diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(l.text[:m[0]]) + 1, Rule: ruleDeniedDomain,
+				Message: fmt.Sprintf("Link %q points to %v, which is denied.", link, u.Hostname())}
+		}
+	}
+}
+
+// checkBareURLs ensures URLs in prose are written as named hyperlinks, like "`Text <url>`_", rather than bare.
+// URLs in explicit markup, such as hyperlink targets and directives, and in directive options are allowed.
+func checkBareURLs(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) || optionPattern.MatchString(l.text) {
+			continue
+		}
+		if text := strings.TrimSpace(l.text); strings.HasPrefix(text, "..") || strings.HasPrefix(text, "__ ") {
+			continue
+		}
+		for _, m := range findURLs(l.text) {
+			if m[0] > 0 && l.text[m[0]-1] == '<' && m[1] < len(l.text) && l.text[m[1]] == '>' {
+				continue
+			}
+			diags <- diagnostic{Line: l.num, Column: utf8.RuneCountInString(l.text[:m[0]]) + 1, Rule: ruleBareURL,
+				Message: fmt.Sprintf("Bare URL %q should be a named hyperlink, like \"`Text <%v>`_\".", l.text[m[0]:m[1]], l.text[m[0]:m[1]])}
+		}
+	}
+}
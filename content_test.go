@@ -0,0 +1,1320 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestConventionalAnchor(t *testing.T) {
+
+	testTable := []struct {
+		path     string
+		expected string
+	}{
+		{"/a/user-manual/transfer/import.rst", "user-transfer-import"},
+		{"/a/user-manual/transfer/index.rst", "user-transfer-index"},
+		{"/a/user-manual/index.rst", "user-index"},
+		{"/a/getting-started/overview/Intro.rst", "getting-started-overview-intro"},
+	}
+
+	for _, r := range testTable {
+		result := conventionalAnchor(r.path, "/a", "<manual>-<chapter>-<page>")
+		if result != r.expected {
+			t.Errorf("conventionalAnchor(%v, /a, <manual>-<chapter>-<page>) -> %v, not %v", r.path, result, r.expected)
+		}
+	}
+
+}
+
+func TestRetargetRefs(t *testing.T) {
+
+	renames := map[string]string{"old": "user-transfer-import", "older": "user-transfer-index"}
+	testTable := []struct {
+		text       string
+		expected   string
+		retargeted int
+	}{
+		{"See :ref:`old`.", "See :ref:`user-transfer-import`.", 1},
+		{"See :ref:`the import <Old>` and :ref:`older`.", "See :ref:`the import <user-transfer-import>` and :ref:`user-transfer-index`.", 2},
+		{"See :doc:`old` and :ref:`other`.", "See :doc:`old` and :ref:`other`.", 0},
+	}
+
+	for _, r := range testTable {
+		result, retargeted := retargetRefs(r.text, renames)
+		if result != r.expected || len(retargeted) != r.retargeted {
+			t.Errorf("retargetRefs(%q) -> %q changing %v, not %q changing %v", r.text, result, retargeted, r.expected, r.retargeted)
+		}
+	}
+
+}
+
+func TestFixAnchorNames(t *testing.T) {
+
+	defer func(convention string) { *anchorConventionFlag = convention }(*anchorConventionFlag)
+	*anchorConventionFlag = "<manual>-<chapter>-<page>"
+	idx := &index{root: "/a",
+		labels: []labelDef{
+			{name: "import", source: "/a/user-manual/transfer/import.rst", line: 1},
+			{name: "user-transfer-index", source: "/a/user-manual/transfer/index.rst", line: 1},
+			{name: "taken", source: "/a/user-manual/transfer/export.rst", line: 1},
+			{name: "user-transfer-export", source: "/a/user-manual/transfer/other.rst", line: 5},
+			{name: "section", source: "/a/user-manual/transfer/import.rst", line: 9},
+		},
+		roles: []roleUse{
+			{role: role{name: "ref", text: "Back to the top <import>"}, source: "/a/user-manual/transfer/import.rst", line: 13},
+			{role: role{name: "ref", text: "import"}, source: "/a/user-manual/transfer/index.rst", line: 7},
+			{role: role{name: "ref", text: "taken"}, source: "/a/user-manual/transfer/index.rst", line: 8},
+		},
+	}
+
+	fn, paths := fixAnchorNames(idx)
+	expectedPaths := []string{"/a/user-manual/transfer/import.rst", "/a/user-manual/transfer/index.rst"}
+	if fmt.Sprint(paths) != fmt.Sprint(expectedPaths) {
+		t.Fatalf("fixAnchorNames changes %v, not %v", paths, expectedPaths)
+	}
+
+	text := ".. _import:\n\nImport\n======\n\nSee :ref:`import`.\n\n.. code-block:: rst\n\n   :ref:`import`\n"
+	expected := ".. _user-transfer-import:\n\nImport\n======\n\nSee :ref:`user-transfer-import`.\n\n.. code-block:: rst\n\n   :ref:`import`\n"
+	result, fixes := runFix(fn, "/a/user-manual/transfer/import.rst", text)
+	if result != expected || len(fixes) != 2 || fixes[0].line != 1 || fixes[1].line != 6 {
+		t.Errorf("fixAnchorNames fixed %q with %v, not %q", result, fixes, expected)
+	}
+	text = "See :ref:`Import <import>` and :ref:`taken`.\n"
+	expected = "See :ref:`Import <user-transfer-import>` and :ref:`taken`.\n"
+	if result, fixes := runFix(fn, "/a/user-manual/transfer/index.rst", text); result != expected || len(fixes) != 1 {
+		t.Errorf("fixAnchorNames fixed %q with %v, not %q", result, fixes, expected)
+	}
+
+}
+
+func TestCheckPlaceholder(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected int
+	}{
+		{"", 1},
+		{"  \n\t\n", 1},
+		{".. _a:\n\n=====\nTitle\n=====\n\n:ref:`Back to the top <a>`\n", 1},
+		{".. _a:\n\nTitle\n=====\n\nSome text.\n\n:ref:`Back to the top <a>`\n", 0},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkPlaceholder, "/a/b/c.rst", r.text)
+		if len(found) != r.expected {
+			t.Errorf("checkPlaceholder(%q) -> %v, expected %v problems", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckHeadingUnderlines(t *testing.T) {
+
+	text := "========\n" +
+		"Title\n" +
+		"========\n" +
+		"\n" +
+		"Long section title\n" +
+		"------\n" +
+		"\n" +
+		"=====\n" +
+		"Other\n" +
+		"======\n" +
+		"\n" +
+		"Fine\n" +
+		"~~~~\n"
+
+	found := runContentCheck(checkHeadingUnderlines, "/a/b/c.rst", text)
+	if len(found) != 2 || found[0].Line != 6 || found[1].Line != 8 {
+		t.Errorf("checkHeadingUnderlines found %v, expected problems on lines 6 and 8", found)
+	}
+
+}
+
+func TestFixHeadingUnderlines(t *testing.T) {
+
+	text := "========\n" +
+		"Title\n" +
+		"========\n" +
+		"\n" +
+		"Long section title\n" +
+		"------\n" +
+		"\n" +
+		"=======\n" +
+		" Other\n" +
+		"=====\n" +
+		"\n" +
+		"Fine\n" +
+		"~~~~\n" +
+		"\n" +
+		".. code-block:: rst\n" +
+		"\n" +
+		"   Sample\n" +
+		"   ------\n"
+	expected := "=====\n" +
+		"Title\n" +
+		"=====\n" +
+		"\n" +
+		"Long section title\n" +
+		"------------------\n" +
+		"\n" +
+		"======\n" +
+		" Other\n" +
+		"======\n" +
+		"\n" +
+		"Fine\n" +
+		"~~~~\n" +
+		"\n" +
+		".. code-block:: rst\n" +
+		"\n" +
+		"   Sample\n" +
+		"   ------\n"
+
+	result, fixes := runFix(fixHeadingUnderlines, "/a/b/c.rst", text)
+	if result != expected || len(fixes) != 5 {
+		t.Errorf("fixHeadingUnderlines -> %q with fixes %v, not %q", result, fixes, expected)
+	}
+
+}
+
+func TestCheckHeadingHierarchy(t *testing.T) {
+
+	text := "Title\n" +
+		"=====\n" +
+		"\n" +
+		"Section\n" +
+		"-------\n" +
+		"\n" +
+		"Subsection\n" +
+		"~~~~~~~~~~\n" +
+		"\n" +
+		"Another title\n" +
+		"=============\n" +
+		"\n" +
+		"Skipped\n" +
+		"~~~~~~~\n"
+
+	found := runContentCheck(checkHeadingHierarchy, "/a/b/c.rst", text)
+	if len(found) != 1 || found[0].Line != 13 {
+		t.Errorf("checkHeadingHierarchy found %v, expected a problem on line 13", found)
+	}
+
+}
+
+func TestCheckAdornments(t *testing.T) {
+
+	defer func(adornments string) { *adornmentsFlag = adornments }(*adornmentsFlag)
+	text := "Title\n=====\n\nSection\n-------\n\nSubsection\n~~~~~~~~~~\n\n" +
+		"Deeper\n^^^^^^\n\nAnother section\n***************\n"
+
+	testTable := []struct {
+		adornments string
+		expected   []int
+	}{
+		{"=,-,~", []int{10, 13}},
+		{"=,-,~,^", []int{13}},
+		{"==,-,~,^", []int{1, 13}},
+		{"", nil},
+	}
+
+	for _, r := range testTable {
+		*adornmentsFlag = r.adornments
+		found := runContentCheck(checkAdornments, "/a/b/c.rst", text)
+		var result []int
+		for _, d := range found {
+			result = append(result, d.Line)
+		}
+		if fmt.Sprint(result) != fmt.Sprint(r.expected) {
+			t.Errorf("checkAdornments with %q found %v, expected problems on lines %v", r.adornments, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckTrailingWhitespace(t *testing.T) {
+
+	found := runContentCheck(checkTrailingWhitespace, "/a/b/c.rst", "Fine\nSpaces  \n\nTab\t\nEscaped\\ \n| \n")
+	if len(found) != 2 || found[0].Line != 2 || found[0].Column != 7 || found[1].Line != 4 {
+		t.Errorf("checkTrailingWhitespace found %v, expected problems on lines 2 and 4", found)
+	}
+
+}
+
+func TestTrimTrailingWhitespace(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected string
+	}{
+		{"Fine", "Fine"},
+		{"Spaces  ", "Spaces"},
+		{"Tab\t", "Tab"},
+		{"   ", ""},
+		{"Escaped\\   ", "Escaped\\ "},
+		{"Backslash\\\\  ", "Backslash\\\\"},
+		{"  |  ", "  | "},
+		{"| Line  ", "| Line"},
+	}
+
+	for _, r := range testTable {
+		result := trimTrailingWhitespace(r.text)
+		if result != r.expected {
+			t.Errorf("trimTrailingWhitespace(%q) -> %q, not %q", r.text, result, r.expected)
+		}
+	}
+
+}
+
+func TestFixTrailingWhitespace(t *testing.T) {
+
+	result, fixes := runFix(fixTrailingWhitespace, "/a/b/c.rst", "Fine\nSpaces  \r\n\t\nEscaped\\ \n")
+	if result != "Fine\nSpaces\r\n\nEscaped\\ \n" || len(fixes) != 2 || fixes[0].line != 2 || fixes[1].line != 3 {
+		t.Errorf("fixTrailingWhitespace -> %q with fixes %v, expected lines 2 and 3 fixed", result, fixes)
+	}
+
+}
+
+func TestCheckWhitespaceLines(t *testing.T) {
+
+	text := ".. note::\n" +
+		"\n" +
+		"   First paragraph.\n" +
+		"   \n" +
+		"\t\n" +
+		"   Second paragraph.\n" +
+		"  \n" +
+		"\n" +
+		"Text after the note.\n" +
+		"   \n" +
+		"More text.\n"
+	found := runContentCheck(checkWhitespaceLines, "/a/b/c.rst", text)
+	if len(found) != 2 || found[0].Line != 4 || found[1].Line != 5 {
+		t.Errorf("checkWhitespaceLines found %v, expected problems on lines 4 and 5", found)
+	}
+
+}
+
+func TestCheckBlankLines(t *testing.T) {
+
+	defer func(max int) { *maxBlankLinesFlag = max }(*maxBlankLinesFlag)
+	text := "One.\n\n\nTwo.\n\n\n\n\n\nThree.\n\n  \n\t\n"
+
+	testTable := []struct {
+		max      int
+		expected []int
+	}{
+		{2, []int{7, 13}},
+		{1, []int{3, 6, 12}},
+		{0, nil},
+	}
+
+	for _, r := range testTable {
+		*maxBlankLinesFlag = r.max
+		found := runContentCheck(checkBlankLines, "/a/b/c.rst", text)
+		var result []int
+		for _, d := range found {
+			result = append(result, d.Line)
+		}
+		if fmt.Sprint(result) != fmt.Sprint(r.expected) {
+			t.Errorf("checkBlankLines with %v allowed found %v, expected problems on lines %v", r.max, found, r.expected)
+		}
+	}
+
+}
+
+func TestFixBlankLines(t *testing.T) {
+
+	defer func(max int) { *maxBlankLinesFlag = max }(*maxBlankLinesFlag)
+	testTable := []struct {
+		max      int
+		text     string
+		expected string
+	}{
+		{2, "a\n\n\n\n\nb\n\n\nc\n", "a\n\n\nb\n\n\nc\n"},
+		{1, "a\n\n  \n\t\nb\n", "a\n\nb\n"},
+		{2, "a\n\nb\n", "a\n\nb\n"},
+		{0, "a\n\n\n\n\nb\n", "a\n\n\n\n\nb\n"},
+	}
+
+	for _, r := range testTable {
+		*maxBlankLinesFlag = r.max
+		result, fixes := runFix(fixBlankLines, "/a/b/c.rst", r.text)
+		if result != r.expected || (len(fixes) == 1) != (r.text != r.expected) {
+			t.Errorf("fixBlankLines(%q) with a maximum of %v -> %q with fixes %v, not %q", r.text, r.max, result, fixes, r.expected)
+		}
+	}
+
+}
+
+func TestCheckSplitMarkup(t *testing.T) {
+
+	text := "See :ref:`the transfer\n" +
+		"docs <transfer>` and *this* for ``more\n" +
+		"code``.\n" +
+		"\n" +
+		"Complete :ref:`links <a>`, **strong text** and `hyperlinks`_ are fine,\n" +
+		"as are *.txt files and 2 * 3.\n" +
+		"\n" +
+		"An `unclosed reference\n" +
+		"\n" +
+		"is ended by the paragraph, and so is **this\n" +
+		"\n" +
+		".. code-block:: rst\n" +
+		"\n" +
+		"   :ref:`split\n" +
+		"   text <x>`\n"
+	found := runContentCheck(checkSplitMarkup, "/a/b/c.rst", text)
+	if len(found) != 2 || found[0].Line != 1 || found[0].Column != 5 || found[1].Line != 2 || found[1].Column != 33 {
+		t.Errorf("checkSplitMarkup found %v, expected problems on lines 1 and 2", found)
+	}
+	if len(found) > 0 && found[0].Message != "Role is split across a line break." {
+		t.Errorf("checkSplitMarkup reported %q, expected the role to be reported", found[0].Message)
+	}
+
+}
+
+func TestCheckFloatingLabels(t *testing.T) {
+
+	text := ".. _page:\n" +
+		"\n" +
+		"Page\n" +
+		"====\n" +
+		"\n" +
+		".. _section:\n" +
+		".. _old-section:\n" +
+		"Section\n" +
+		"-------\n" +
+		"\n" +
+		".. _dashboard:\n" +
+		"\n" +
+		".. figure:: images/dashboard.png\n" +
+		"\n" +
+		".. _floating:\n" +
+		"\n" +
+		"A paragraph with a label.\n" +
+		"\n" +
+		".. _distant:\n" +
+		"\n" +
+		"\n" +
+		"Distant\n" +
+		"-------\n" +
+		"\n" +
+		".. code-block:: rst\n" +
+		"\n" +
+		"   .. _example:\n" +
+		"\n" +
+		"   Text.\n" +
+		"\n" +
+		".. _end:\n"
+	found := runContentCheck(checkFloatingLabels, "/a/b/c.rst", text)
+	if len(found) != 3 || found[0].Line != 15 || found[1].Line != 19 || found[2].Line != 31 {
+		t.Errorf("checkFloatingLabels found %v, expected problems on lines 15, 19 and 31", found)
+	}
+
+}
+
+func TestCheckTabs(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected string
+	}{
+		{"   Spaces", ""},
+		{"\tTabs", "Line is indented with tabs."},
+		{"  \tMixed", "Line is indented with a mix of tabs and spaces."},
+		{"a\tb", "Line contains a tab character."},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkTabs, "/a/b/c.rst", r.text)
+		if r.expected == "" && len(found) != 0 {
+			t.Errorf("checkTabs(%q) -> %v, expected no problems", r.text, found)
+		}
+		if r.expected != "" && (len(found) != 1 || found[0].Message != r.expected) {
+			t.Errorf("checkTabs(%q) -> %v, expected %q", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestExpandIndentation(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		width    int
+		expected string
+	}{
+		{"\tText", 8, "        Text"},
+		{"  \tText", 4, "    Text"},
+		{"\t\tText\tmore", 3, "      Text\tmore"},
+		{"Text", 4, "Text"},
+		{"\t", 2, "  "},
+	}
+
+	for _, r := range testTable {
+		result := expandIndentation(r.text, r.width)
+		if result != r.expected {
+			t.Errorf("expandIndentation(%q, %v) -> %q, not %q", r.text, r.width, result, r.expected)
+		}
+	}
+
+}
+
+func TestFixTabs(t *testing.T) {
+
+	defer func(width int) { *tabWidthFlag = width }(*tabWidthFlag)
+	*tabWidthFlag = 3
+	text := ".. note::\n" +
+		"\n" +
+		"\tIndented with a tab.\n" +
+		"\n" +
+		"A Makefile::\n" +
+		"\n" +
+		"\tbuild:\n" +
+		"\t\tmake html\n" +
+		"\n" +
+		".. code-block:: make\n" +
+		"\n" +
+		"   build:\n" +
+		"   \tmake html\n" +
+		"\n" +
+		"Text.\n" +
+		"\n" +
+		"\tA quote.\n"
+	expected := ".. note::\n" +
+		"\n" +
+		"   Indented with a tab.\n" +
+		"\n" +
+		"A Makefile::\n" +
+		"\n" +
+		"\tbuild:\n" +
+		"\t\tmake html\n" +
+		"\n" +
+		".. code-block:: make\n" +
+		"\n" +
+		"   build:\n" +
+		"   \tmake html\n" +
+		"\n" +
+		"Text.\n" +
+		"\n" +
+		"   A quote.\n"
+	result, fixes := runFix(fixTabs, "/a/b/c.rst", text)
+	if result != expected || len(fixes) != 2 || fixes[0].line != 3 || fixes[1].line != 17 {
+		t.Errorf("fixTabs -> %q with fixes %v, expected lines 3 and 17 fixed", result, fixes)
+	}
+
+}
+
+func TestCheckLineLength(t *testing.T) {
+
+	long := strings.Repeat("word ", 25)
+	text := "Short line.\n" +
+		long + "\n" +
+		"See https://www.archivematica.org/" + long + "\n" +
+		"| " + long + " |\n"
+
+	found := runContentCheck(checkLineLength, "/a/b/c.rst", text)
+	if len(found) != 1 || found[0].Line != 2 || found[0].Column != 101 {
+		t.Errorf("checkLineLength found %v, expected a problem on line 2", found)
+	}
+
+}
+
+func TestCheckFinalNewline(t *testing.T) {
+
+	testTable := []struct {
+		text         string
+		expectedLine int
+	}{
+		{"", 0},
+		{"Title\n=====\n", 0},
+		{"Title\r\n=====\r\n", 0},
+		{"Title\n=====", 2},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkFinalNewline, "/a/b/c.rst", r.text)
+		if r.expectedLine == 0 {
+			if len(found) != 0 {
+				t.Errorf("checkFinalNewline(%q) -> %v, expected no problems", r.text, found)
+			}
+			continue
+		}
+		if len(found) != 1 || found[0].Line != r.expectedLine {
+			t.Errorf("checkFinalNewline(%q) -> %v, expected one problem on line %v", r.text, found, r.expectedLine)
+		}
+	}
+
+}
+
+func TestFixFinalNewline(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected string
+		fixes    int
+	}{
+		{"Text.\n", "Text.\n", 0},
+		{"Text.", "Text.\n", 1},
+		{"Text.\n\n\n", "Text.\n", 1},
+		{"Text.\n\n  ", "Text.\n", 1},
+		{"Text.\r\n\r\n", "Text.\r\n", 1},
+		{"", "", 0},
+	}
+
+	for _, r := range testTable {
+		result, fixes := runFix(fixFinalNewline, "/a/b/c.rst", r.text)
+		if result != r.expected || len(fixes) != r.fixes {
+			t.Errorf("fixFinalNewline(%q) -> %q with fixes %v, not %q with %v", r.text, result, fixes, r.expected, r.fixes)
+		}
+	}
+
+}
+
+func TestCheckLineEndings(t *testing.T) {
+
+	defer func(endings string) { *lineEndingsFlag = endings }(*lineEndingsFlag)
+	testTable := []struct {
+		endings  string
+		text     string
+		expected string
+	}{
+		{"lf", "Title\n=====\n", ""},
+		{"lf", "Title\r\n=====\r\n", "File has Windows (CRLF) line endings."},
+		{"lf", "Title\n=====\r\n\nText", "File mixes Windows (CRLF) and Unix (LF) line endings, with 1 of 3 lines ending in CRLF."},
+		{"crlf", "Title\r\n=====\r\n", ""},
+		{"crlf", "Title\r\n=====\n", "File mixes Unix (LF) and Windows (CRLF) line endings, with 1 of 2 lines ending in LF."},
+	}
+
+	for _, r := range testTable {
+		*lineEndingsFlag = r.endings
+		found := runContentCheck(checkLineEndings, "/a/b/c.rst", r.text)
+		if r.expected == "" && len(found) != 0 {
+			t.Errorf("checkLineEndings(%q) -> %v, expected no problems", r.text, found)
+		}
+		if r.expected != "" && (len(found) != 1 || found[0].Message != r.expected) {
+			t.Errorf("checkLineEndings(%q) -> %v, expected %q", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestFixLineEndings(t *testing.T) {
+
+	defer func(endings string) { *lineEndingsFlag = endings }(*lineEndingsFlag)
+	testTable := []struct {
+		endings  string
+		text     string
+		expected string
+		fixLine  int
+	}{
+		{"lf", "Title\r\n=====\r\n\nText", "Title\n=====\n\nText", 1},
+		{"lf", "Title\n=====\r\n", "Title\n=====\n", 2},
+		{"lf", "Title\n=====\n", "Title\n=====\n", 0},
+		{"crlf", "Title\n=====\n", "Title\r\n=====\r\n", 1},
+	}
+
+	for _, r := range testTable {
+		*lineEndingsFlag = r.endings
+		result, fixes := runFix(fixLineEndings, "/a/b/c.rst", r.text)
+		if result != r.expected || (r.fixLine == 0) != (len(fixes) == 0) || (len(fixes) > 0 && fixes[0].line != r.fixLine) {
+			t.Errorf("fixLineEndings(%q) -> %q with fixes %v, not %q fixed from line %v", r.text, result, fixes, r.expected, r.fixLine)
+		}
+	}
+
+}
+
+func TestCheckEncoding(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected string
+	}{
+		{"Title\n=====\n", ""},
+		{"Café\n", ""},
+		{"\uFEFFTitle\n", "File starts with a UTF-8 byte-order mark."},
+		{"Title\nCaf\xe9\n\xff", "File isn't valid UTF-8, with byte 0xE9 at offset 9."},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkEncoding, "/a/b/c.rst", r.text)
+		if r.expected == "" && len(found) != 0 {
+			t.Errorf("checkEncoding(%q) -> %v, expected no problems", r.text, found)
+		}
+		if r.expected != "" && (len(found) != 1 || found[0].Message != r.expected) {
+			t.Errorf("checkEncoding(%q) -> %v, expected %q", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckSuspiciousCharacters(t *testing.T) {
+
+	testTable := []struct {
+		text           string
+		expectedColumn int
+	}{
+		{"\"Plain\" text's fine.", 0},
+		{"\uFEFFTitle", 0},
+		{"Non-breaking\u00A0space", 13},
+		{"Zero\u200Bwidth", 5},
+		{"Zero\u200Dwidth joiner, and It\u2019s curly", 5},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkSuspiciousCharacters, "/a/b/c.rst", r.text)
+		if r.expectedColumn == 0 {
+			if len(found) != 0 {
+				t.Errorf("checkSuspiciousCharacters(%q) -> %v, expected no problems", r.text, found)
+			}
+			continue
+		}
+		if len(found) != 1 || found[0].Column != r.expectedColumn {
+			t.Errorf("checkSuspiciousCharacters(%q) -> %v, expected one problem at column %v", r.text, found, r.expectedColumn)
+		}
+	}
+
+}
+
+func TestCheckCurlyQuotes(t *testing.T) {
+
+	text := "It\u2019s \u201Cquoted\u201D, and 5\u2032 tall.\n" +
+		"Run ``echo \u2018a\u2019``.\n" +
+		"\n" +
+		".. code-block:: bash\n" +
+		"\n" +
+		"   echo \u201Cb\u201D\n"
+	found := runContentCheck(checkCurlyQuotes, "/a/b/c.rst", text)
+	if len(found) != 8 || found[0].Column != 3 || found[3].Column != 21 || found[5].Column != 14 || found[7].Line != 6 {
+		t.Fatalf("checkCurlyQuotes found %v, expected 8 quotes", found)
+	}
+	messages := []string{
+		"Line contains a right single quotation mark (U+2019), use ' instead.",
+		"Line contains a left single quotation mark (U+2018) in an inline literal, use ' instead.",
+		"Line contains a left double quotation mark (U+201C) in a code block, use \" instead.",
+	}
+	for i, d := range []diagnostic{found[0], found[4], found[6]} {
+		if d.Message != messages[i] {
+			t.Errorf("checkCurlyQuotes reported %q, expected %q", d.Message, messages[i])
+		}
+	}
+
+}
+
+func TestCheckCodeLanguage(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected bool
+	}{
+		{".. code-block:: bash\n\n   ls\n", true},
+		{".. code-block:: Python\n", true},
+		{".. code:: none\n", true},
+		{".. code-block::\n\n   ls\n", false},
+		{"   .. sourcecode::\n", false},
+		{".. code-block:: pyhton\n", false},
+		{".. code-block:: rst\n\n   .. code-block::\n", true},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkCodeLanguage, "/a/b/c.rst", r.text)
+		if (len(found) == 0) != r.expected {
+			t.Errorf("checkCodeLanguage(%q) -> %v, expected valid: %v", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckDirectiveNames(t *testing.T) {
+
+	text := ".. note::\n\n   Text.\n\n.. code-blok:: bash\n\n   ls\n\n.. code-block:: rst\n\n   .. nnote::\n"
+	found := runContentCheck(checkDirectiveNames, "/a/b/c.rst", text)
+	if len(found) != 1 || found[0].Line != 5 || found[0].Message != `Unknown directive "code-blok", did you mean "code-block"?` {
+		t.Errorf("checkDirectiveNames found %v, expected a problem on line 5", found)
+	}
+
+}
+
+func TestCheckRoleNames(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected string
+	}{
+		{"See :ref:`a` and :doc:`b`.", ""},
+		{"Call :py:func:`f`.", ""},
+		{".. role:: red\n\nThis is :red:`red`.", ""},
+		{"See :refr:`a`.", `Unknown role "refr", did you mean "ref"?`},
+		{"This is :blue:`blue`.", `Unknown role "blue".`},
+		{".. code-block:: rst\n\n   See :refr:`a`.", ""},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkRoleNames, "/a/b/c.rst", r.text)
+		if r.expected == "" && len(found) != 0 {
+			t.Errorf("checkRoleNames(%q) -> %v, expected no problems", r.text, found)
+		}
+		if r.expected != "" && (len(found) != 1 || found[0].Message != r.expected) {
+			t.Errorf("checkRoleNames(%q) -> %v, expected %q", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckRawHTML(t *testing.T) {
+
+	defer func(allowed string) { repo, *rawHTMLFlag = &index{}, allowed }(*rawHTMLFlag)
+	repo = &index{root: "/a"}
+	text := ".. raw:: html\n" +
+		"\n" +
+		"   <iframe src=\"https://www.youtube.com/embed/a\"></iframe>\n" +
+		"\n" +
+		".. raw:: latex\n" +
+		"\n" +
+		"   \\newpage\n" +
+		"\n" +
+		"   .. raw:: latex html\n"
+
+	testTable := []struct {
+		path     string
+		expected []int
+	}{
+		{"/a/user-manual/transfer/transfer.rst", []int{1, 9}},
+		{"/a/user-manual/videos/embed.rst", nil},
+	}
+
+	*rawHTMLFlag = "user-manual/*/embed.rst"
+	for _, r := range testTable {
+		found := runContentCheck(checkRawHTML, r.path, text)
+		var result []int
+		for _, d := range found {
+			result = append(result, d.Line)
+		}
+		if fmt.Sprint(result) != fmt.Sprint(r.expected) {
+			t.Errorf("checkRawHTML(%v) found %v, expected problems on lines %v", r.path, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckDeprecated(t *testing.T) {
+
+	defer func(deprecated string) { *deprecatedFlag = deprecated }(*deprecatedFlag)
+	*deprecatedFlag = "highlightlang::=highlight::,figure:: :figwidth:,:samp:=:code:"
+	text := ".. highlightlang:: python\n" +
+		"\n" +
+		".. figure:: images/a.png\n" +
+		"   :figwidth: 50%\n" +
+		"   :alt: A\n" +
+		"\n" +
+		"   Use :samp:`ls {dir}`.\n" +
+		"\n" +
+		".. code-block:: rst\n" +
+		"\n" +
+		"   :samp:`example`\n" +
+		"\n" +
+		":figwidth: isn't an option here.\n"
+
+	found := runContentCheck(checkDeprecated, "/a/b/c.rst", text)
+	if len(found) != 3 || found[0].Line != 1 || found[1].Line != 4 || found[1].Column != 4 || found[2].Line != 7 {
+		t.Errorf("checkDeprecated found %v, expected problems on lines 1, 4 and 7", found)
+	}
+	if len(found) > 0 && found[0].Message != "Directive \"highlightlang\" is deprecated, use \"highlight::\" instead." {
+		t.Errorf("checkDeprecated reported %q, expected the migration hint", found[0].Message)
+	}
+
+}
+
+func TestCheckRefText(t *testing.T) {
+
+	defer func(convention string) { *refTextFlag = convention }(*refTextFlag)
+	text := "See :ref:`transfer-import` and :ref:`Ingest <ingest>`.\n" +
+		"Or :ref:` <storage>`, and :doc:`Home <index>`.\n" +
+		"\n" +
+		":ref:`Back to the top <a>`\n"
+
+	testTable := []struct {
+		convention string
+		expected   []int
+	}{
+		{"", []int{2}},
+		{"explicit", []int{1, 2}},
+		{"implicit", []int{1, 2}},
+	}
+
+	for _, r := range testTable {
+		*refTextFlag = r.convention
+		found := runContentCheck(checkRefText, "/a/b/c.rst", text)
+		var result []int
+		for _, d := range found {
+			result = append(result, d.Line)
+		}
+		if fmt.Sprint(result) != fmt.Sprint(r.expected) {
+			t.Errorf("checkRefText with %q found %v, expected problems on lines %v", r.convention, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckAdmonitions(t *testing.T) {
+
+	defer func(max int) { *maxAdmonitionsFlag = max }(*maxAdmonitionsFlag)
+	*maxAdmonitionsFlag = 2
+
+	testTable := []struct {
+		text     string
+		expected string
+	}{
+		{".. note::\n\n   Text.\n", ""},
+		{".. note:: Text.\n   More text.\n", ""},
+		{".. note::\n   :class: wide\n\n   Text.\n", ""},
+		{".. note::\n   Text.\n", "Admonition body doesn't follow a blank line."},
+		{".. note::\n   :class: wide\n   Text.\n", "Admonition body doesn't follow a blank line."},
+		{".. danger::\n\n   Text.\n", `Admonition "danger" isn't one of those allowed: note, warning, tip, important.`},
+		{".. tip:: A\n.. tip:: B\n.. tip:: C\n", "Page has more than 2 admonitions."},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkAdmonitions, "/a/b/c.rst", r.text)
+		if r.expected == "" && len(found) != 0 {
+			t.Errorf("checkAdmonitions(%q) -> %v, expected no problems", r.text, found)
+		}
+		if r.expected != "" && (len(found) != 1 || found[0].Message != r.expected) {
+			t.Errorf("checkAdmonitions(%q) -> %v, expected %q", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckUILabels(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected string
+	}{
+		{"Click :guilabel:`Save`.", ""},
+		{"This is **important** text.", ""},
+		{"Click the **Save** button.", "Use :guilabel:`Save` for elements of the user interface."},
+		{`Open the "Transfer" tab.`, "Use :guilabel:`Transfer` for elements of the user interface."},
+		{"Go to **Administration > General**.", "Use :menuselection:`Administration --> General` for paths through menus."},
+		{".. code-block:: bash\n\n   echo \"Save\" button\n", ""},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkUILabels, "/a/b/c.rst", r.text)
+		if r.expected == "" && len(found) != 0 {
+			t.Errorf("checkUILabels(%q) -> %v, expected no problems", r.text, found)
+		}
+		if r.expected != "" && (len(found) != 1 || found[0].Message != r.expected) {
+			t.Errorf("checkUILabels(%q) -> %v, expected %q", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckFootnotes(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected string
+	}{
+		{"Text [#f1]_ and [1]_.\n\n.. [#f1] A note.\n.. [1] Another.\n", ""},
+		{"Text [#]_ and [#]_.\n\n.. [#] A note.\n.. [#] Another.\n", ""},
+		{"Text [CIT2002]_.\n", ""},
+		{"Text ``[#f1]_``.\n", ""},
+		{"Text [#f1]_.\n", "Footnote reference [#f1]_ has no matching footnote."},
+		{"Text.\n\n.. [#f1] A note.\n", "Footnote [#f1] isn't referred to."},
+		{"Text [#]_ and [#]_.\n\n.. [#] A note.\n", "Page has 1 more [#]_ references than [#] footnotes."},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkFootnotes, "/a/b/c.rst", r.text)
+		if r.expected == "" && len(found) != 0 {
+			t.Errorf("checkFootnotes(%q) -> %v, expected no problems", r.text, found)
+		}
+		if r.expected != "" && (len(found) != 1 || found[0].Message != r.expected) {
+			t.Errorf("checkFootnotes(%q) -> %v, expected %q", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckTodos(t *testing.T) {
+
+	testTable := []struct {
+		text         string
+		expectedLine int
+	}{
+		{"The TODO list is empty.\n", 0},
+		{".. _todo:\n\nTitle\n=====\n", 0},
+		{".. TODO: finish this page.\n", 1},
+		{"..\n   Notes for editors.\n   FIXME: add a screenshot.\n\nText.\n", 3},
+		{".. todo::\n\n   Finish this page.\n", 1},
+		{".. code-block:: rst\n\n   .. TODO: example\n", 0},
+		{".. note::\n\n   Text.\n\nTODO\n", 0},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkTodos, "/a/b/c.rst", r.text)
+		if r.expectedLine == 0 {
+			if len(found) != 0 {
+				t.Errorf("checkTodos(%q) -> %v, expected no problems", r.text, found)
+			}
+			continue
+		}
+		if len(found) != 1 || found[0].Line != r.expectedLine {
+			t.Errorf("checkTodos(%q) -> %v, expected one problem on line %v", r.text, found, r.expectedLine)
+		}
+	}
+
+}
+
+func TestCheckDuplicateSections(t *testing.T) {
+
+	text := "Title\n=====\n\nUsage\n-----\n\nText.\n\nConfiguration\n-------------\n\nusage\n-----\n"
+	found := runContentCheck(checkDuplicateSections, "/a/b/c.rst", text)
+	if len(found) != 1 || found[0].Line != 12 || found[0].Message != `Section title "usage" is also used on line 4.` {
+		t.Errorf("checkDuplicateSections found %v, expected a problem on line 12", found)
+	}
+
+}
+
+func TestHeadingCaseProblem(t *testing.T) {
+
+	keep := []string{"Archivematica"}
+	testTable := []struct {
+		title    string
+		style    string
+		expected string
+	}{
+		{"Upload a DIP to AtoM", "sentence", ""},
+		{"Configure Archivematica storage", "sentence", ""},
+		{"Installing: Before you begin", "sentence", ""},
+		{"Using the ``mcp-server`` service", "sentence", ""},
+		{"Configure Storage", "sentence", "Storage"},
+		{"configure storage", "sentence", "configure"},
+		{"Upload a DIP to AtoM", "title", ""},
+		{"Upload a package to AtoM", "title", "package"},
+		{"Upload a DIP to the Server", "title", ""},
+		{"Upload a DIP to the server", "title", "server"},
+		{"What to Look For", "title", ""},
+		{"Where to look for", "title", "look"},
+	}
+
+	for _, r := range testTable {
+		word, _, _ := headingCaseProblem(r.title, r.style, keep)
+		if word != r.expected {
+			t.Errorf("headingCaseProblem(%q, %v) -> %q, not %q", r.title, r.style, word, r.expected)
+		}
+	}
+
+}
+
+func TestCheckTerms(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected []int
+	}{
+		{"Archivematica stores METS files.", nil},
+		{"Install archivematica and atom.", []int{9, 27}},
+		{"Run archivematica-storage-service or the archivematica_dashboard.", nil},
+		{"See https://www.archivematica.org/ or ``archivematica``.", nil},
+		{"See :ref:`archivematica <archivematica>`.", nil},
+		{"Write a Mets file.", []int{9}},
+		{".. _archivematica:", nil},
+		{".. code-block:: bash\n\n   sudo service archivematica restart\n", nil},
+		{"Use the Atomic option.", nil},
+	}
+
+	for _, r := range testTable {
+		var columns []int
+		for _, d := range runContentCheck(checkTerms, "/a/b/c.rst", r.text) {
+			columns = append(columns, d.Column)
+		}
+		if fmt.Sprint(columns) != fmt.Sprint(r.expected) {
+			t.Errorf("checkTerms(%q) found problems at columns %v, not %v", r.text, columns, r.expected)
+		}
+	}
+
+}
+
+func TestParseVocabulary(t *testing.T) {
+
+	entries := parseVocabulary("click on=click, simply ,e.g.=for example")
+	expected := []vocabularyEntry{{"click on", "click"}, {"simply", ""}, {"e.g.", "for example"}}
+	if fmt.Sprint(entries) != fmt.Sprint(expected) {
+		t.Errorf("parseVocabulary -> %v, not %v", entries, expected)
+	}
+
+}
+
+func TestCheckVocabulary(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected string
+	}{
+		{"Click the button.", ""},
+		{"Click on the button.", `Use "click" instead of "Click on".`},
+		{"Formats, e.g. TIFF.", `Use "for example" instead of "e.g.".`},
+		{"Click online help.", ""},
+		{"Run ``click on`` in the shell.", ""},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkVocabulary, "/a/b/c.rst", r.text)
+		if r.expected == "" && len(found) != 0 {
+			t.Errorf("checkVocabulary(%q) -> %v, expected no problems", r.text, found)
+		}
+		if r.expected != "" && (len(found) != 1 || found[0].Message != r.expected) {
+			t.Errorf("checkVocabulary(%q) -> %v, expected %q", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestLoadDictionary(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# Archivematica vocabulary\nArchivematica\nmicroservice\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	words, err := loadDictionary([]string{path})
+	if err != nil || len(words) != 2 || !words["archivematica"] || !words["microservice"] {
+		t.Errorf("loadDictionary -> %v, %v, expected archivematica and microservice", words, err)
+	}
+	if _, err := loadDictionary([]string{path + ".missing"}); err == nil {
+		t.Errorf("loadDictionary of a missing file succeeded")
+	}
+
+}
+
+func TestCheckSpelling(t *testing.T) {
+
+	defer func() { dictionary = nil }()
+	dictionary = map[string]bool{"the": true, "transfer": true, "is": true, "ready": true, "open": true, "source": true, "see": true, "in": true}
+
+	testTable := []struct {
+		text     string
+		expected []string
+	}{
+		{"The transfer is ready.", nil},
+		{"The transfr is raedy.", []string{"transfr", "raedy"}},
+		{"The transfer's open-source.", nil},
+		{"The open-sorce AIP is ready.", []string{"sorce"}},
+		{"The ``transfr`` is ready, see https://exmaple.org/transfr.", nil},
+		{"The transfer_id is ready in v1beta.", nil},
+		{".. code-block:: bash\n\n   mkdir transfr\n", nil},
+		{".. image:: images/transfr.png\n   :alt: The transfr\n", []string{"transfr"}},
+	}
+
+	for _, r := range testTable {
+		var words []string
+		for _, d := range runContentCheck(checkSpelling, "/a/b/c.rst", r.text) {
+			words = append(words, strings.Split(d.Message, `"`)[1])
+		}
+		if fmt.Sprint(words) != fmt.Sprint(r.expected) {
+			t.Errorf("checkSpelling(%q) found %v, not %v", r.text, words, r.expected)
+		}
+	}
+
+}
+
+func TestCheckAcronyms(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected []string
+	}{
+		{"Create an Archival Information Package (AIP). Store the AIP.", nil},
+		{"Create an AIP (Archival Information Package), then more AIPs.", nil},
+		{"Create an :abbr:`AIP (Archival Information Package)`. Store the AIP.", nil},
+		{"Store the AIP. Create an Archival Information Package (AIP).", []string{"AIP"}},
+		{"Upload the DIP\n==============\n\nUpload the Dissemination Information Package (DIP).", nil},
+		{"Download the PDF from the URL.", nil},
+		{"Run ``METS`` validation.\n\n.. code-block:: bash\n\n   echo SIP\n", nil},
+		{"Both SIPs and DIPs.", []string{"SIP", "DIP"}},
+	}
+
+	for _, r := range testTable {
+		var acronyms []string
+		for _, d := range runContentCheck(checkAcronyms, "/a/b/c.rst", r.text) {
+			acronyms = append(acronyms, strings.Split(d.Message, `"`)[1])
+		}
+		if fmt.Sprint(acronyms) != fmt.Sprint(r.expected) {
+			t.Errorf("checkAcronyms(%q) found %v, not %v", r.text, acronyms, r.expected)
+		}
+	}
+
+}
+
+func TestCheckFigureCaptions(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected bool
+	}{
+		{".. figure:: images/a.png\n   :alt: A screenshot\n\n   The dashboard.\n", true},
+		{".. figure:: images/a.png\n   :alt: A screenshot\n\nText.\n", false},
+		{".. figure:: images/a.png\n", false},
+		{".. code-block:: rst\n\n   .. figure:: images/a.png\n", true},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkFigureCaptions, "/a/b/c.rst", r.text)
+		if (len(found) == 0) != r.expected {
+			t.Errorf("checkFigureCaptions(%q) -> %v, expected valid: %v", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckAltText(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected string
+	}{
+		{".. image:: images/a.png\n   :alt: The dashboard\n", ""},
+		{".. figure:: images/a.png\n   :width: 50%\n\n   The dashboard.\n", `The figure "images/a.png" doesn't have alt text.`},
+		{".. image:: images/a.png\n   :alt:\n", `The image "images/a.png" has empty alt text.`},
+		{".. code-block:: rst\n\n   .. image:: images/a.png\n", ""},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkAltText, "/a/b/c.rst", r.text)
+		if r.expected == "" && len(found) != 0 {
+			t.Errorf("checkAltText(%q) -> %v, expected no problems", r.text, found)
+		}
+		if r.expected != "" && (len(found) != 1 || found[0].Message != r.expected) {
+			t.Errorf("checkAltText(%q) -> %v, expected %q", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckScreenshotFigures(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected bool
+	}{
+		{".. figure:: images/dashboard.png\n", true},
+		{".. image:: images/dashboard.png\n", false},
+		{".. image:: /user-manual/transfer/images/dashboard.png\n", false},
+		{".. image:: logo.png\n", true},
+		{".. |icon| image:: images/icon.png\n", true},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkScreenshotFigures, "/a/b/c.rst", r.text)
+		if (len(found) == 0) != r.expected {
+			t.Errorf("checkScreenshotFigures(%q) -> %v, expected valid: %v", r.text, found, r.expected)
+		}
+	}
+
+}
+
+func TestCheckVersions(t *testing.T) {
+
+	defer func() { versionPattern = nil }()
+	versionPattern = regexp.MustCompile(*versionPatternFlag)
+
+	testTable := []struct {
+		text     string
+		expected []string
+	}{
+		{"Archivematica |version| supports this.", nil},
+		{"Archivematica 1.13.2 and Storage Service 0.19 support this.", []string{"Archivematica 1.13.2", "Storage Service 0.19"}},
+		{"Python 3.6 is required.", nil},
+		{"Install ``archivematica 1.13``.\n\n.. code-block:: bash\n\n   Archivematica 1.13\n", nil},
+	}
+
+	for _, r := range testTable {
+		var versions []string
+		for _, d := range runContentCheck(checkVersions, "/a/b/c.rst", r.text) {
+			versions = append(versions, strings.Split(d.Message, `"`)[1])
+		}
+		if fmt.Sprint(versions) != fmt.Sprint(r.expected) {
+			t.Errorf("checkVersions(%q) found %v, not %v", r.text, versions, r.expected)
+		}
+	}
+
+}
+
+func TestCheckHTTPS(t *testing.T) {
+
+	text := "See https://www.archivematica.org and http://www.loc.gov/standards/mets/.\n" +
+		"Open http://localhost:8000 or http://example.com.\n" +
+		".. _wiki: http://wiki.archivematica.org/\n" +
+		"\n" +
+		".. code-block:: bash\n" +
+		"\n" +
+		"   curl http://www.loc.gov\n"
+	found := runContentCheck(checkHTTPS, "/a/b/c.rst", text)
+	if len(found) != 2 || found[0].Line != 1 || found[0].Column != 39 || found[1].Line != 3 {
+		t.Errorf("checkHTTPS found %v, expected problems on lines 1 and 3", found)
+	}
+
+	// Only the domains known to support HTTPS are checked, unless every domain is.
+	defer func(required string) { *httpsDomainsFlag = required }(*httpsDomainsFlag)
+	text = "Mirrored at http://mirror.example.net/archivematica/.\n"
+	if found := runContentCheck(checkHTTPS, "/a/b/c.rst", text); len(found) != 0 {
+		t.Errorf("checkHTTPS found %v for an unknown domain, expected no problems", found)
+	}
+	*httpsDomainsFlag = "*"
+	if found := runContentCheck(checkHTTPS, "/a/b/c.rst", text); len(found) != 1 {
+		t.Errorf("checkHTTPS found %v for every domain, expected a problem", found)
+	}
+
+}
+
+func TestCheckDeniedDomains(t *testing.T) {
+
+	defer func(denied string) { *deniedDomainsFlag = denied }(*deniedDomainsFlag)
+	text := "See https://wiki.archivematica.org/Main_Page and https://www.archivematica.org.\n" +
+		"Old pages at https://docs.wiki.archivematica.org/ are gone.\n" +
+		"\n" +
+		".. code-block:: bash\n" +
+		"\n" +
+		"   curl https://wiki.archivematica.org\n"
+
+	*deniedDomainsFlag = ""
+	if found := runContentCheck(checkDeniedDomains, "/a/b/c.rst", text); len(found) != 0 {
+		t.Errorf("checkDeniedDomains found %v without denied domains, expected no problems", found)
+	}
+
+	*deniedDomainsFlag = "wiki.archivematica.org"
+	found := runContentCheck(checkDeniedDomains, "/a/b/c.rst", text)
+	if len(found) != 2 || found[0].Line != 1 || found[0].Column != 5 || found[1].Line != 2 {
+		t.Errorf("checkDeniedDomains found %v, expected problems on lines 1 and 2", found)
+	}
+
+}
+
+func TestCheckBareURLs(t *testing.T) {
+
+	text := "See https://www.archivematica.org for more.\n" +
+		"Read the `METS standard <https://www.loc.gov/standards/mets/>`_ or the `wiki`_.\n" +
+		"\n" +
+		".. _wiki: https://wiki.archivematica.org/\n" +
+		"\n" +
+		".. image:: images/dashboard.png\n" +
+		"   :target: https://www.archivematica.org\n" +
+		"\n" +
+		"Run ``curl https://localhost``, or see (https://www.loc.gov).\n" +
+		"\n" +
+		".. code-block:: bash\n" +
+		"\n" +
+		"   curl https://www.loc.gov\n"
+	found := runContentCheck(checkBareURLs, "/a/b/c.rst", text)
+	if len(found) != 2 || found[0].Line != 1 || found[0].Column != 5 || found[1].Line != 9 || found[1].Column != 41 {
+		t.Errorf("checkBareURLs found %v, expected problems on lines 1 and 9", found)
+	}
+
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// An edit is a line of a diff, kept (' '), removed ('-') or added ('+'), with its line ending.
+type edit struct {
+	op   byte
+	text string
+}
+
+// maxDiffEdits limits the edits diffLines searches for a shortest diff, beyond which the lines
+// which differ are all replaced, since the search takes time proportional to the number of edits.
+const maxDiffEdits = 2000
+
+// diffLines returns the edits turning the lines a into b, with Myers' algorithm.
+func diffLines(a, b []string) []edit {
+	return appendEdits(nil, a, b, maxDiffEdits)
+}
+
+// appendEdits appends the fewest edits turning a into b to edits, replacing all of a with b if there are
+// more than limit. The lines a and b start and end with are kept, and the lines between them are split
+// at the middle of the shortest edits, found by middleSnake, so the search only takes memory linear
+// in the number of lines.
+func appendEdits(edits []edit, a, b []string, limit int) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for _, text := range a[:prefix] {
+		edits = append(edits, edit{' ', text})
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	kept := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	x, y, ok := 0, 0, false
+	if len(a) > 0 && len(b) > 0 {
+		x, y, ok = middleSnake(a, b, limit)
+	}
+	if ok {
+		edits = appendEdits(edits, a[:x], b[:y], limit)
+		edits = appendEdits(edits, a[x:], b[y:], limit)
+	} else {
+		for _, text := range a {
+			edits = append(edits, edit{'-', text})
+		}
+		for _, text := range b {
+			edits = append(edits, edit{'+', text})
+		}
+	}
+	for _, text := range kept {
+		edits = append(edits, edit{' ', text})
+	}
+	return edits
+}
+
+// middleSnake searches for the fewest edits turning a into b from both ends at once, until the searches
+// overlap, returning the point in a and b where the shortest edits can be split in two. It gives up,
+// returning false, once there are more than limit edits.
+func middleSnake(a, b []string, limit int) (int, int, bool) {
+	n, m := len(a), len(b)
+	maxD := minInt((n+m+1)/2, (limit+1)/2)
+	offset := maxD + 1
+	// The furthest x reached on each diagonal k = x - y, searching forward from the start of a and b,
+	// and backward from their ends, counting from the end.
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+	delta := n - m
+	// When delta is odd, the searches meet on a forward step, otherwise on a backward one.
+	odd := delta%2 != 0
+	// The diagonals at each end which have left a or b, and so aren't searched further.
+	forwardStart, forwardEnd, backwardStart, backwardEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + forwardStart; k <= d-forwardEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				forwardEnd += 2
+			case y > m:
+				forwardStart += 2
+			case odd:
+				i := offset + delta - k
+				if i >= 0 && i < len(backward) && backward[i] != -1 && x >= n-backward[i] {
+					return x, y, true
+				}
+			}
+		}
+		for k := -d + backwardStart; k <= d-backwardEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x, y = x+1, y+1
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				backwardEnd += 2
+			case y > m:
+				backwardStart += 2
+			case !odd:
+				i := offset + delta - k
+				if i >= 0 && i < len(forward) && forward[i] != -1 && forward[i] >= n-x {
+					return forward[i], forward[i] - (delta - k), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// A hunk is a run of edits, with the lines kept around them, starting on a line of the old and new file.
+type hunk struct {
+	oldStart, newStart int
+	edits              []edit
+}
+
+// lengths counts the lines of the old and new file in the hunk.
+func (h hunk) lengths() (int, int) {
+	old, new := 0, 0
+	for _, e := range h.edits {
+		if e.op != '+' {
+			old++
+		}
+		if e.op != '-' {
+			new++
+		}
+	}
+	return old, new
+}
+
+// changes reports whether the hunk changes the line of the old file numbered n, by removing or replacing it,
+// or by adding lines just before or after it.
+func (h hunk) changes(n int) bool {
+	old := h.oldStart
+	// Whether lines have been removed since the last kept line, so added lines replace them.
+	removed := false
+	for _, e := range h.edits {
+		switch e.op {
+		case ' ':
+			removed = false
+			old++
+		case '-':
+			if old == n {
+				return true
+			}
+			removed = true
+			old++
+		case '+':
+			if !removed && (old == n || old == n+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trim returns the hunk without the kept lines around its changes.
+func (h hunk) trim() hunk {
+	start, end := 0, len(h.edits)
+	for start < end && h.edits[start].op == ' ' {
+		start++
+	}
+	for end > start && h.edits[end-1].op == ' ' {
+		end--
+	}
+	return hunk{h.oldStart + start, h.newStart + start, h.edits[start:end]}
+}
+
+// diffContext is the number of lines kept around each change in a hunk.
+const diffContext = 3
+
+// makeHunks groups edits into hunks, with up to diffContext kept lines around each change.
+// Changes separated by fewer than twice as many kept lines share a hunk.
+func makeHunks(edits []edit) []hunk {
+	var hunks []hunk
+	oldLine, newLine := 1, 1
+	// The index and lines of the first edit of the hunk being made, and the index after its last change.
+	start, end := -1, 0
+	startOld, startNew := 0, 0
+	for i, e := range edits {
+		if e.op != ' ' {
+			if start < 0 || i-end > 2*diffContext {
+				if start >= 0 {
+					hunks = append(hunks, hunk{startOld, startNew, edits[start:minInt(end+diffContext, len(edits))]})
+				}
+				start = maxInt(i-diffContext, 0)
+				startOld, startNew = oldLine-(i-start), newLine-(i-start)
+			}
+			end = i + 1
+		}
+		if e.op != '+' {
+			oldLine++
+		}
+		if e.op != '-' {
+			newLine++
+		}
+	}
+	if start >= 0 {
+		hunks = append(hunks, hunk{startOld, startNew, edits[start:minInt(end+diffContext, len(edits))]})
+	}
+	return hunks
+}
+
+// minInt returns the smaller of a and b.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxInt returns the larger of a and b.
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// writeHunk writes h to w in the unified diff format.
+func writeHunk(w io.Writer, h hunk) {
+	old, new := h.lengths()
+	oldStart, newStart := h.oldStart, h.newStart
+	// Empty ranges start at the line before them.
+	if old == 0 {
+		oldStart--
+	}
+	if new == 0 {
+		newStart--
+	}
+	fmt.Fprintf(w, "@@ -%v,%v +%v,%v @@\n", oldStart, old, newStart, new)
+	for _, e := range h.edits {
+		fmt.Fprintf(w, "%c%v", e.op, e.text)
+		if !strings.HasSuffix(e.text, "\n") {
+			fmt.Fprint(w, "\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// applyHunks applies the hunks of a diff of the lines old which are accepted, returning the new content.
+func applyHunks(old []string, hunks []hunk, accepted []bool) []byte {
+	var b bytes.Buffer
+	next := 0
+	for i, h := range hunks {
+		for _, text := range old[next : h.oldStart-1] {
+			b.WriteString(text)
+		}
+		for _, e := range h.edits {
+			if (accepted[i] && e.op != '-') || (!accepted[i] && e.op != '+') {
+				b.WriteString(e.text)
+			}
+		}
+		length, _ := h.lengths()
+		next = h.oldStart - 1 + length
+	}
+	for _, text := range old[next:] {
+		b.WriteString(text)
+	}
+	return b.Bytes()
+}
+
+// diffText splits the content of a file into lines for diffLines, keeping their line endings,
+// so changes to line endings show in the diff.
+func diffText(data []byte) []string {
+	var lines []string
+	for _, l := range splitLines(data) {
+		lines = append(lines, l.text+l.eol)
+	}
+	return lines
+}
+
+// writeUnifiedDiff writes the changes from old to new content of the file name to w, in the unified diff format
+// understood by patch and git apply. Nothing is written if the contents are the same.
+func writeUnifiedDiff(w io.Writer, name string, old, new []byte) error {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "--- a/%v\n+++ b/%v\n", name, name)
+	for _, h := range makeHunks(diffLines(diffText(old), diffText(new))) {
+		writeHunk(&b, h)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
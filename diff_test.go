@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+
+	testTable := []struct {
+		a, b     string
+		expected string
+	}{
+		{"a b c", "a b c", "  a  b  c"},
+		{"a b c", "a c", "  a -b  c"},
+		{"a c", "a b c", "  a +b  c"},
+		{"a b c d", "a x c y", "  a -b +x  c -d +y"},
+		{"", "a b", " +a +b"},
+		{"a b", "", " -a -b"},
+		{"a b c a b b a", "c b a b a c", " -a +c  b -c  a  b -b  a +c"},
+	}
+
+	for _, r := range testTable {
+		var edits []string
+		for _, e := range diffLines(strings.Fields(r.a), strings.Fields(r.b)) {
+			edits = append(edits, string(e.op)+e.text)
+		}
+		result := " " + strings.Join(edits, " ")
+		if r.a == "" && r.b == "" {
+			result = ""
+		}
+		if result != r.expected {
+			t.Errorf("diffLines(%q, %q) -> %q, not %q", r.a, r.b, result, r.expected)
+		}
+	}
+
+}
+
+func TestDiffLinesShortest(t *testing.T) {
+
+	// The edits of every pair of short sequences of two lines are checked against the length
+	// of their longest common subsequence.
+	var sequences [][]string
+	for n := 0; n <= 6; n++ {
+		for bits := 0; bits < 1<<n; bits++ {
+			var s []string
+			for i := 0; i < n; i++ {
+				s = append(s, string(rune('a'+(bits>>i)&1)))
+			}
+			sequences = append(sequences, s)
+		}
+	}
+
+	for _, a := range sequences {
+		for _, b := range sequences {
+			var old, new []string
+			changes := 0
+			for _, e := range diffLines(a, b) {
+				if e.op != '+' {
+					old = append(old, e.text)
+				}
+				if e.op != '-' {
+					new = append(new, e.text)
+				}
+				if e.op != ' ' {
+					changes++
+				}
+			}
+			if strings.Join(old, "") != strings.Join(a, "") || strings.Join(new, "") != strings.Join(b, "") {
+				t.Errorf("diffLines(%v, %v) made edits from %v to %v", a, b, old, new)
+			}
+			if expected := len(a) + len(b) - 2*commonLength(a, b); changes != expected {
+				t.Errorf("diffLines(%v, %v) made %v changes, expected %v", a, b, changes, expected)
+			}
+		}
+	}
+
+}
+
+// commonLength returns the length of the longest common subsequence of a and b.
+func commonLength(a, b []string) int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = maxInt(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	return lengths[0][0]
+}
+
+func TestDiffLinesLimit(t *testing.T) {
+
+	var a, b []string
+	for i := 0; i < maxDiffEdits; i++ {
+		a = append(a, "a")
+		b = append(b, "b")
+	}
+	edits := diffLines(a, b)
+	if len(edits) != 2*maxDiffEdits || edits[0].op != '-' || edits[len(edits)-1].op != '+' {
+		t.Errorf("diffLines of %v changed lines made %v edits, expected every line replaced", maxDiffEdits, len(edits))
+	}
+
+}
+
+func TestWriteUnifiedDiff(t *testing.T) {
+
+	testTable := []struct {
+		old, new string
+		expected string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n",
+			"1\n2 \n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n15\n",
+			"--- a/b/c.rst\n+++ b/b/c.rst\n" +
+				"@@ -1,5 +1,5 @@\n 1\n-2\n+2 \n 3\n 4\n 5\n" +
+				"@@ -11,5 +11,4 @@\n 11\n 12\n 13\n-14\n 15\n"},
+		{"a\r\nb", "a\nb\n", "--- a/b/c.rst\n+++ b/b/c.rst\n@@ -1,2 +1,2 @@\n-a\r\n-b\n\\ No newline at end of file\n+a\n+b\n"},
+		{"", "a\n", "--- a/b/c.rst\n+++ b/b/c.rst\n@@ -0,0 +1,1 @@\n+a\n"},
+	}
+
+	for _, r := range testTable {
+		var b bytes.Buffer
+		if err := writeUnifiedDiff(&b, "b/c.rst", []byte(r.old), []byte(r.new)); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != r.expected {
+			t.Errorf("writeUnifiedDiff(%q, %q) -> %q, not %q", r.old, r.new, b.String(), r.expected)
+		}
+	}
+
+}
+
+func TestApplyHunks(t *testing.T) {
+
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	new := "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11 \n12\n"
+	testTable := []struct {
+		accepted []bool
+		expected string
+	}{
+		{[]bool{true, true}, new},
+		{[]bool{false, false}, old},
+		{[]bool{true, false}, "0\n" + old},
+		{[]bool{false, true}, "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11 \n12\n"},
+	}
+
+	hunks := makeHunks(diffLines(diffText([]byte(old)), diffText([]byte(new))))
+	if len(hunks) != 2 {
+		t.Fatalf("makeHunks made %v hunks, expected 2", len(hunks))
+	}
+	for _, r := range testTable {
+		result := string(applyHunks(diffText([]byte(old)), hunks, r.accepted))
+		if result != r.expected {
+			t.Errorf("applyHunks(%v) -> %q, not %q", r.accepted, result, r.expected)
+		}
+	}
+
+}
+
+func TestHunkChanges(t *testing.T) {
+
+	h := hunk{oldStart: 3, newStart: 3, edits: []edit{
+		{' ', "3\n"}, {'-', "4\n"}, {'+', "four\n"}, {' ', "5\n"}, {'+', "5.5\n"}, {' ', "6\n"},
+	}}
+	testTable := []struct {
+		line     int
+		expected bool
+	}{
+		{3, false},
+		{4, true},
+		{5, true},
+		{6, true},
+		{7, false},
+	}
+
+	for _, r := range testTable {
+		if changes := h.changes(r.line); changes != r.expected {
+			t.Errorf("hunk.changes(%v) -> %v, expected %v", r.line, changes, r.expected)
+		}
+	}
+
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A fix is a change made to a reST file to remedy a problem, on a line of the file as it was read.
+type fix struct {
+	line int
+	// The column of the problem fixed on the line, counting runes, when there can be several on one line.
+	column  int
+	rule    string
+	message string
+}
+
+// A fixer remedies the problems one of the rules finds in the content of reST files.
+type fixer interface {
+	// rule is the identifier of the rule whose problems are fixed.
+	rule() string
+	// fix returns the lines of the file at path with the rule's problems fixed, and the fixes made.
+	fix(path string, lines []line) ([]line, []fix)
+}
+
+// A ruleFixer is a fixer implemented by a function, like the content checks.
+type ruleFixer struct {
+	id string
+	fn func(path string, lines []line) ([]line, []fix)
+}
+
+func (f ruleFixer) rule() string { return f.id }
+
+func (f ruleFixer) fix(path string, lines []line) ([]line, []fix) { return f.fn(path, lines) }
+
+// The fixers run against the content of every reST file when the fix flag is given, in order.
+var fixers = []fixer{
+	ruleFixer{id: ruleAnchors, fn: fixAnchors},
+	ruleFixer{id: ruleAnchors, fn: fixBackToTop},
+	ruleFixer{id: ruleHeadingUnderline, fn: fixHeadingUnderlines},
+	ruleFixer{id: ruleTrailingWhitespace, fn: fixTrailingWhitespace},
+	ruleFixer{id: ruleLineEndings, fn: fixLineEndings},
+	ruleFixer{id: ruleTabs, fn: fixTabs},
+	ruleFixer{id: ruleBlankLines, fn: fixBlankLines},
+	ruleFixer{id: ruleFinalNewline, fn: fixFinalNewline},
+}
+
+// hasFixer reports whether one of the fixers remedies the problems of the rule.
+func hasFixer(rule string) bool {
+	for _, f := range fixers {
+		if f.rule() == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleFixes returns the changes the fixers of the rule make to data, the content of the file at path,
+// as hunks without the lines kept around them, so they can be suggested along with the problems they fix.
+func ruleFixes(path, rule string, data []byte) []hunk {
+	fixed := data
+	for _, f := range fixers {
+		if f.rule() == rule {
+			lines, _ := f.fix(path, splitLines(fixed))
+			fixed = joinLines(lines)
+		}
+	}
+	var hunks []hunk
+	for _, h := range makeHunks(diffLines(diffText(data), diffText(fixed))) {
+		hunks = append(hunks, h.trim())
+	}
+	return hunks
+}
+
+// joinLines joins lines back into the content of a file, with their line endings.
+func joinLines(lines []line) []byte {
+	var b bytes.Buffer
+	for _, l := range lines {
+		b.WriteString(l.text)
+		b.WriteString(l.eol)
+	}
+	return b.Bytes()
+}
+
+// fixContent runs the fixers of the enabled rules over data, the content of the file at path,
+// returning the fixed content and the fixes made.
+// Each fixer reads the lines as the fixer before it left them, numbered again, but the fixes are
+// moved back to the lines of data they were made on, so they match the problems reported.
+func fixContent(path string, data []byte) ([]byte, []fix) {
+	var fixes []fix
+	origins := newLineOrigins(len(splitLines(data)))
+	for _, f := range fixers {
+		if !ruleEnabled(f.rule()) {
+			continue
+		}
+		lines, made := f.fix(path, splitLines(data))
+		if len(made) == 0 {
+			continue
+		}
+		for i := range made {
+			made[i].rule = f.rule()
+			made[i].line = origins.of(made[i].line)
+		}
+		fixes = append(fixes, made...)
+		fixed := joinLines(lines)
+		// Fixers which keep the number of lines only change them in place, like converting line endings,
+		// which leaves every line where it was without diffing the whole file.
+		if len(lines) != len(origins) {
+			origins = origins.after(diffLines(diffText(data), diffText(fixed)))
+		}
+		data = fixed
+	}
+	return data, fixes
+}
+
+// lineOrigins are the numbers of the lines of a file as it was read, by the index of each line as the file is fixed.
+type lineOrigins []int
+
+// newLineOrigins returns the origins of the n lines of a file as it's read, which are their own numbers.
+func newLineOrigins(n int) lineOrigins {
+	origins := make(lineOrigins, n)
+	for i := range origins {
+		origins[i] = i + 1
+	}
+	return origins
+}
+
+// of returns the number in the file as it was read of the line numbered n now.
+// Lines after the last come from the last line.
+func (o lineOrigins) of(n int) int {
+	if n < 1 || len(o) == 0 {
+		return n
+	}
+	return o[minInt(n, len(o))-1]
+}
+
+// after returns the origins of the lines once the edits are made to them. An added line comes from
+// the first line it replaces, or if it replaces none, the line it's added before.
+func (o lineOrigins) after(edits []edit) lineOrigins {
+	var next lineOrigins
+	i, replaced := 0, 0
+	for _, e := range edits {
+		switch e.op {
+		case ' ':
+			next = append(next, o[i])
+			i++
+			replaced = 0
+		case '-':
+			if replaced == 0 {
+				replaced = o[i]
+			}
+			i++
+		case '+':
+			if replaced != 0 {
+				next = append(next, replaced)
+			} else {
+				next = append(next, o.of(i+1))
+			}
+		}
+	}
+	return next
+}
+
+// writeFileAtomic replaces the file at path with data, keeping its permissions.
+// The data is written to a temporary file next to it which is then renamed, so the file
+// is never left half written. The temporary file's name starts with ".", so it's never checked.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// fixFile fixes the problems in the file at path which the fixers can remedy, then saves the fixes with saveFixes.
+func fixFile(path, root string, preview *fixPreview, prompt *fixPrompt) ([]fix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fixed, fixes := fixContent(path, data)
+	return saveFixes(path, root, data, fixed, fixes, preview, prompt)
+}
+
+// saveFixes rewrites the file at path, changing its content from data to fixed if anything changed,
+// and returns the fixes made. If preview isn't nil, the file isn't rewritten, and the fixed content is
+// kept in the preview instead. If prompt isn't nil, each hunk of the diff of the fixes, with the file's path
+// relative to root, is only applied if accepted, and only the fixes on lines the accepted hunks change are returned.
+func saveFixes(path, root string, data, fixed []byte, fixes []fix, preview *fixPreview, prompt *fixPrompt) ([]fix, error) {
+	if bytes.Equal(fixed, data) {
+		return nil, nil
+	}
+	if preview != nil {
+		preview.add(path, data, fixed)
+		return fixes, nil
+	}
+	name := reportPath(path, root)
+	if prompt != nil {
+		fixOutput.Lock()
+		hunks := makeHunks(diffLines(diffText(data), diffText(fixed)))
+		accepted := make([]bool, len(hunks))
+		all := true
+		for i, h := range hunks {
+			accepted[i] = prompt.ask(name, h)
+			all = all && accepted[i]
+		}
+		fixOutput.Unlock()
+		fixed = applyHunks(diffText(data), hunks, accepted)
+		if !all {
+			fixes = acceptedFixes(fixes, hunks, accepted)
+		}
+		if bytes.Equal(fixed, data) {
+			return nil, nil
+		}
+	}
+	if err := writeFileAtomic(path, fixed); err != nil {
+		return nil, fmt.Errorf("Unable to write the fixes to %v. %v", path, err)
+	}
+	return fixes, nil
+}
+
+// acceptedFixes returns the fixes on the lines changed by the accepted hunks.
+func acceptedFixes(fixes []fix, hunks []hunk, accepted []bool) []fix {
+	var kept []fix
+	for _, f := range fixes {
+		for i, h := range hunks {
+			if accepted[i] && h.changes(f.line) {
+				kept = append(kept, f)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// A crossFixer remedies the problems of a rule which span files, once every file has been checked,
+// such as a label which can only be renamed along with the references to it.
+type crossFixer struct {
+	id string
+	// prepare returns the fixer for the content of the files needing fixes, and their paths.
+	prepare func(idx *index) (func(path string, lines []line) ([]line, []fix), []string)
+}
+
+// The fixers run once every file has been checked, when the fix flag is given, in order.
+var crossFixers = []crossFixer{
+	{id: ruleAnchorConvention, prepare: fixAnchorNames},
+	{id: ruleHTTPS, prepare: fixHTTPSLinks},
+}
+
+// A fixedProblem identifies the problem reported by a rule at a line and column of a file, so it can be left
+// out of the report once it's fixed.
+type fixedProblem struct {
+	path         string
+	line, column int
+	rule         string
+}
+
+// runCrossFixers runs the cross fixers of the enabled rules over the indexed repository, saving the fixes
+// with saveFixes and reporting them to stderr, and returns the problems fixed. Nothing is fixed when
+// preview isn't nil, since the fixes are only previewed, and made to the content of the files in the preview.
+func runCrossFixers(idx *index, preview *fixPreview, prompt *fixPrompt) map[fixedProblem]bool {
+	fixed := make(map[fixedProblem]bool)
+	for _, c := range crossFixers {
+		if !ruleEnabled(c.id) {
+			continue
+		}
+		fn, paths := c.prepare(idx)
+		for _, path := range paths {
+			var data []byte
+			var err error
+			if preview != nil {
+				data, err = preview.content(path)
+			} else {
+				data, err = os.ReadFile(path)
+			}
+			if err != nil {
+				log.Printf("Error: %v", err)
+				continue
+			}
+			lines, fixes := fn(path, splitLines(data))
+			for i := range fixes {
+				fixes[i].rule = c.id
+			}
+			fixes, err = saveFixes(path, idx.root, data, joinLines(lines), fixes, preview, prompt)
+			if err != nil {
+				log.Printf("Error: %v", err)
+				continue
+			}
+			if preview != nil {
+				continue
+			}
+			writeFixes(os.Stderr, path, idx.root, fixes)
+			for _, f := range fixes {
+				fixed[fixedProblem{path, f.line, f.column, f.rule}] = true
+			}
+		}
+	}
+	return fixed
+}
+
+// A fixPreview keeps the fixes to each file while they're previewed with the diff flag, rather than rewriting
+// the files, so the fixes made once every file has been checked are made to the fixed content, and each file
+// gets a single diff of all its fixes.
+type fixPreview struct {
+	mu sync.Mutex
+	// The content of each file fixed, as it was read, and as it's fixed.
+	original, fixed map[string][]byte
+}
+
+// newFixPreview returns a preview without any fixes.
+func newFixPreview() *fixPreview {
+	return &fixPreview{original: make(map[string][]byte), fixed: make(map[string][]byte)}
+}
+
+// add keeps the fixes to the file at path, which change its content from data to fixed.
+func (p *fixPreview) add(path string, data, fixed []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.original[path]; !ok {
+		p.original[path] = data
+	}
+	p.fixed[path] = fixed
+}
+
+// content returns the content of the file at path, with the fixes kept for it.
+func (p *fixPreview) content(path string) ([]byte, error) {
+	p.mu.Lock()
+	fixed, ok := p.fixed[path]
+	p.mu.Unlock()
+	if ok {
+		return fixed, nil
+	}
+	return os.ReadFile(path)
+}
+
+// write writes a unified diff of the fixes to each file to w, in the order of their paths, relative to root.
+func (p *fixPreview) write(w io.Writer, root string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var paths []string
+	for path := range p.fixed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := writeUnifiedDiff(w, reportPath(path, root), p.original[path], p.fixed[path]); err != nil {
+			return fmt.Errorf("Unable to write the diff of the fixes to %v. %v", path, err)
+		}
+	}
+	return nil
+}
+
+// A fixPrompt asks whether to apply each hunk of the fixes to a file, reading the answers from in.
+// Once all the remaining hunks are accepted, or the prompt is quit, it stops asking.
+type fixPrompt struct {
+	in  *bufio.Reader
+	out io.Writer
+	// Whether every remaining hunk is accepted, or rejected since the prompt was quit.
+	all, quit bool
+}
+
+// ask shows the hunk h of the fixes to the file name, and returns whether it's accepted.
+func (p *fixPrompt) ask(name string, h hunk) bool {
+	if p.all || p.quit {
+		return p.all
+	}
+	fmt.Fprintf(p.out, "--- a/%v\n+++ b/%v\n", name, name)
+	writeHunk(p.out, h)
+	for {
+		fmt.Fprint(p.out, "Apply this fix [y,n,a,q]? ")
+		answer, err := p.in.ReadString('\n')
+		if err != nil && answer == "" {
+			// Without any more answers, nothing else is applied.
+			fmt.Fprintln(p.out)
+			p.quit = true
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y":
+			return true
+		case "n":
+			return false
+		case "a":
+			p.all = true
+			return true
+		case "q":
+			p.quit = true
+			return false
+		}
+		fmt.Fprintln(p.out, "y - apply this fix, n - skip it, a - apply it and every fix after it, q - skip it and every fix after it")
+	}
+}
+
+// fixOutput serializes the reports and diffs of the fixes made, since files are fixed concurrently.
+var fixOutput sync.Mutex
+
+// writeFixes reports the fixes made to the file at path to w, one per line.
+func writeFixes(w io.Writer, path, root string, fixes []fix) {
+	fixOutput.Lock()
+	defer fixOutput.Unlock()
+	for _, f := range fixes {
+		fmt.Fprintf(w, "Fixed %v:%v: %v %v\n", relPath(path, root), f.line, f.rule, f.message)
+	}
+}
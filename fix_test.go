@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// upperFixer is a fixer for testing, which upper cases lines starting with "fix".
+var upperFixer = ruleFixer{id: ruleTrailingWhitespace, fn: func(path string, lines []line) ([]line, []fix) {
+	var fixes []fix
+	for i, l := range lines {
+		if strings.HasPrefix(l.text, "fix") {
+			lines[i].text = strings.ToUpper(l.text)
+			fixes = append(fixes, fix{line: l.num, message: "Upper cased the line."})
+		}
+	}
+	return lines, fixes
+}}
+
+// runFix runs a fixer's function over text, as if read from path, returning the fixed text and the fixes made.
+func runFix(fn func(path string, lines []line) ([]line, []fix), path, text string) (string, []fix) {
+	lines, fixes := fn(path, splitLines([]byte(text)))
+	return string(joinLines(lines)), fixes
+}
+
+func TestFixContent(t *testing.T) {
+
+	defer func(f []fixer) { fixers = f }(fixers)
+	fixers = []fixer{upperFixer}
+	testTable := []struct {
+		data     string
+		expected string
+		fixes    int
+	}{
+		{"a\nfix b\r\nc", "a\nFIX B\r\nc", 1},
+		{"a\nb\n", "a\nb\n", 0},
+		{"fix a\nfix b\n", "FIX A\nFIX B\n", 2},
+	}
+
+	for _, r := range testTable {
+		result, fixes := fixContent("/a/b/c.rst", []byte(r.data))
+		if string(result) != r.expected || len(fixes) != r.fixes {
+			t.Errorf("fixContent(%q) -> %q with %v fixes, not %q with %v", r.data, result, len(fixes), r.expected, r.fixes)
+		}
+		for _, f := range fixes {
+			if f.rule != ruleTrailingWhitespace {
+				t.Errorf("fixContent(%q) made fix %v, expected the rule of its fixer", r.data, f)
+			}
+		}
+	}
+
+	// Fixes are on the lines as read, even once an earlier fixer has added lines before them.
+	fixers = []fixer{ruleFixer{id: ruleAnchors, fn: fixAnchors}, upperFixer}
+	result, fixes := fixContent("/a/b/c.rst", []byte("Title\n=====\n\nfix a\n"))
+	if !strings.HasPrefix(string(result), ".. _") || len(fixes) != 2 || fixes[0].line != 1 || fixes[1].line != 4 {
+		t.Errorf("fixContent with an anchor inserted -> %q with fixes %v, expected fixes on lines 1 and 4", result, fixes)
+	}
+
+	fixers = []fixer{upperFixer}
+	defer func(disabled map[string]bool) { disabledRules = disabled }(disabledRules)
+	disabledRules = map[string]bool{ruleTrailingWhitespace: true}
+	if result, fixes := fixContent("/a/b/c.rst", []byte("fix a\n")); string(result) != "fix a\n" || len(fixes) != 0 {
+		t.Errorf("fixContent fixed %q with %v of a disabled rule, expected no fixes", result, fixes)
+	}
+
+}
+
+func TestFixFile(t *testing.T) {
+
+	defer func(f []fixer) { fixers = f }(fixers)
+	fixers = []fixer{upperFixer}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "page.rst")
+	if err := os.WriteFile(path, []byte("a\nfix b\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	preview := newFixPreview()
+	if fixes, err := fixFile(path, dir, preview, nil); err != nil || len(fixes) != 1 {
+		t.Errorf("fixFile with a preview -> %v, %v, expected one fix", fixes, err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "a\nfix b\n" {
+		t.Errorf("fixFile with a preview left %q, %v, expected the file unchanged", data, err)
+	}
+	// Later fixes to the previewed content go in the same diff.
+	if data, err := preview.content(path); err != nil || string(data) != "a\nFIX B\n" {
+		t.Errorf("The preview has the content %q, %v, expected the fixed content", data, err)
+	}
+	preview.add(path, []byte("a\nFIX B\n"), []byte("A\nFIX B\n"))
+	var diff bytes.Buffer
+	if err := preview.write(&diff, dir); err != nil {
+		t.Fatal(err)
+	}
+	expected := "--- a/page.rst\n+++ b/page.rst\n@@ -1,2 +1,2 @@\n-a\n-fix b\n+A\n+FIX B\n"
+	if diff.String() != expected {
+		t.Errorf("The preview wrote the diff %q, not %q", diff.String(), expected)
+	}
+
+	fixes, err := fixFile(path, dir, nil, nil)
+	if err != nil || len(fixes) != 1 || fixes[0].line != 2 {
+		t.Errorf("fixFile -> %v, %v, expected one fix on line 2", fixes, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "a\nFIX B\n" {
+		t.Errorf("fixFile wrote %q, %v, expected %q", data, err, "a\nFIX B\n")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("fixFile left the file with mode %v, %v, expected its permissions to be kept", info.Mode(), err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("fixFile left %v in the directory, %v, expected only the fixed file", entries, err)
+	}
+
+}
+
+func TestFixFileInteractive(t *testing.T) {
+
+	defer func(f []fixer) { fixers = f }(fixers)
+	fixers = []fixer{upperFixer}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "page.rst")
+	data := "fix a\n1\n2\n3\n4\n5\n6\n7\nfix b\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	p := &fixPrompt{in: bufio.NewReader(strings.NewReader("n\ny\n")), out: &out}
+	fixes, err := fixFile(path, dir, nil, p)
+	if err != nil || len(fixes) != 1 || fixes[0].line != 9 {
+		t.Errorf("fixFile with a prompt -> %v, %v, expected only the accepted fix on line 9", fixes, err)
+	}
+	expected := "fix a\n1\n2\n3\n4\n5\n6\n7\nFIX B\n"
+	if result, err := os.ReadFile(path); err != nil || string(result) != expected {
+		t.Errorf("fixFile with a prompt wrote %q, %v, not %q", result, err, expected)
+	}
+
+}
+
+func TestFixPrompt(t *testing.T) {
+
+	h := hunk{oldStart: 1, newStart: 1, edits: []edit{{'-', "a\n"}, {'+', "b\n"}}}
+	testTable := []struct {
+		answers  string
+		expected []bool
+	}{
+		{"y\nn\ny\n", []bool{true, false, true}},
+		{"n\na\n", []bool{false, true, true}},
+		{"y\nq\ny\n", []bool{true, false, false}},
+		{"maybe\nY\n", []bool{true, false, false}},
+		{"", []bool{false, false, false}},
+	}
+
+	for _, r := range testTable {
+		var out bytes.Buffer
+		p := &fixPrompt{in: bufio.NewReader(strings.NewReader(r.answers)), out: &out}
+		for i, expected := range r.expected {
+			if accepted := p.ask("b/c.rst", h); accepted != expected {
+				t.Errorf("fixPrompt answered %q accepted hunk %v: %v, expected %v", r.answers, i+1, accepted, expected)
+			}
+		}
+	}
+
+}
@@ -1 +1,3 @@
 module github.com/kevinbowrin/docmatica
+
+go 1.16
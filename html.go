@@ -0,0 +1,103 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+// htmlManual is a section of the HTML report, holding the files of one manual.
+type htmlManual struct {
+	Name     string
+	Files    []*htmlFile
+	Problems int
+}
+
+// htmlFile is a file with problems, listed in the HTML report.
+type htmlFile struct {
+	Path        string
+	Diagnostics []htmlDiagnostic
+}
+
+type htmlDiagnostic struct {
+	Line     int
+	Rule     string
+	RuleName string
+	RuleURL  string
+	Severity string
+	Message  string
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Docmatica report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h2 { border-bottom: 1px solid #ccc; }
+summary { cursor: pointer; font-family: monospace; font-size: 1.1em; }
+table { border-collapse: collapse; margin: 0.5em 0 1em 1.5em; }
+td, th { padding: 0.2em 0.8em; text-align: left; }
+.error { color: #b00; }
+.warning { color: #a60; }
+</style>
+</head>
+<body>
+<h1>Docmatica report</h1>
+<p>{{.Files}} files checked, {{.Problems}} problems found.</p>
+{{range .Manuals}}
+<h2>{{.Name}}</h2>
+<p>{{.Problems}} problems in {{len .Files}} files.</p>
+{{range .Files}}
+<details>
+<summary>{{.Path}} ({{len .Diagnostics}})</summary>
+<table>
+<tr><th>Line</th><th>Rule</th><th>Severity</th><th>Message</th></tr>
+{{range .Diagnostics}}<tr><td>{{if .Line}}{{.Line}}{{end}}</td><td><a href="{{.RuleURL}}" title="{{.RuleName}}">{{.Rule}}</a></td><td class="{{.Severity}}">{{.Severity}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>
+</details>
+{{end}}{{else}}
+<p>No problems found.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// writeHTML writes a self-contained HTML report, with a section per manual
+// holding a collapsible entry for each file with problems.
+func writeHTML(w io.Writer, r report) error {
+	var manuals []*htmlManual
+	for _, g := range groupByManual(r.diagnostics, r.root) {
+		m := &htmlManual{Name: g.name, Problems: len(g.diagnostics)}
+		files := make(map[string]*htmlFile)
+		for _, d := range g.diagnostics {
+			f, ok := files[d.Path]
+			if !ok {
+				f = &htmlFile{Path: reportPath(d.Path, r.root)}
+				files[d.Path] = f
+				m.Files = append(m.Files, f)
+			}
+			f.Diagnostics = append(f.Diagnostics, htmlDiagnostic{
+				Line:     d.Line,
+				Rule:     d.Rule,
+				RuleName: rules[d.Rule].name,
+				RuleURL:  ruleURL(d.Rule),
+				Severity: d.Severity().String(),
+				Message:  d.Message,
+			})
+		}
+		manuals = append(manuals, m)
+	}
+
+	return htmlTemplate.Execute(w, struct {
+		Files    int
+		Problems int
+		Manuals  []*htmlManual
+	}{len(r.files), len(r.diagnostics), manuals})
+}
+
+// ruleURL links to the documentation of a rule in the README.
+func ruleURL(id string) string {
+	return "https://github.com/kevinbowrin/docmatica#" + strings.ToLower(id)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTML(t *testing.T) {
+
+	r := report{
+		root:  "/a",
+		files: []string{"/a/user-manual/transfer/b.rst"},
+		diagnostics: []diagnostic{
+			{Path: "/a/user-manual/transfer/b.rst", Line: 1, Rule: ruleAnchors, Message: "Anchor <not> found."},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeHTML(&buf, r); err != nil {
+		t.Fatalf("writeHTML returned an error: %v", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"<h2>user-manual</h2>",
+		"<summary>user-manual/transfer/b.rst (1)</summary>",
+		`href="https://github.com/kevinbowrin/docmatica#dm003"`,
+		"Anchor &lt;not&gt; found.",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("writeHTML output does not contain %q", expected)
+		}
+	}
+
+}
@@ -0,0 +1,1148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// An index records facts about the whole repository as files are checked,
+// for the checks which can only run once every file has been seen.
+type index struct {
+	mu       sync.Mutex
+	root     string
+	files    []string
+	dirs     []string
+	toctrees []toctreeEntry
+	// The toctree directives, with their entries.
+	toctreeDefs []toctreeDef
+	roles       []roleUse
+	labels      []labelDef
+	images      []fileUse
+	includes    []fileUse
+	titles      []labelDef
+	// Substitution definitions, and references to them.
+	substitutions    []labelDef
+	substitutionRefs []nameRef
+	// Citations, and references to them.
+	citations    []labelDef
+	citationRefs []nameRef
+	// External URLs, which are only requested when checking links.
+	links []linkUse
+	// The directives used in reST files.
+	directives []nameRef
+	// The pages marked with the :orphan: field.
+	orphanMarkers []nameRef
+	// The terms defined in glossary directives.
+	glossaryTerms []labelDef
+}
+
+// A toctreeEntry is a document listed in a toctree directive.
+type toctreeEntry struct {
+	// The file containing the toctree.
+	source string
+	line   int
+	// The entry as written, without any title.
+	target string
+	// The file the entry refers to. For glob entries this is a pattern.
+	path string
+	glob bool
+}
+
+// A toctreeDef is a toctree directive in a reST file.
+type toctreeDef struct {
+	source string
+	line   int
+	// The maxdepth option, which is empty if it isn't given.
+	maxdepth string
+	hidden   bool
+	entries  []toctreeEntry
+}
+
+// A roleUse is a role found in a reST file.
+type roleUse struct {
+	role
+	source string
+	line   int
+}
+
+// A labelDef is a label defined in a reST file.
+// It's also used for the titles of pages.
+type labelDef struct {
+	name   string
+	source string
+	line   int
+}
+
+// A nameRef is a reference by name found in a reST file, such as the substitution reference "|version|",
+// or the citation reference "[CIT2002]_".
+type nameRef struct {
+	name   string
+	source string
+	line   int
+	column int
+}
+
+// A fileUse is a directive found in a reST file which refers to another file,
+// such as an image or an include.
+type fileUse struct {
+	directive string
+	source    string
+	line      int
+	// The file as written.
+	target string
+	// The file referred to, which for images may be a pattern such as "images/a.*".
+	path string
+	// The lines option of a literalinclude directive, such as "1,5-10".
+	lines string
+}
+
+// The index of the repository being checked.
+var repo = &index{}
+
+// A crossCheck looks across the indexed repository once every file has been checked,
+// sending any problems found to diags.
+type crossCheck func(idx *index, diags chan<- diagnostic)
+
+// The checks run once every file has been checked.
+var crossChecks = []crossCheck{
+	checkOrphans,
+	checkToctreeTargets,
+	checkDocReferences,
+	checkRefLabels,
+	checkDuplicateLabels,
+	checkUnusedImages,
+	checkImageTargets,
+	checkChapterIndexes,
+	checkDuplicateTitles,
+	checkImageRelativity,
+	checkIncludeTargets,
+	checkContents,
+	checkChaptersRegistered,
+	checkSubstitutions,
+	checkCitations,
+	checkLinks,
+	checkExtensions,
+	checkToctreeOptions,
+	checkOrphanMarkers,
+	checkCrossManual,
+	checkDownloads,
+	checkGlossaryTerms,
+}
+
+// addFile records a file found during the walk.
+func (idx *index) addFile(path string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.files = append(idx.files, path)
+}
+
+// addDir records a directory found during the walk.
+func (idx *index) addDir(path string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.dirs = append(idx.dirs, path)
+}
+
+// manuals returns the manual directories, which are the directories in the root of the repository.
+func (idx *index) manuals() []string {
+	var manuals []string
+	for _, d := range idx.dirs {
+		if d != idx.root && filepath.Dir(d) == idx.root {
+			manuals = append(manuals, d)
+		}
+	}
+	return manuals
+}
+
+// chapters returns the chapter directories, which are the directories inside each manual,
+// other than images directories.
+func (idx *index) chapters() []string {
+	var chapters []string
+	for _, d := range idx.dirs {
+		rel := relParts(d, idx.root)
+		if len(rel) == 2 && rel[1] != "images" {
+			chapters = append(chapters, d)
+		}
+	}
+	return chapters
+}
+
+// addToctreeEntry records an entry of a toctree.
+func (idx *index) addToctreeEntry(e toctreeEntry) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.toctrees = append(idx.toctrees, e)
+}
+
+// addToctreeDef records a toctree directive.
+func (idx *index) addToctreeDef(t toctreeDef) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.toctreeDefs = append(idx.toctreeDefs, t)
+}
+
+// indexToctrees records the entries of the toctrees in the file at path.
+func indexToctrees(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	record := func(closed []*directive) {
+		for _, d := range closed {
+			if d.name != "toctree" {
+				continue
+			}
+			_, glob := d.options["glob"]
+			_, hidden := d.options["hidden"]
+			def := toctreeDef{source: path, line: d.line, maxdepth: d.options["maxdepth"], hidden: hidden}
+			for _, l := range d.content() {
+				target := l.text
+				if m := explicitTargetPattern.FindStringSubmatch(target); m != nil {
+					target = strings.TrimSpace(m[2])
+				}
+				if target == "self" || strings.Contains(target, "://") {
+					continue
+				}
+				isGlob := glob && strings.ContainsAny(target, "*?[")
+				e := toctreeEntry{
+					source: path,
+					line:   l.num,
+					target: target,
+					path:   docPath(path, target, repo.root),
+					glob:   isGlob,
+				}
+				repo.addToctreeEntry(e)
+				def.entries = append(def.entries, e)
+			}
+			repo.addToctreeDef(def)
+		}
+	}
+	for l := range lines {
+		record(r.next(l))
+	}
+	record(r.end())
+}
+
+// addRoleUse records a role found in a reST file.
+func (idx *index) addRoleUse(u roleUse) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.roles = append(idx.roles, u)
+}
+
+// indexRoles records the roles used in the file at path, outside of literal directives.
+func indexRoles(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		for _, ro := range roles(l.text) {
+			repo.addRoleUse(roleUse{role: ro, source: path, line: l.num})
+		}
+	}
+}
+
+// addDirective records a directive used in a reST file.
+func (idx *index) addDirective(d nameRef) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.directives = append(idx.directives, d)
+}
+
+// indexDirectives records the directives used in the file at path, outside of literal directives.
+func indexDirectives(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if m := directivePattern.FindStringSubmatch(l.text); m != nil && !r.inBody(l, literalDirectives...) {
+			repo.addDirective(nameRef{name: strings.ToLower(m[2]), source: path, line: l.num, column: len(m[1]) + 4})
+		}
+	}
+}
+
+// addOrphanMarker records a page marked with the :orphan: field.
+func (idx *index) addOrphanMarker(m nameRef) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.orphanMarkers = append(idx.orphanMarkers, m)
+}
+
+// orphanMarkerPattern matches the :orphan: field, which marks a page as not needing to be in a toctree.
+var orphanMarkerPattern = regexp.MustCompile(`^:orphan:\s*$`)
+
+// indexOrphanMarkers records whether the file at path is marked with the :orphan: field, outside of literal directives.
+func indexOrphanMarkers(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if orphanMarkerPattern.MatchString(l.text) && !r.inBody(l, literalDirectives...) {
+			repo.addOrphanMarker(nameRef{name: "orphan", source: path, line: l.num, column: 1})
+		}
+	}
+}
+
+// addLabel records a label defined in a reST file.
+func (idx *index) addLabel(l labelDef) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.labels = append(idx.labels, l)
+}
+
+// indexLabels records the labels defined in the file at path, outside of literal directives.
+func indexLabels(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		if name, ok := label(l.text); ok {
+			repo.addLabel(labelDef{name: name, source: path, line: l.num})
+		}
+	}
+}
+
+// addImageUse records an image or figure found in a reST file.
+func (idx *index) addImageUse(u fileUse) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.images = append(idx.images, u)
+}
+
+// substitutionImagePattern matches an image given in a substitution definition,
+// such as ".. |logo| image:: images/logo.png".
+var substitutionImagePattern = regexp.MustCompile(`^\s*\.\.\s+\|[^|]+\|\s+image::\s+(\S+)`)
+
+// indexImages records the image and figure directives in the file at path.
+func indexImages(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		u := fileUse{source: path, line: l.num}
+		if m := directivePattern.FindStringSubmatch(l.text); m != nil &&
+			(strings.ToLower(m[2]) == "image" || strings.ToLower(m[2]) == "figure") {
+			u.directive, u.target = strings.ToLower(m[2]), strings.TrimSpace(m[3])
+		} else if m := substitutionImagePattern.FindStringSubmatch(l.text); m != nil {
+			u.directive, u.target = "image", m[1]
+		} else {
+			continue
+		}
+		if u.target == "" || strings.Contains(u.target, "://") {
+			continue
+		}
+		u.path = sourcePath(path, u.target, repo.root)
+		repo.addImageUse(u)
+	}
+}
+
+// addInclude records an include directive found in a reST file.
+func (idx *index) addInclude(u fileUse) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.includes = append(idx.includes, u)
+}
+
+// indexIncludes records the include and literalinclude directives in the file at path.
+// Includes of the standard docutils files, such as "<isonum.txt>", are skipped.
+func indexIncludes(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	// The lines literalinclude directives start on, which are recorded once their options are read.
+	literal := make(map[int]bool)
+	record := func(closed []*directive) {
+		for _, d := range closed {
+			if d.name == "literalinclude" && literal[d.line] {
+				repo.addInclude(fileUse{directive: d.name, source: path, line: d.line, target: d.arg,
+					path: sourcePath(path, d.arg, repo.root), lines: d.options["lines"]})
+			}
+		}
+	}
+	for l := range lines {
+		record(r.next(l))
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		m := directivePattern.FindStringSubmatch(l.text)
+		if m == nil {
+			continue
+		}
+		target := strings.TrimSpace(m[3])
+		if target == "" || strings.HasPrefix(target, "<") {
+			continue
+		}
+		switch strings.ToLower(m[2]) {
+		case "include":
+			repo.addInclude(fileUse{directive: "include", source: path, line: l.num, target: target,
+				path: sourcePath(path, target, repo.root)})
+		case "literalinclude":
+			literal[l.num] = true
+		}
+	}
+	record(r.end())
+}
+
+// addGlossaryTerm records a term defined in a glossary directive.
+func (idx *index) addGlossaryTerm(t labelDef) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.glossaryTerms = append(idx.glossaryTerms, t)
+}
+
+// glossaryTerms returns the terms defined in the body of a glossary directive, which are
+// the lines indented least, before their more indented definitions.
+func glossaryTerms(d *directive) []line {
+	indent := -1
+	for _, l := range d.body {
+		if strings.TrimSpace(l.text) != "" && (indent < 0 || indentation(l.text) < indent) {
+			indent = indentation(l.text)
+		}
+	}
+	var terms []line
+	for _, l := range d.body {
+		if strings.TrimSpace(l.text) != "" && indentation(l.text) == indent {
+			// Terms can be followed by a classifier for the index, as in "term : key".
+			term := strings.TrimSpace(l.text)
+			if i := strings.Index(term, " : "); i >= 0 {
+				term = strings.TrimSpace(term[:i])
+			}
+			terms = append(terms, line{num: l.num, text: term})
+		}
+	}
+	return terms
+}
+
+// indexGlossaries records the terms defined by the glossary directives in the file at path.
+func indexGlossaries(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	record := func(closed []*directive) {
+		for _, d := range closed {
+			if d.name != "glossary" {
+				continue
+			}
+			for _, t := range glossaryTerms(d) {
+				repo.addGlossaryTerm(labelDef{name: t.text, source: path, line: t.num})
+			}
+		}
+	}
+	for l := range lines {
+		record(r.next(l))
+	}
+	record(r.end())
+}
+
+// addSubstitution records a substitution definition found in a reST file.
+func (idx *index) addSubstitution(d labelDef) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.substitutions = append(idx.substitutions, d)
+}
+
+// addSubstitutionRef records a substitution reference found in a reST file.
+func (idx *index) addSubstitutionRef(r nameRef) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.substitutionRefs = append(idx.substitutionRefs, r)
+}
+
+// indexSubstitutions records the substitution definitions and references in the file at path,
+// outside of literal directives and inline literals.
+func indexSubstitutions(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		text := l.text
+		if m := substitutionDefinitionPattern.FindStringSubmatchIndex(text); m != nil {
+			repo.addSubstitution(labelDef{name: text[m[2]:m[3]], source: path, line: l.num})
+			text = strings.Repeat(" ", m[1]) + text[m[1]:]
+		}
+		for _, ref := range substitutionRefs(text) {
+			ref.source, ref.line = path, l.num
+			repo.addSubstitutionRef(ref)
+		}
+	}
+}
+
+// sourcePath resolves a file name, as used by directives, to a path.
+// Names starting with "/" are relative to root, others are relative to the source file.
+func sourcePath(source, name, root string) string {
+	if strings.HasPrefix(name, "/") {
+		return filepath.Join(root, filepath.FromSlash(name))
+	}
+	return filepath.Join(filepath.Dir(source), filepath.FromSlash(name))
+}
+
+// addTitle records the title of a page.
+func (idx *index) addTitle(t labelDef) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.titles = append(idx.titles, t)
+}
+
+// indexTitles records the title of the page at path, which is its first heading.
+func indexTitles(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	var hr headingReader
+	found := false
+	for l := range lines {
+		r.next(l)
+		if found || r.inBody(l, literalDirectives...) {
+			continue
+		}
+		if h := hr.next(l); h != nil {
+			repo.addTitle(labelDef{name: h.title, source: path, line: h.line})
+			found = true
+		}
+	}
+}
+
+// docPath resolves a document name, as used by toctrees, to the path of its reST file.
+func docPath(source, name, root string) string {
+	path := sourcePath(source, name, root)
+	if filepath.Ext(path) != ".rst" {
+		path += ".rst"
+	}
+	return path
+}
+
+// isRootDocument reports whether path is one of the documents at the top of the repository,
+// which have no toctree including them.
+func isRootDocument(path, root string) bool {
+	return filepath.Dir(path) == root &&
+		(filepath.Base(path) == "index.rst" || filepath.Base(path) == "contents.rst")
+}
+
+// exists reports whether there is a file at path, either found during the walk or on disk.
+func (idx *index) exists(path string) bool {
+	for _, f := range idx.files {
+		if f == path {
+			return true
+		}
+	}
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// included returns the set of files included by any toctree.
+func (idx *index) included() map[string]bool {
+	included := make(map[string]bool)
+	for _, e := range idx.toctrees {
+		if !e.glob {
+			included[e.path] = true
+			continue
+		}
+		for _, f := range idx.files {
+			if ok, _ := filepath.Match(e.path, f); ok {
+				included[f] = true
+			}
+		}
+	}
+	return included
+}
+
+// checkOrphans ensures every reST file is included in a toctree,
+// since pages which aren't are missing from the navigation of the built documentation.
+// Pages marked :orphan: are left to checkOrphanMarkers.
+func checkOrphans(idx *index, diags chan<- diagnostic) {
+	included := idx.included()
+	marked := make(map[string]bool)
+	for _, m := range idx.orphanMarkers {
+		marked[m.source] = true
+	}
+	for _, f := range idx.files {
+		if filepath.Ext(f) != ".rst" || isRootDocument(f, idx.root) || included[f] || marked[f] {
+			continue
+		}
+		diags <- diagnostic{Path: f, Rule: ruleOrphan, Message: "Not included in any toctree."}
+	}
+}
+
+// checkOrphanMarkers reports pages marked with the :orphan: field, which is usually a workaround for
+// a page missing from a toctree, and pages which are marked even though they're included in one.
+func checkOrphanMarkers(idx *index, diags chan<- diagnostic) {
+	included := idx.included()
+	for _, m := range idx.orphanMarkers {
+		message := "Page is marked :orphan: instead of being included in a toctree."
+		if included[m.source] {
+			message = "Page is marked :orphan:, but it's included in a toctree."
+		}
+		diags <- diagnostic{Path: m.source, Line: m.line, Column: m.column, Rule: ruleOrphanMarker, Message: message}
+	}
+}
+
+// checkToctreeTargets ensures every toctree entry refers to a document which exists,
+// and every glob entry matches at least one document.
+func checkToctreeTargets(idx *index, diags chan<- diagnostic) {
+	for _, e := range idx.toctrees {
+		if e.glob {
+			matched := false
+			for _, f := range idx.files {
+				if ok, _ := filepath.Match(e.path, f); ok {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				diags <- diagnostic{Path: e.source, Line: e.line, Column: 1, Rule: ruleToctreeTarget,
+					Message: fmt.Sprintf("Toctree glob %q doesn't match any documents.", e.target)}
+			}
+			continue
+		}
+		if !idx.exists(e.path) {
+			diags <- diagnostic{Path: e.source, Line: e.line, Column: 1, Rule: ruleToctreeTarget,
+				Message: fmt.Sprintf("Toctree entry %q refers to a document which doesn't exist.", e.target)}
+		}
+	}
+}
+
+// checkDocReferences ensures every :doc: role refers to a document which exists.
+func checkDocReferences(idx *index, diags chan<- diagnostic) {
+	for _, u := range idx.roles {
+		if u.name != "doc" {
+			continue
+		}
+		if !idx.exists(docPath(u.source, u.target(), idx.root)) {
+			diags <- diagnostic{Path: u.source, Line: u.line, Column: u.column, Rule: ruleDocReference,
+				Message: fmt.Sprintf("Document %q referenced by :doc: doesn't exist.", u.target())}
+		}
+	}
+}
+
+// checkDownloads ensures every :download: role refers to a file which exists.
+func checkDownloads(idx *index, diags chan<- diagnostic) {
+	for _, u := range idx.roles {
+		if u.name != "download" || strings.Contains(u.target(), "://") {
+			continue
+		}
+		if !idx.exists(sourcePath(u.source, u.target(), idx.root)) {
+			diags <- diagnostic{Path: u.source, Line: u.line, Column: u.column, Rule: ruleDownload,
+				Message: fmt.Sprintf("File %q referenced by :download: doesn't exist.", u.target())}
+		}
+	}
+}
+
+// The labels Sphinx defines itself, which :ref: roles can always refer to.
+var builtinLabels = []string{"genindex", "modindex", "py-modindex", "search"}
+
+// labelNames returns the set of labels defined, normalized as Sphinx does to lower case.
+func (idx *index) labelNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, l := range builtinLabels {
+		names[l] = true
+	}
+	for _, l := range idx.labels {
+		names[strings.ToLower(l.name)] = true
+	}
+	return names
+}
+
+// checkRefLabels ensures every :ref: role refers to a label defined somewhere in the repository.
+func checkRefLabels(idx *index, diags chan<- diagnostic) {
+	names := idx.labelNames()
+	for _, u := range idx.roles {
+		if u.name != "ref" {
+			continue
+		}
+		if !names[strings.ToLower(u.target())] {
+			diags <- diagnostic{Path: u.source, Line: u.line, Column: u.column, Rule: ruleRefLabel,
+				Message: fmt.Sprintf("Label %q referenced by :ref: isn't defined.", u.target())}
+		}
+	}
+}
+
+// checkDuplicateLabels ensures no label is defined more than once, since labels are
+// global in Sphinx and later definitions silently conflict with earlier ones.
+// Each definition is reported, listing where the others are.
+func checkDuplicateLabels(idx *index, diags chan<- diagnostic) {
+	byName := make(map[string][]labelDef)
+	for _, l := range idx.labels {
+		name := strings.ToLower(l.name)
+		byName[name] = append(byName[name], l)
+	}
+	for _, l := range idx.labels {
+		defs := byName[strings.ToLower(l.name)]
+		if len(defs) < 2 {
+			continue
+		}
+		var others []string
+		for _, o := range defs {
+			if o != l {
+				others = append(others, fmt.Sprintf("%v:%v", reportPath(o.source, idx.root), o.line))
+			}
+		}
+		diags <- diagnostic{Path: l.source, Line: l.line, Column: 1, Rule: ruleDuplicateLabel,
+			Message: fmt.Sprintf("Label %q is also defined at %v.", l.name, strings.Join(others, ", "))}
+	}
+}
+
+// isImage reports whether path is a file in an images directory.
+func isImage(path string) bool {
+	return parent(path) == "images"
+}
+
+// imageReferenced reports whether any image or figure refers to path.
+func (idx *index) imageReferenced(path string) bool {
+	for _, u := range idx.images {
+		if u.path == path {
+			return true
+		}
+		if ok, _ := filepath.Match(u.path, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnusedImages ensures every file in an images directory is used by an image or figure,
+// so screenshots which are no longer needed can be removed.
+func checkUnusedImages(idx *index, diags chan<- diagnostic) {
+	for _, f := range idx.files {
+		if isImage(f) && !idx.imageReferenced(f) {
+			diags <- diagnostic{Path: f, Rule: ruleUnusedImage, Message: "Image isn't used by any image or figure directive."}
+		}
+	}
+}
+
+// caseMatch looks for a file at path, ignoring case. It returns the path as found,
+// preferring an exact match, and whether any file was found.
+func (idx *index) caseMatch(path string) (string, bool) {
+	for _, f := range idx.files {
+		if f == path {
+			return f, true
+		}
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return "", false
+	}
+	found := ""
+	for _, e := range entries {
+		if e.Name() == filepath.Base(path) {
+			return path, true
+		}
+		if strings.EqualFold(e.Name(), filepath.Base(path)) {
+			found = filepath.Join(filepath.Dir(path), e.Name())
+		}
+	}
+	return found, found != ""
+}
+
+// checkImageTargets ensures every image and figure refers to a file which exists,
+// with the same case, since a mismatch only works on case insensitive file systems.
+func checkImageTargets(idx *index, diags chan<- diagnostic) {
+	for _, u := range idx.images {
+		if strings.Contains(u.path, "*") {
+			matched := false
+			for _, f := range idx.files {
+				if ok, _ := filepath.Match(u.path, f); ok {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				diags <- diagnostic{Path: u.source, Line: u.line, Column: 1, Rule: ruleImageTarget,
+					Message: fmt.Sprintf("Image %q doesn't match any files.", u.target)}
+			}
+			continue
+		}
+		found, ok := idx.caseMatch(u.path)
+		if !ok {
+			diags <- diagnostic{Path: u.source, Line: u.line, Column: 1, Rule: ruleImageTarget,
+				Message: fmt.Sprintf("Image %q doesn't exist.", u.target)}
+		} else if found != u.path {
+			diags <- diagnostic{Path: u.source, Line: u.line, Column: 1, Rule: ruleImageTarget,
+				Message: fmt.Sprintf("Image %q doesn't match the case of the file %q.", u.target, filepath.Base(found))}
+		}
+	}
+}
+
+// checkChapterIndexes ensures every chapter directory has an index.rst,
+// which the manual's toctree includes the chapter by.
+func checkChapterIndexes(idx *index, diags chan<- diagnostic) {
+	for _, c := range idx.chapters() {
+		if !idx.exists(filepath.Join(c, "index.rst")) {
+			diags <- diagnostic{Path: c, Rule: ruleChapterIndex, Message: "Chapter directory doesn't contain an index.rst file."}
+		}
+	}
+}
+
+// checkDuplicateTitles ensures no two pages in the same manual have the same title,
+// which makes search results and toctrees confusing.
+func checkDuplicateTitles(idx *index, diags chan<- diagnostic) {
+	key := func(t labelDef) string {
+		return manual(t.source, idx.root) + "\x00" + strings.ToLower(t.name)
+	}
+	byKey := make(map[string][]labelDef)
+	for _, t := range idx.titles {
+		byKey[key(t)] = append(byKey[key(t)], t)
+	}
+	for _, t := range idx.titles {
+		pages := byKey[key(t)]
+		if len(pages) < 2 {
+			continue
+		}
+		var others []string
+		for _, o := range pages {
+			if o != t {
+				others = append(others, reportPath(o.source, idx.root))
+			}
+		}
+		diags <- diagnostic{Path: t.source, Line: t.line, Column: 1, Rule: ruleDuplicateTitle,
+			Message: fmt.Sprintf("Page title %q is also used by %v.", t.name, strings.Join(others, ", "))}
+	}
+}
+
+// chapter returns the chapter directory a path is in, or the empty string
+// when it isn't in one.
+func chapter(path, root string) string {
+	rel := relParts(path, root)
+	if len(rel) < 3 {
+		return ""
+	}
+	return filepath.Join(root, rel[0], rel[1])
+}
+
+// checkImageRelativity ensures pages only use images from their own chapter,
+// so each chapter bundles the images it needs.
+func checkImageRelativity(idx *index, diags chan<- diagnostic) {
+	for _, u := range idx.images {
+		c := chapter(u.source, idx.root)
+		if c == "" || chapter(u.path, idx.root) == c {
+			continue
+		}
+		diags <- diagnostic{Path: u.source, Line: u.line, Column: 1, Rule: ruleImageRelativity,
+			Message: fmt.Sprintf("Image %q is outside the page's chapter.", u.target)}
+	}
+}
+
+// checkIncludeTargets ensures every include directive refers to a file which exists,
+// since some Sphinx configurations skip missing includes silently.
+func checkIncludeTargets(idx *index, diags chan<- diagnostic) {
+	for _, u := range idx.includes {
+		if !idx.exists(u.path) {
+			diags <- diagnostic{Path: u.source, Line: u.line, Column: 1, Rule: ruleIncludeTarget,
+				Message: fmt.Sprintf("Included file %q doesn't exist.", u.target)}
+			continue
+		}
+		if u.lines == "" {
+			continue
+		}
+		ranges, err := parseLineRanges(u.lines)
+		if err != nil {
+			diags <- diagnostic{Path: u.source, Line: u.line, Column: 1, Rule: ruleIncludeTarget,
+				Message: fmt.Sprintf("Unable to parse the lines option %q. %v", u.lines, err)}
+			continue
+		}
+		data, err := os.ReadFile(u.path)
+		if err != nil {
+			continue
+		}
+		length := len(splitLines(data))
+		for _, r := range ranges {
+			if r[0] > length || r[1] > length {
+				diags <- diagnostic{Path: u.source, Line: u.line, Column: 1, Rule: ruleIncludeTarget,
+					Message: fmt.Sprintf("The lines option %q is past the end of %q, which has %v lines.", u.lines, u.target, length)}
+				break
+			}
+		}
+	}
+}
+
+// checkContents ensures the toctree of the top level contents.rst includes the index of every manual,
+// and that every entry in it is the index of a manual which exists.
+func checkContents(idx *index, diags chan<- diagnostic) {
+	contents := filepath.Join(idx.root, "contents.rst")
+	if !idx.exists(contents) {
+		return
+	}
+	manuals := make(map[string]bool)
+	for _, m := range idx.manuals() {
+		manuals[m] = true
+	}
+
+	listed := make(map[string]bool)
+	for _, e := range idx.toctrees {
+		if e.source != contents || e.glob {
+			continue
+		}
+		m := filepath.Join(idx.root, relParts(e.path, idx.root)[0])
+		if len(relParts(e.path, idx.root)) != 2 || !manuals[m] || filepath.Base(e.path) != "index.rst" {
+			diags <- diagnostic{Path: contents, Line: e.line, Column: 1, Rule: ruleContents,
+				Message: fmt.Sprintf("Toctree entry %q isn't the index of a manual.", e.target)}
+			continue
+		}
+		listed[m] = true
+	}
+	for _, m := range idx.manuals() {
+		if !listed[m] {
+			diags <- diagnostic{Path: contents, Rule: ruleContents,
+				Message: fmt.Sprintf("Manual %q isn't included in the toctree.", filepath.Base(m))}
+		}
+	}
+}
+
+// checkChaptersRegistered ensures every chapter is reachable from the toctree of its manual's index.rst,
+// by an entry for its index or another of its documents.
+func checkChaptersRegistered(idx *index, diags chan<- diagnostic) {
+	for _, c := range idx.chapters() {
+		manualIndex := filepath.Join(filepath.Dir(c), "index.rst")
+		if !idx.exists(manualIndex) {
+			continue
+		}
+		registered := false
+		for _, e := range idx.toctrees {
+			if e.source == manualIndex && filepath.Dir(e.path) == c {
+				registered = true
+				break
+			}
+		}
+		if !registered {
+			diags <- diagnostic{Path: c, Rule: ruleChapterRegistered,
+				Message: fmt.Sprintf("Chapter isn't included in the toctree of %v.", reportPath(manualIndex, idx.root))}
+		}
+	}
+}
+
+// builtinSubstitutions are the substitutions Sphinx defines for every page.
+var builtinSubstitutions = []string{"version", "release", "today"}
+
+// readConf returns the content of conf.py in the root of the repository, the Sphinx configuration.
+// It's read directly rather than found among the indexed files, since the walk ignores it in archivematica-docs.
+func (idx *index) readConf() ([]byte, error) {
+	return os.ReadFile(filepath.Join(idx.root, "conf.py"))
+}
+
+// checkSubstitutions ensures every substitution reference has a definition in its page, in a file the page
+// includes or is included by, or in the rst_prolog or rst_epilog of conf.py, since references without
+// definitions render literally.
+func checkSubstitutions(idx *index, diags chan<- diagnostic) {
+	global := make(map[string]bool)
+	for _, s := range builtinSubstitutions {
+		global[s] = true
+	}
+	if data, err := idx.readConf(); err == nil {
+		for _, m := range confSubstitutionPattern.FindAllStringSubmatch(string(data), -1) {
+			global[strings.ToLower(m[1])] = true
+		}
+	}
+
+	defined := make(map[string]map[string]bool)
+	for _, d := range idx.substitutions {
+		if defined[d.source] == nil {
+			defined[d.source] = make(map[string]bool)
+		}
+		defined[d.source][strings.ToLower(d.name)] = true
+	}
+	// The files sharing definitions with each file, following includes in both directions.
+	related := make(map[string][]string)
+	for _, u := range idx.includes {
+		if u.directive == "include" {
+			related[u.source] = append(related[u.source], u.path)
+			related[u.path] = append(related[u.path], u.source)
+		}
+	}
+	isDefined := func(source, name string) bool {
+		seen := map[string]bool{source: true}
+		queue := []string{source}
+		for len(queue) > 0 {
+			f := queue[0]
+			queue = queue[1:]
+			if defined[f][name] {
+				return true
+			}
+			for _, r := range related[f] {
+				if !seen[r] {
+					seen[r] = true
+					queue = append(queue, r)
+				}
+			}
+		}
+		return false
+	}
+
+	for _, r := range idx.substitutionRefs {
+		name := strings.ToLower(r.name)
+		if global[name] || isDefined(r.source, name) {
+			continue
+		}
+		diags <- diagnostic{Path: r.source, Line: r.line, Column: r.column, Rule: ruleSubstitution,
+			Message: fmt.Sprintf("Substitution |%v| isn't defined.", r.name)}
+	}
+}
+
+// addCitation records a citation found in a reST file.
+func (idx *index) addCitation(d labelDef) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.citations = append(idx.citations, d)
+}
+
+// addCitationRef records a citation reference found in a reST file.
+func (idx *index) addCitationRef(r nameRef) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.citationRefs = append(idx.citationRefs, r)
+}
+
+// indexCitations records the citations and citation references in the file at path, outside of literal directives.
+func indexCitations(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		text := l.text
+		if m := footnotePattern.FindStringSubmatchIndex(text); m != nil {
+			if isCitation(text[m[2]:m[3]]) {
+				repo.addCitation(labelDef{name: text[m[2]:m[3]], source: path, line: l.num})
+			}
+			text = strings.Repeat(" ", m[1]) + text[m[1]:]
+		}
+		for _, ref := range footnoteRefs(text) {
+			if isCitation(ref.name) {
+				ref.source, ref.line = path, l.num
+				repo.addCitationRef(ref)
+			}
+		}
+	}
+}
+
+// checkCitations ensures every citation reference matches a citation defined in the repository.
+// Citation labels are matched ignoring case, as docutils normalizes them.
+func checkCitations(idx *index, diags chan<- diagnostic) {
+	defined := make(map[string]bool)
+	for _, c := range idx.citations {
+		defined[strings.ToLower(c.name)] = true
+	}
+	for _, r := range idx.citationRefs {
+		if !defined[strings.ToLower(r.name)] {
+			diags <- diagnostic{Path: r.source, Line: r.line, Column: r.column, Rule: ruleFootnote,
+				Message: fmt.Sprintf("Citation reference [%v]_ has no matching citation.", r.name)}
+		}
+	}
+}
+
+// checkExtensions ensures the directives and roles provided by Sphinx extensions are only used when the
+// extension is enabled, by the extensions flag, or in conf.py. If neither gives the enabled extensions,
+// nothing is checked.
+func checkExtensions(idx *index, diags chan<- diagnostic) {
+	enabled := splitList(*extensionsFlag)
+	if len(enabled) == 0 {
+		data, err := idx.readConf()
+		if err != nil {
+			return
+		}
+		enabled = confExtensions(string(data))
+	}
+
+	for _, d := range idx.directives {
+		if module, ok := providingExtension(d.name, false); ok && !contains(enabled, module) {
+			diags <- diagnostic{Path: d.source, Line: d.line, Column: d.column, Rule: ruleExtension,
+				Message: fmt.Sprintf("Directive %q needs the %v extension, which isn't enabled.", d.name, module)}
+		}
+	}
+	for _, u := range idx.roles {
+		if module, ok := providingExtension(u.name, true); ok && !contains(enabled, module) {
+			diags <- diagnostic{Path: u.source, Line: u.line, Column: u.column, Rule: ruleExtension,
+				Message: fmt.Sprintf("Role %q needs the %v extension, which isn't enabled.", u.name, module)}
+		}
+	}
+}
+
+// checkToctreeOptions ensures visible toctrees have the maxdepth given with the toctree-maxdepth flag,
+// or the most common one if it isn't given, toctrees in the pages given with the toctree-hidden flag
+// are hidden, and no toctree lists a document twice.
+func checkToctreeOptions(idx *index, diags chan<- diagnostic) {
+	defs := append([]toctreeDef{}, idx.toctreeDefs...)
+	sort.Slice(defs, func(i, j int) bool {
+		if defs[i].source != defs[j].source {
+			return defs[i].source < defs[j].source
+		}
+		return defs[i].line < defs[j].line
+	})
+
+	expected := ""
+	if *toctreeMaxdepthFlag > 0 {
+		expected = strconv.Itoa(*toctreeMaxdepthFlag)
+	} else {
+		counts := make(map[string]int)
+		most := 0
+		for _, t := range defs {
+			if t.hidden {
+				continue
+			}
+			counts[t.maxdepth]++
+			if counts[t.maxdepth] > most {
+				most, expected = counts[t.maxdepth], t.maxdepth
+			}
+		}
+	}
+
+	for _, t := range defs {
+		switch {
+		case t.hidden || expected == "" || t.maxdepth == expected:
+		case t.maxdepth == "":
+			diags <- diagnostic{Path: t.source, Line: t.line, Column: 1, Rule: ruleToctreeOptions,
+				Message: fmt.Sprintf("Toctree has no :maxdepth:, but should have %v.", expected)}
+		default:
+			diags <- diagnostic{Path: t.source, Line: t.line, Column: 1, Rule: ruleToctreeOptions,
+				Message: fmt.Sprintf("Toctree has :maxdepth: %v, but should have %v.", t.maxdepth, expected)}
+		}
+
+		rel := strings.Join(relParts(t.source, idx.root), "/")
+		for _, pattern := range splitList(*toctreeHiddenFlag) {
+			if ok, _ := filepath.Match(pattern, rel); ok && !t.hidden {
+				diags <- diagnostic{Path: t.source, Line: t.line, Column: 1, Rule: ruleToctreeOptions,
+					Message: "Toctree should have the :hidden: option."}
+				break
+			}
+		}
+
+		listed := make(map[string]int)
+		for _, e := range t.entries {
+			if first, ok := listed[e.path]; ok {
+				diags <- diagnostic{Path: t.source, Line: e.line, Column: 1, Rule: ruleToctreeOptions,
+					Message: fmt.Sprintf("Toctree entry %q is already listed on line %v.", e.target, first)}
+				continue
+			}
+			listed[e.path] = e.line
+		}
+	}
+}
+
+// checkGlossaryTerms ensures every :term: role refers to a term defined in a glossary,
+// and every glossary term is referenced by a :term: role.
+func checkGlossaryTerms(idx *index, diags chan<- diagnostic) {
+	defined := make(map[string]bool)
+	for _, t := range idx.glossaryTerms {
+		defined[strings.ToLower(t.name)] = true
+	}
+	used := make(map[string]bool)
+	for _, u := range idx.roles {
+		if u.name != "term" {
+			continue
+		}
+		term := strings.ToLower(u.target())
+		used[term] = true
+		if !defined[term] {
+			diags <- diagnostic{Path: u.source, Line: u.line, Column: u.column, Rule: ruleGlossaryTerm,
+				Message: fmt.Sprintf("Term %q referenced by :term: isn't defined in a glossary.", u.target())}
+		}
+	}
+	for _, t := range idx.glossaryTerms {
+		if !used[strings.ToLower(t.name)] {
+			diags <- diagnostic{Path: t.source, Line: t.line, Column: 1, Rule: ruleUnusedGlossaryTerm,
+				Message: fmt.Sprintf("Glossary term %q isn't referenced by any :term: role.", t.name)}
+		}
+	}
+}
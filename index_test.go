@@ -0,0 +1,585 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDocPath(t *testing.T) {
+
+	testTable := []struct {
+		source   string
+		name     string
+		expected string
+	}{
+		{"/a/user-manual/index.rst", "transfer/index", "/a/user-manual/transfer/index.rst"},
+		{"/a/user-manual/index.rst", "/admin-manual/index", "/a/admin-manual/index.rst"},
+		{"/a/user-manual/transfer/transfer.rst", "../ingest/ingest.rst", "/a/user-manual/ingest/ingest.rst"},
+	}
+
+	for _, r := range testTable {
+		result := docPath(r.source, r.name, "/a")
+		if result != r.expected {
+			t.Errorf("docPath(%v, %v, /a) -> %v, not %v", r.source, r.name, result, r.expected)
+		}
+	}
+
+}
+
+// runCrossCheck runs c over idx, returning the problems found.
+func runCrossCheck(c crossCheck, idx *index) []diagnostic {
+	diags := make(chan diagnostic)
+	go func() {
+		c(idx, diags)
+		close(diags)
+	}()
+	var found []diagnostic
+	for d := range diags {
+		found = append(found, d)
+	}
+	return found
+}
+
+func TestCheckOrphans(t *testing.T) {
+
+	idx := &index{
+		root: "/a",
+		files: []string{
+			"/a/contents.rst",
+			"/a/user-manual/index.rst",
+			"/a/user-manual/transfer/transfer.rst",
+			"/a/user-manual/transfer/images/a.png",
+			"/a/user-manual/ingest/ingest.rst",
+			"/a/user-manual/ingest/orphan.rst",
+			"/a/admin-manual/index.rst",
+		},
+		toctrees: []toctreeEntry{
+			{source: "/a/contents.rst", path: "/a/user-manual/index.rst"},
+			{source: "/a/user-manual/index.rst", path: "/a/user-manual/transfer/transfer.rst"},
+			{source: "/a/user-manual/index.rst", path: "/a/user-manual/ingest/ing*.rst", glob: true},
+		},
+	}
+
+	found := runCrossCheck(checkOrphans, idx)
+	if len(found) != 2 {
+		t.Fatalf("checkOrphans found %v, expected 2 orphans", found)
+	}
+	if found[0].Path != "/a/user-manual/ingest/orphan.rst" || found[1].Path != "/a/admin-manual/index.rst" {
+		t.Errorf("checkOrphans found %v, expected orphan.rst and admin-manual/index.rst", found)
+	}
+
+}
+
+func TestCheckOrphanMarkers(t *testing.T) {
+
+	repo = &index{
+		root: "/a",
+		files: []string{
+			"/a/contents.rst",
+			"/a/user-manual/index.rst",
+			"/a/user-manual/transfer/transfer.rst",
+			"/a/user-manual/transfer/draft.rst",
+		},
+		toctrees: []toctreeEntry{
+			{source: "/a/contents.rst", path: "/a/user-manual/index.rst"},
+			{source: "/a/user-manual/index.rst", path: "/a/user-manual/transfer/transfer.rst"},
+		},
+	}
+	defer func() { repo = &index{} }()
+
+	runContentCheck(indexOrphanMarkers, "/a/user-manual/transfer/transfer.rst", ":orphan:\n\n.. _transfer:\n")
+	runContentCheck(indexOrphanMarkers, "/a/user-manual/transfer/draft.rst", ":orphan:\n\n.. code-block:: rst\n\n   :orphan:\n")
+
+	if found := runCrossCheck(checkOrphans, repo); len(found) != 0 {
+		t.Errorf("checkOrphans found %v, expected pages marked :orphan: to be left out", found)
+	}
+	found := runCrossCheck(checkOrphanMarkers, repo)
+	if len(found) != 2 {
+		t.Fatalf("checkOrphanMarkers found %v, expected 2 markers", found)
+	}
+	for _, d := range found {
+		included := d.Path == "/a/user-manual/transfer/transfer.rst"
+		if included != strings.HasSuffix(d.Message, "but it's included in a toctree.") {
+			t.Errorf("checkOrphanMarkers reported %q for %v", d.Message, d.Path)
+		}
+	}
+
+}
+
+func TestCheckToctreeTargets(t *testing.T) {
+
+	idx := &index{
+		root:  "/a",
+		files: []string{"/a/user-manual/index.rst", "/a/user-manual/transfer/transfer.rst"},
+		toctrees: []toctreeEntry{
+			{source: "/a/user-manual/index.rst", line: 5, target: "transfer/transfer", path: "/a/user-manual/transfer/transfer.rst"},
+			{source: "/a/user-manual/index.rst", line: 6, target: "ingest/ingest", path: "/a/user-manual/ingest/ingest.rst"},
+			{source: "/a/user-manual/index.rst", line: 7, target: "ingest/*", path: "/a/user-manual/ingest/*.rst", glob: true},
+		},
+	}
+
+	found := runCrossCheck(checkToctreeTargets, idx)
+	if len(found) != 2 || found[0].Line != 6 || found[1].Line != 7 {
+		t.Errorf("checkToctreeTargets found %v, expected problems on lines 6 and 7", found)
+	}
+
+}
+
+func TestCheckDocReferences(t *testing.T) {
+
+	idx := &index{
+		root:  "/a",
+		files: []string{"/a/user-manual/index.rst", "/a/user-manual/transfer/transfer.rst"},
+		roles: []roleUse{
+			{role: role{name: "doc", text: "transfer/transfer"}, source: "/a/user-manual/index.rst", line: 3},
+			{role: role{name: "doc", text: "Ingest </user-manual/ingest/ingest>"}, source: "/a/user-manual/index.rst", line: 4},
+			{role: role{name: "ref", text: "transfer"}, source: "/a/user-manual/index.rst", line: 5},
+		},
+	}
+
+	found := runCrossCheck(checkDocReferences, idx)
+	if len(found) != 1 || found[0].Line != 4 {
+		t.Errorf("checkDocReferences found %v, expected a problem on line 4", found)
+	}
+
+}
+
+func TestCheckDownloads(t *testing.T) {
+
+	idx := &index{
+		root:  "/a",
+		files: []string{"/a/admin-manual/install/install.rst", "/a/admin-manual/install/files/config.ini", "/a/scripts/setup.sh"},
+		roles: []roleUse{
+			{role: role{name: "download", text: "files/config.ini"}, source: "/a/admin-manual/install/install.rst", line: 3},
+			{role: role{name: "download", text: "The setup script </scripts/setup.sh>"}, source: "/a/admin-manual/install/install.rst", line: 4},
+			{role: role{name: "download", text: "files/missing.ini"}, source: "/a/admin-manual/install/install.rst", line: 5},
+			{role: role{name: "download", text: "https://www.archivematica.org/download.zip"}, source: "/a/admin-manual/install/install.rst", line: 6},
+		},
+	}
+
+	found := runCrossCheck(checkDownloads, idx)
+	if len(found) != 1 || found[0].Line != 5 {
+		t.Errorf("checkDownloads found %v, expected a problem on line 5", found)
+	}
+
+}
+
+func TestCheckRefLabels(t *testing.T) {
+
+	idx := &index{
+		root:   "/a",
+		labels: []labelDef{{name: "Transfer", source: "/a/user-manual/transfer/transfer.rst", line: 1}},
+		roles: []roleUse{
+			{role: role{name: "ref", text: "Back to the top <transfer>"}, source: "/a/user-manual/transfer/transfer.rst", line: 9},
+			{role: role{name: "ref", text: "ingest"}, source: "/a/user-manual/transfer/transfer.rst", line: 10},
+			{role: role{name: "ref", text: "genindex"}, source: "/a/index.rst", line: 3},
+		},
+	}
+
+	found := runCrossCheck(checkRefLabels, idx)
+	if len(found) != 1 || found[0].Line != 10 {
+		t.Errorf("checkRefLabels found %v, expected a problem on line 10", found)
+	}
+
+}
+
+func TestCheckDuplicateLabels(t *testing.T) {
+
+	idx := &index{
+		root: "/a",
+		labels: []labelDef{
+			{name: "premis", source: "/a/user-manual/transfer/transfer.rst", line: 1},
+			{name: "ingest", source: "/a/user-manual/ingest/ingest.rst", line: 1},
+			{name: "PREMIS", source: "/a/admin-manual/premis/premis.rst", line: 12},
+		},
+	}
+
+	found := runCrossCheck(checkDuplicateLabels, idx)
+	if len(found) != 2 {
+		t.Fatalf("checkDuplicateLabels found %v, expected 2 problems", found)
+	}
+	expected := `Label "premis" is also defined at admin-manual/premis/premis.rst:12.`
+	if found[0].Message != expected {
+		t.Errorf("checkDuplicateLabels message %q, not %q", found[0].Message, expected)
+	}
+
+}
+
+func TestCheckUnusedImages(t *testing.T) {
+
+	idx := &index{
+		root: "/a",
+		files: []string{
+			"/a/user-manual/transfer/transfer.rst",
+			"/a/user-manual/transfer/images/used.png",
+			"/a/user-manual/transfer/images/wildcard.svg",
+			"/a/user-manual/transfer/images/unused.png",
+		},
+		images: []fileUse{
+			{directive: "image", source: "/a/user-manual/transfer/transfer.rst", path: "/a/user-manual/transfer/images/used.png"},
+			{directive: "figure", source: "/a/user-manual/transfer/transfer.rst", path: "/a/user-manual/transfer/images/wildcard.*"},
+		},
+	}
+
+	found := runCrossCheck(checkUnusedImages, idx)
+	if len(found) != 1 || found[0].Path != "/a/user-manual/transfer/images/unused.png" {
+		t.Errorf("checkUnusedImages found %v, expected only unused.png", found)
+	}
+
+}
+
+func TestCheckImageTargets(t *testing.T) {
+
+	dir := t.TempDir()
+	images := filepath.Join(dir, "user-manual", "transfer", "images")
+	if err := os.MkdirAll(images, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(images, "Upper.png"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "user-manual", "transfer", "transfer.rst")
+
+	idx := &index{
+		root:  dir,
+		files: []string{source, filepath.Join(images, "Upper.png")},
+		images: []fileUse{
+			{source: source, line: 3, target: "images/Upper.png", path: filepath.Join(images, "Upper.png")},
+			{source: source, line: 4, target: "images/upper.png", path: filepath.Join(images, "upper.png")},
+			{source: source, line: 5, target: "images/missing.png", path: filepath.Join(images, "missing.png")},
+			{source: source, line: 6, target: "images/Upper.*", path: filepath.Join(images, "Upper.*")},
+		},
+	}
+
+	found := runCrossCheck(checkImageTargets, idx)
+	if len(found) != 2 || found[0].Line != 4 || found[1].Line != 5 {
+		t.Errorf("checkImageTargets found %v, expected problems on lines 4 and 5", found)
+	}
+
+}
+
+func TestCheckChapterIndexes(t *testing.T) {
+
+	idx := &index{
+		root: "/a",
+		dirs: []string{
+			"/a",
+			"/a/user-manual",
+			"/a/user-manual/transfer",
+			"/a/user-manual/transfer/images",
+			"/a/user-manual/ingest",
+			"/a/user-manual/images",
+		},
+		files: []string{"/a/user-manual/index.rst", "/a/user-manual/transfer/index.rst"},
+	}
+
+	found := runCrossCheck(checkChapterIndexes, idx)
+	if len(found) != 1 || found[0].Path != "/a/user-manual/ingest" {
+		t.Errorf("checkChapterIndexes found %v, expected only user-manual/ingest", found)
+	}
+
+}
+
+func TestCheckDuplicateTitles(t *testing.T) {
+
+	idx := &index{
+		root: "/a",
+		titles: []labelDef{
+			{name: "Overview", source: "/a/user-manual/transfer/overview.rst", line: 3},
+			{name: "overview", source: "/a/user-manual/ingest/overview.rst", line: 3},
+			{name: "Overview", source: "/a/admin-manual/installation/overview.rst", line: 3},
+		},
+	}
+
+	found := runCrossCheck(checkDuplicateTitles, idx)
+	if len(found) != 2 {
+		t.Fatalf("checkDuplicateTitles found %v, expected 2 problems", found)
+	}
+	expected := `Page title "Overview" is also used by user-manual/ingest/overview.rst.`
+	if found[0].Message != expected {
+		t.Errorf("checkDuplicateTitles message %q, not %q", found[0].Message, expected)
+	}
+
+}
+
+func TestCheckImageRelativity(t *testing.T) {
+
+	source := "/a/user-manual/transfer/transfer.rst"
+	idx := &index{
+		root: "/a",
+		images: []fileUse{
+			{source: source, line: 3, target: "images/a.png", path: "/a/user-manual/transfer/images/a.png"},
+			{source: source, line: 4, target: "../ingest/images/b.png", path: "/a/user-manual/ingest/images/b.png"},
+			{source: source, line: 5, target: "/admin-manual/installation/images/c.png", path: "/a/admin-manual/installation/images/c.png"},
+			{source: "/a/user-manual/index.rst", line: 6, target: "transfer/images/a.png", path: "/a/user-manual/transfer/images/a.png"},
+		},
+	}
+
+	found := runCrossCheck(checkImageRelativity, idx)
+	if len(found) != 2 || found[0].Line != 4 || found[1].Line != 5 {
+		t.Errorf("checkImageRelativity found %v, expected problems on lines 4 and 5", found)
+	}
+
+}
+
+func TestIndexIncludes(t *testing.T) {
+
+	repo = &index{root: "/a"}
+	defer func() { repo = &index{} }()
+
+	text := ".. include:: ../shared/note.rst\n" +
+		".. include:: <isonum.txt>\n" +
+		"\n" +
+		".. code-block:: rst\n" +
+		"\n" +
+		"   .. include:: example.rst\n"
+	runContentCheck(indexIncludes, "/a/user-manual/transfer/transfer.rst", text)
+
+	if len(repo.includes) != 1 {
+		t.Fatalf("indexIncludes recorded %v, expected 1 include", repo.includes)
+	}
+	if repo.includes[0].path != "/a/user-manual/shared/note.rst" || repo.includes[0].line != 1 {
+		t.Errorf("indexIncludes recorded unexpected include %+v", repo.includes[0])
+	}
+
+	found := runCrossCheck(checkIncludeTargets, repo)
+	if len(found) != 1 || found[0].Line != 1 {
+		t.Errorf("checkIncludeTargets found %v, expected a problem on line 1", found)
+	}
+
+}
+
+func TestCheckLiteralIncludes(t *testing.T) {
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "example.py"), []byte("a\nb\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repo = &index{root: root}
+	defer func() { repo = &index{} }()
+
+	text := ".. literalinclude:: /example.py\n" +
+		"   :lines: 1-3\n" +
+		"\n" +
+		".. literalinclude:: /example.py\n" +
+		"   :lines: 2,4-\n" +
+		"\n" +
+		".. literalinclude:: /example.py\n" +
+		"   :lines: 3-1\n" +
+		"\n" +
+		".. literalinclude:: missing.py\n"
+	runContentCheck(indexIncludes, filepath.Join(root, "index.rst"), text)
+
+	if len(repo.includes) != 4 || repo.includes[0].lines != "1-3" {
+		t.Fatalf("indexIncludes recorded %+v, expected 4 literal includes", repo.includes)
+	}
+
+	found := runCrossCheck(checkIncludeTargets, repo)
+	if len(found) != 3 || found[0].Line != 4 || found[1].Line != 7 || found[2].Line != 10 {
+		t.Errorf("checkIncludeTargets found %v, expected problems on lines 4, 7 and 10", found)
+	}
+
+}
+
+func TestCheckContents(t *testing.T) {
+
+	idx := &index{
+		root:  "/a",
+		dirs:  []string{"/a", "/a/user-manual", "/a/admin-manual", "/a/user-manual/transfer"},
+		files: []string{"/a/contents.rst", "/a/user-manual/index.rst", "/a/admin-manual/index.rst"},
+		toctrees: []toctreeEntry{
+			{source: "/a/contents.rst", line: 4, target: "user-manual/index", path: "/a/user-manual/index.rst"},
+			{source: "/a/contents.rst", line: 5, target: "old-manual/index", path: "/a/old-manual/index.rst"},
+			{source: "/a/user-manual/index.rst", line: 5, target: "transfer/index", path: "/a/user-manual/transfer/index.rst"},
+		},
+	}
+
+	found := runCrossCheck(checkContents, idx)
+	if len(found) != 2 {
+		t.Fatalf("checkContents found %v, expected 2 problems", found)
+	}
+	if found[0].Line != 5 {
+		t.Errorf("checkContents found %v, expected a problem with the entry on line 5", found[0])
+	}
+	if found[1].Message != `Manual "admin-manual" isn't included in the toctree.` {
+		t.Errorf("checkContents found %v, expected admin-manual to be missing", found[1])
+	}
+
+}
+
+func TestCheckChaptersRegistered(t *testing.T) {
+
+	idx := &index{
+		root: "/a",
+		dirs: []string{"/a", "/a/user-manual", "/a/user-manual/transfer", "/a/user-manual/ingest", "/a/admin-manual", "/a/admin-manual/installation"},
+		files: []string{
+			"/a/user-manual/index.rst",
+			"/a/user-manual/transfer/index.rst",
+			"/a/user-manual/ingest/index.rst",
+			"/a/admin-manual/installation/index.rst",
+		},
+		toctrees: []toctreeEntry{
+			{source: "/a/user-manual/index.rst", line: 5, target: "transfer/index", path: "/a/user-manual/transfer/index.rst"},
+		},
+	}
+
+	found := runCrossCheck(checkChaptersRegistered, idx)
+	if len(found) != 1 || found[0].Path != "/a/user-manual/ingest" {
+		t.Errorf("checkChaptersRegistered found %v, expected only user-manual/ingest", found)
+	}
+
+}
+
+func TestCheckSubstitutions(t *testing.T) {
+
+	root := t.TempDir()
+	conf := filepath.Join(root, "conf.py")
+	if err := os.WriteFile(conf, []byte("rst_epilog = \"\"\"\n.. |product| replace:: Archivematica\n\"\"\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	page := filepath.Join(root, "manual", "chapter", "page.rst")
+	shared := filepath.Join(root, "manual", "chapter", "shared.rst")
+	repo = &index{root: root}
+	defer func() { repo = &index{} }()
+
+	runContentCheck(indexSubstitutions, shared, ".. |logo| image:: images/logo.png\n")
+	runContentCheck(indexIncludes, page, ".. include:: shared.rst\n")
+	runContentCheck(indexSubstitutions, page, ".. |date| replace:: today\n"+
+		"\n"+
+		"|product| |version| |logo| |date| |missing|\n"+
+		"\n"+
+		".. code-block:: rst\n"+
+		"\n"+
+		"   |example|\n")
+
+	found := runCrossCheck(checkSubstitutions, repo)
+	if len(found) != 1 || found[0].Line != 3 || found[0].Message != "Substitution |missing| isn't defined." {
+		t.Errorf("checkSubstitutions found %v, expected a problem on line 3", found)
+	}
+
+}
+
+func TestCheckCitations(t *testing.T) {
+
+	repo = &index{root: "/a"}
+	defer func() { repo = &index{} }()
+
+	runContentCheck(indexCitations, "/a/manual/chapter/references.rst", ".. [CIT2002] A citation.\n")
+	runContentCheck(indexCitations, "/a/manual/chapter/page.rst", "See [cit2002]_ and [CIT1999]_, not [#f1]_.\n")
+
+	found := runCrossCheck(checkCitations, repo)
+	if len(found) != 1 || found[0].Message != "Citation reference [CIT1999]_ has no matching citation." {
+		t.Errorf("checkCitations found %v, expected a problem with [CIT1999]_", found)
+	}
+
+}
+
+func TestCheckExtensions(t *testing.T) {
+
+	root := t.TempDir()
+	conf := filepath.Join(root, "conf.py")
+	if err := os.WriteFile(conf, []byte("extensions = ['sphinx.ext.todo']\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	page := filepath.Join(root, "manual", "chapter", "page.rst")
+	repo = &index{root: root}
+	defer func() { repo, *extensionsFlag = &index{}, "" }()
+
+	text := ".. todo:: Finish this page.\n" +
+		"\n" +
+		".. tabs::\n" +
+		"\n" +
+		"   .. tab:: Ubuntu\n" +
+		"\n" +
+		"      See :cite:`dpc2015`.\n" +
+		"\n" +
+		".. code-block:: rst\n" +
+		"\n" +
+		"   .. mermaid::\n"
+	runContentCheck(indexDirectives, page, text)
+	runContentCheck(indexRoles, page, text)
+
+	found := runCrossCheck(checkExtensions, repo)
+	if len(found) != 3 || found[0].Line != 3 || found[1].Line != 5 || found[2].Line != 7 {
+		t.Errorf("checkExtensions found %v, expected problems on lines 3, 5 and 7", found)
+	}
+
+	*extensionsFlag = "sphinx_tabs.tabs,sphinxcontrib.bibtex"
+	found = runCrossCheck(checkExtensions, repo)
+	if len(found) != 1 || found[0].Line != 1 {
+		t.Errorf("checkExtensions with the extensions flag found %v, expected a problem on line 1", found)
+	}
+
+	if err := os.Remove(conf); err != nil {
+		t.Fatal(err)
+	}
+	*extensionsFlag = ""
+	if found := runCrossCheck(checkExtensions, repo); len(found) != 0 {
+		t.Errorf("checkExtensions without a conf.py found %v, expected no problems", found)
+	}
+
+}
+
+func TestCheckToctreeOptions(t *testing.T) {
+
+	repo = &index{root: "/a"}
+	defer func() { repo, *toctreeMaxdepthFlag, *toctreeHiddenFlag = &index{}, 0, "" }()
+
+	runContentCheck(indexToctrees, "/a/contents.rst", ".. toctree::\n   :maxdepth: 1\n\n   user-manual/index\n")
+	runContentCheck(indexToctrees, "/a/user-manual/index.rst", ".. toctree::\n   :maxdepth: 2\n\n   transfer/transfer\n"+
+		"   ingest/ingest\n   Transfers <transfer/transfer>\n")
+	runContentCheck(indexToctrees, "/a/admin-manual/index.rst", ".. toctree::\n   :maxdepth: 2\n\n   install/install\n")
+	runContentCheck(indexToctrees, "/a/admin-manual/install/install.rst", ".. toctree::\n   :hidden:\n\n   ubuntu\n")
+
+	found := runCrossCheck(checkToctreeOptions, repo)
+	if len(found) != 2 || found[0].Path != "/a/contents.rst" || found[1].Line != 6 {
+		t.Errorf("checkToctreeOptions found %v, expected problems in contents.rst and on line 6", found)
+	}
+
+	*toctreeMaxdepthFlag = 1
+	*toctreeHiddenFlag = "contents.rst"
+	found = runCrossCheck(checkToctreeOptions, repo)
+	if len(found) != 4 || found[0].Path != "/a/admin-manual/index.rst" || found[1].Message != "Toctree should have the :hidden: option." {
+		t.Errorf("checkToctreeOptions with flags found %v, expected the maxdepth of the manual indexes and contents.rst to be reported", found)
+	}
+
+}
+
+func TestCheckGlossaryTerms(t *testing.T) {
+
+	repo = &index{root: "/a"}
+	defer func() { repo = &index{} }()
+
+	runContentCheck(indexGlossaries, "/a/glossary/glossary.rst", ".. glossary::\n"+
+		"   :sorted:\n"+
+		"\n"+
+		"   AIP\n"+
+		"   Archival Information Package\n"+
+		"      A package for storage.\n"+
+		"\n"+
+		"      It has two paragraphs.\n"+
+		"\n"+
+		"   SIP : submission\n"+
+		"      A package for ingest.\n"+
+		"\n"+
+		"   DIP\n"+
+		"      A package for access.\n")
+	if len(repo.glossaryTerms) != 4 || repo.glossaryTerms[2].name != "SIP" || repo.glossaryTerms[2].line != 10 {
+		t.Fatalf("indexGlossaries recorded %v, expected 4 terms", repo.glossaryTerms)
+	}
+	repo.roles = []roleUse{
+		{role: role{name: "term", text: "aip"}, source: "/a/user-manual/ingest/ingest.rst", line: 3},
+		{role: role{name: "term", text: "packages <Archival Information Package>"}, source: "/a/user-manual/ingest/ingest.rst", line: 4},
+		{role: role{name: "term", text: "SIP"}, source: "/a/user-manual/ingest/ingest.rst", line: 5},
+		{role: role{name: "term", text: "METS"}, source: "/a/user-manual/ingest/ingest.rst", line: 6},
+	}
+
+	found := runCrossCheck(checkGlossaryTerms, repo)
+	if len(found) != 2 || found[0].Rule != ruleGlossaryTerm || found[0].Line != 6 ||
+		found[1].Rule != ruleUnusedGlossaryTerm || found[1].Line != 13 {
+		t.Errorf("checkGlossaryTerms found %v, expected METS to be undefined and DIP unused", found)
+	}
+
+}
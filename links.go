@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// A linkUse is an external URL found in a reST file.
+type linkUse struct {
+	url    string
+	source string
+	line   int
+	column int
+}
+
+// addLink records an external URL found in a reST file.
+func (idx *index) addLink(u linkUse) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.links = append(idx.links, u)
+}
+
+// indexLinks records the external URLs in the file at path, outside of literal directives and inline literals.
+func indexLinks(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	for l := range lines {
+		r.next(l)
+		if r.inBody(l, literalDirectives...) {
+			continue
+		}
+		for _, m := range findURLs(l.text) {
+			repo.addLink(linkUse{url: l.text[m[0]:m[1]], source: path, line: l.num,
+				column: utf8.RuneCountInString(l.text[:m[0]]) + 1})
+		}
+	}
+}
+
+// checkURL requests link, returning a description of the problem if it can't be reached, and whether the
+// problem could be temporary, like a timeout or a 5xx status, so the request is worth retrying.
+// Servers which don't allow HEAD requests are sent a GET request instead.
+func checkURL(client *http.Client, link string) (string, bool) {
+	target := link
+	if i := strings.Index(target, "#"); i >= 0 {
+		target = target[:i]
+	}
+	status := 0
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, target, nil)
+		if err != nil {
+			return fmt.Sprintf("Link %q isn't a valid URL.", link), false
+		}
+		req.Header.Set("User-Agent", "docmatica/"+version)
+		resp, err := client.Do(req)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				return fmt.Sprintf("Link %q has a host which couldn't be found.", link), false
+			}
+			return fmt.Sprintf("Link %q couldn't be reached. %v", link, err), true
+		}
+		resp.Body.Close()
+		status = resp.StatusCode
+		if method == http.MethodHead && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented ||
+			status == http.StatusForbidden) {
+			continue
+		}
+		break
+	}
+	if status >= 400 {
+		return fmt.Sprintf("Link %q returned status %v %v.", link, status, http.StatusText(status)),
+			status == http.StatusTooManyRequests || status >= 500
+	}
+	return "", false
+}
+
+// A linkCacheEntry is the result of checking a URL, as stored in the link cache.
+type linkCacheEntry struct {
+	Problem string    `json:"problem,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// loadLinkCache reads the link cache at path, which is empty if the file doesn't exist yet.
+func loadLinkCache(path string) (map[string]linkCacheEntry, error) {
+	cache := make(map[string]linkCacheEntry)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("%v isn't a link cache. %v", path, err)
+	}
+	return cache, nil
+}
+
+// saveLinkCache writes cache to path, leaving out the entries older than ttl.
+func saveLinkCache(path string, cache map[string]linkCacheEntry, ttl time.Duration) error {
+	for u, entry := range cache {
+		if time.Since(entry.Checked) > ttl {
+			delete(cache, u)
+		}
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// A linkChecker requests external URLs, limiting how many are requested at once and how often
+// each host is requested, retrying temporary problems, and caching the results.
+type linkChecker struct {
+	client      *http.Client
+	concurrency int
+	// The minimum time between requests to the same host.
+	delay time.Duration
+	// How many times to retry temporary problems, and how long to wait before the first retry,
+	// which doubles with each retry after it.
+	retries int
+	backoff time.Duration
+	// The results of earlier runs, which are reused until they're older than ttl. The cache isn't used when nil.
+	cache map[string]linkCacheEntry
+	ttl   time.Duration
+
+	mu sync.Mutex
+	// The time each host can next be requested.
+	next map[string]time.Time
+}
+
+// wait blocks until host can be requested, given the delay between requests to the same host.
+func (c *linkChecker) wait(host string) {
+	c.mu.Lock()
+	if c.next == nil {
+		c.next = make(map[string]time.Time)
+	}
+	now := time.Now()
+	at := c.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	c.next[host] = at.Add(c.delay)
+	c.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+// check returns a description of the problem with link, if it can't be reached, using the cache if possible.
+func (c *linkChecker) check(link string) string {
+	c.mu.Lock()
+	entry, ok := c.cache[link]
+	c.mu.Unlock()
+	if ok && time.Since(entry.Checked) <= c.ttl {
+		return entry.Problem
+	}
+
+	host := ""
+	if u, err := url.Parse(link); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+	backoff := c.backoff
+	var problem string
+	for attempt := 0; ; attempt++ {
+		c.wait(host)
+		var temporary bool
+		problem, temporary = checkURL(c.client, link)
+		if !temporary {
+			break
+		}
+		if attempt >= c.retries {
+			// Temporary problems aren't cached, so they're checked again on the next run.
+			return problem
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if c.cache != nil {
+		c.mu.Lock()
+		c.cache[link] = linkCacheEntry{Problem: problem, Checked: time.Now()}
+		c.mu.Unlock()
+	}
+	return problem
+}
+
+// checkURLs checks each of urls, with at most the checker's concurrency requests at once,
+// returning the problems found by URL.
+func (c *linkChecker) checkURLs(urls []string) map[string]string {
+	concurrency := c.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	problems := make(map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, concurrency)
+	for _, u := range urls {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(u string) {
+			defer wg.Done()
+			defer func() { <-limit }()
+			if problem := c.check(u); problem != "" {
+				mu.Lock()
+				problems[u] = problem
+				mu.Unlock()
+			}
+		}(u)
+	}
+	wg.Wait()
+	return problems
+}
+
+// newLinkChecker makes a link checker configured by the flags, using the link cache when one is given.
+func newLinkChecker() *linkChecker {
+	checker := &linkChecker{client: &http.Client{Timeout: *linkTimeoutFlag}, concurrency: *linkConcurrencyFlag,
+		delay: *linkDelayFlag, retries: *linkRetriesFlag, backoff: time.Second, ttl: *linkCacheTTLFlag}
+	if *linkCacheFlag != "" {
+		cache, err := loadLinkCache(*linkCacheFlag)
+		if err != nil {
+			log.Printf("Error: Unable to read the link cache, so every link is requested. %v", err)
+			cache = make(map[string]linkCacheEntry)
+		}
+		checker.cache = cache
+	}
+	return checker
+}
+
+// saveCache writes the checker's cache to the link cache, when one is given.
+func (c *linkChecker) saveCache() {
+	if *linkCacheFlag == "" {
+		return
+	}
+	if err := saveLinkCache(*linkCacheFlag, c.cache, c.ttl); err != nil {
+		log.Printf("Error: Unable to write the link cache. %v", err)
+	}
+}
+
+// checkLinks requests every external URL in the repository, reporting those which can't be reached.
+// Since it depends on the network, it only runs when the dead-link rule is enabled.
+func checkLinks(idx *index, diags chan<- diagnostic) {
+	if !ruleEnabled(ruleDeadLink) {
+		return
+	}
+	skipped := splitList(*linkSkipDomainsFlag)
+	var urls []string
+	seen := make(map[string]bool)
+	for _, u := range idx.links {
+		if parsed, err := url.Parse(u.url); err == nil && hostMatches(parsed.Hostname(), skipped) {
+			continue
+		}
+		if !seen[u.url] {
+			seen[u.url] = true
+			urls = append(urls, u.url)
+		}
+	}
+
+	checker := newLinkChecker()
+	problems := checker.checkURLs(urls)
+	checker.saveCache()
+
+	for _, u := range idx.links {
+		if problem, ok := problems[u.url]; ok {
+			diags <- diagnostic{Path: u.source, Line: u.line, Column: u.column, Rule: ruleDeadLink, Message: problem}
+		}
+	}
+}
+
+// httpsUpgrades finds the links the https rule reports which can be changed to HTTPS: those to domains
+// given with the tls-domains flag, and when the verify-https flag is given, those whose https:// version
+// can be reached. It returns the links which can be changed, and how many links to each other domain can't.
+func httpsUpgrades(idx *index) (map[string]bool, map[string]int) {
+	required, allowed, known := splitList(*httpsDomainsFlag), splitList(*httpDomainsFlag), splitList(*tlsDomainsFlag)
+	upgrades := make(map[string]bool)
+	unknown := make(map[string]int)
+	var unverified []string
+	for _, u := range idx.links {
+		parsed, err := url.Parse(u.url)
+		if err != nil || parsed.Scheme != "http" || !hostMatches(parsed.Hostname(), required) || hostMatches(parsed.Hostname(), allowed) {
+			continue
+		}
+		if hostMatches(parsed.Hostname(), known) {
+			upgrades[u.url] = true
+		} else {
+			unverified = append(unverified, u.url)
+		}
+	}
+
+	if *verifyHTTPSFlag && len(unverified) > 0 {
+		var secure []string
+		seen := make(map[string]bool)
+		for _, u := range unverified {
+			if !seen[u] {
+				seen[u] = true
+				secure = append(secure, "https://"+strings.TrimPrefix(u, "http://"))
+			}
+		}
+		checker := newLinkChecker()
+		problems := checker.checkURLs(secure)
+		checker.saveCache()
+		for _, u := range secure {
+			if _, ok := problems[u]; !ok {
+				upgrades["http://"+strings.TrimPrefix(u, "https://")] = true
+			}
+		}
+	}
+
+	for _, u := range unverified {
+		if !upgrades[u] {
+			parsed, _ := url.Parse(u)
+			unknown[strings.ToLower(parsed.Hostname())]++
+		}
+	}
+	return upgrades, unknown
+}
+
+// fixHTTPSLinks changes the http:// links the https rule reports to https://, for the domains known to support it.
+// Links to other domains are left alone, and their domains are reported to stderr, so they can be checked
+// by hand and given with the tls-domains flag.
+func fixHTTPSLinks(idx *index) (func(path string, lines []line) ([]line, []fix), []string) {
+	upgrades, unknown := httpsUpgrades(idx)
+	if len(unknown) > 0 {
+		var domains []string
+		for domain, n := range unknown {
+			domains = append(domains, fmt.Sprintf("%v (%v)", domain, n))
+		}
+		sort.Strings(domains)
+		fmt.Fprintf(os.Stderr, "Links not changed to HTTPS, since their domains aren't known to support it: %v\n", strings.Join(domains, ", "))
+	}
+
+	changed := make(map[string]bool)
+	for _, u := range idx.links {
+		if upgrades[u.url] {
+			changed[u.source] = true
+		}
+	}
+	var paths []string
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return func(path string, lines []line) ([]line, []fix) {
+		var r directiveReader
+		var fixes []fix
+		for i, l := range lines {
+			r.next(l)
+			if r.inBody(l, literalDirectives...) {
+				continue
+			}
+			matches := findURLs(l.text)
+			text := l.text
+			for j := len(matches) - 1; j >= 0; j-- {
+				m := matches[j]
+				link := l.text[m[0]:m[1]]
+				if !upgrades[link] {
+					continue
+				}
+				text = text[:m[0]] + "https" + text[m[0]+len("http"):]
+				fixes = append(fixes, fix{line: l.num, column: utf8.RuneCountInString(l.text[:m[0]]) + 1,
+					message: fmt.Sprintf("Changed link %q to use HTTPS.", link)})
+			}
+			lines[i].text = text
+		}
+		return lines, fixes
+	}, paths
+}
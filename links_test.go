@@ -0,0 +1,220 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// linkServer serves the paths used by the link tests.
+func linkServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/get-only":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestCheckURL(t *testing.T) {
+
+	server := linkServer()
+	defer server.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	testTable := []struct {
+		path      string
+		expected  string
+		temporary bool
+	}{
+		{"/ok", "", false},
+		{"/ok#section", "", false},
+		{"/get-only", "", false},
+		{"/missing", "returned status 404 Not Found.", false},
+		{"/error", "returned status 500 Internal Server Error.", true},
+	}
+
+	for _, r := range testTable {
+		result, temporary := checkURL(client, server.URL+r.path)
+		if (r.expected == "") != (result == "") || !strings.HasSuffix(result, r.expected) || temporary != r.temporary {
+			t.Errorf("checkURL(%v) -> %q, %v, expected %q, %v", r.path, result, temporary, r.expected, r.temporary)
+		}
+	}
+
+	if result, _ := checkURL(client, "http://host.invalid/"); !strings.Contains(result, "couldn't be") {
+		t.Errorf("checkURL of an unknown host -> %q, expected it not to be found", result)
+	}
+
+}
+
+func TestCheckLinks(t *testing.T) {
+
+	server := linkServer()
+	defer server.Close()
+	delay, retries := *linkDelayFlag, *linkRetriesFlag
+	defer func() {
+		repo, enabledRules = &index{}, nil
+		*linkDelayFlag, *linkRetriesFlag = delay, retries
+	}()
+	repo = &index{root: "/a"}
+	*linkDelayFlag, *linkRetriesFlag = 0, 0
+
+	text := "See " + server.URL + "/ok and " + server.URL + "/missing.\n" +
+		"\n" +
+		".. code-block:: bash\n" +
+		"\n" +
+		"   curl " + server.URL + "/error\n" +
+		"\n" +
+		"Again, " + server.URL + "/missing.\n"
+	runContentCheck(indexLinks, "/a/b/c.rst", text)
+	if len(repo.links) != 3 {
+		t.Fatalf("indexLinks recorded %v, expected 3 links", repo.links)
+	}
+
+	enabledRules = map[string]bool{}
+	if found := runCrossCheck(checkLinks, repo); len(found) != 0 {
+		t.Errorf("checkLinks found %v without being enabled, expected no requests", found)
+	}
+
+	enabledRules[ruleDeadLink] = true
+	found := runCrossCheck(checkLinks, repo)
+	if len(found) != 2 || found[0].Line != 1 || found[1].Line != 7 {
+		t.Errorf("checkLinks found %v, expected problems on lines 1 and 7", found)
+	}
+
+	*linkSkipDomainsFlag = "127.0.0.1"
+	defer func() { *linkSkipDomainsFlag = "" }()
+	if found := runCrossCheck(checkLinks, repo); len(found) != 0 {
+		t.Errorf("checkLinks found %v with the server's domain skipped, expected no requests", found)
+	}
+
+}
+
+func TestLinkChecker(t *testing.T) {
+
+	// The flaky path fails the first time each URL is requested.
+	requested := make(map[string]int)
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requested[r.URL.String()]++
+		if r.URL.Path == "/flaky" && requested[r.URL.String()] == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	checker := &linkChecker{client: &http.Client{Timeout: 5 * time.Second}, concurrency: 4,
+		delay: 20 * time.Millisecond, retries: 1, backoff: time.Millisecond,
+		cache: map[string]linkCacheEntry{
+			server.URL + "/cached":  {Problem: "Cached.", Checked: time.Now()},
+			server.URL + "/expired": {Problem: "Expired.", Checked: time.Now().Add(-2 * time.Hour)},
+		}, ttl: time.Hour}
+
+	start := time.Now()
+	problems := checker.checkURLs([]string{server.URL + "/flaky", server.URL + "/missing",
+		server.URL + "/cached", server.URL + "/expired"})
+	if len(problems) != 2 || problems[server.URL+"/cached"] != "Cached." || problems[server.URL+"/missing"] == "" {
+		t.Errorf("checkURLs -> %v, expected the missing and cached URLs", problems)
+	}
+	if requested["/cached"] != 0 || requested["/flaky"] != 2 || requested["/expired"] != 1 {
+		t.Errorf("checkURLs requested %v, expected the flaky URL twice, the expired URL once, and no cached URLs", requested)
+	}
+	// Four requests to the same host, so at least three delays between them.
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("checkURLs took %v, expected requests to the same host to be delayed", elapsed)
+	}
+	if entry := checker.cache[server.URL+"/expired"]; entry.Problem != "" || time.Since(entry.Checked) > time.Minute {
+		t.Errorf("checkURLs cached %v for the expired URL, expected a new result", entry)
+	}
+
+	// Temporary problems aren't cached.
+	checker.retries = 0
+	delete(requested, "/flaky")
+	delete(checker.cache, server.URL+"/flaky")
+	if problem := checker.check(server.URL + "/flaky"); problem == "" {
+		t.Errorf("check of the flaky URL without retries found no problem")
+	}
+	if _, ok := checker.cache[server.URL+"/flaky"]; ok {
+		t.Errorf("check cached a temporary problem: %v", checker.cache[server.URL+"/flaky"])
+	}
+
+}
+
+func TestLinkCache(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "links.json")
+	cache, err := loadLinkCache(path)
+	if err != nil || len(cache) != 0 {
+		t.Fatalf("loadLinkCache of a missing file -> %v, %v, expected an empty cache", cache, err)
+	}
+
+	cache["https://a.example/"] = linkCacheEntry{Checked: time.Now()}
+	cache["https://b.example/"] = linkCacheEntry{Problem: "Gone.", Checked: time.Now()}
+	cache["https://c.example/"] = linkCacheEntry{Checked: time.Now().Add(-48 * time.Hour)}
+	if err := saveLinkCache(path, cache, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadLinkCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || loaded["https://b.example/"].Problem != "Gone." {
+		t.Errorf("loadLinkCache -> %v, expected the two entries newer than the TTL", loaded)
+	}
+
+}
+
+func TestFixHTTPSLinks(t *testing.T) {
+
+	server := linkServer()
+	defer server.Close()
+	delay, retries, known, verify, allowed := *linkDelayFlag, *linkRetriesFlag, *tlsDomainsFlag, *verifyHTTPSFlag, *httpDomainsFlag
+	required := *httpsDomainsFlag
+	defer func() {
+		repo = &index{}
+		*linkDelayFlag, *linkRetriesFlag, *tlsDomainsFlag, *verifyHTTPSFlag, *httpDomainsFlag = delay, retries, known, verify, allowed
+		*httpsDomainsFlag = required
+	}()
+	repo = &index{root: "/a"}
+	*linkDelayFlag, *linkRetriesFlag = 0, 0
+	*tlsDomainsFlag, *verifyHTTPSFlag, *httpDomainsFlag, *httpsDomainsFlag = "archivematica.org", true, "", "*"
+
+	text := "See http://www.archivematica.org/a and http://legacy.example.net/b.\n" +
+		"\n" +
+		".. code-block:: bash\n" +
+		"\n" +
+		"   curl http://www.archivematica.org/a\n" +
+		"\n" +
+		"The server at " + server.URL + "/ok only serves HTTP.\n"
+	runContentCheck(indexLinks, "/a/b/c.rst", text)
+
+	upgrades, unknown := httpsUpgrades(repo)
+	if len(upgrades) != 1 || !upgrades["http://www.archivematica.org/a"] || len(unknown) != 2 || unknown["legacy.example.net"] != 1 {
+		t.Errorf("httpsUpgrades -> %v, with unknown domains %v, expected only the archivematica.org link", upgrades, unknown)
+	}
+
+	fn, paths := fixHTTPSLinks(repo)
+	if len(paths) != 1 || paths[0] != "/a/b/c.rst" {
+		t.Fatalf("fixHTTPSLinks changes %v, expected only /a/b/c.rst", paths)
+	}
+	expected := strings.Replace(text, "See http://", "See https://", 1)
+	if result, fixes := runFix(fn, "/a/b/c.rst", text); result != expected || len(fixes) != 1 || fixes[0].line != 1 || fixes[0].column != 5 {
+		t.Errorf("fixHTTPSLinks fixed %q with %v, not %q", result, fixes, expected)
+	}
+
+}
@@ -2,28 +2,265 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
 )
 
-type pathError struct {
-	path string
-	err  error
+// A diagnostic is a problem found by one of the checks.
+// Line and Column start at 1, and are 0 when the problem applies to a whole file.
+type diagnostic struct {
+	Path    string
+	Line    int
+	Column  int
+	Rule    string
+	Message string
+	// The severity of the problem, when it differs from the severity of its rule.
+	severity severity
 }
 
+// Severity is the severity of the problem, which by default is the severity of the rule which found it.
+func (d diagnostic) Severity() severity {
+	if d.severity != 0 {
+		return d.severity
+	}
+	return rules[d.Rule].severity
+}
+
+// A line of a reST file, numbered from 1.
+type line struct {
+	num  int
+	text string
+	// The line ending, which is "\n" or "\r\n", or empty for a last line without one.
+	eol string
+	// The byte offset of the start of the line in the file.
+	offset int
+}
+
+// splitLines splits the content of a file into lines.
+// As with bufio.ScanLines, a final line ending doesn't start another, empty, line.
+func splitLines(data []byte) []line {
+	var lines []line
+	for start := 0; start < len(data); {
+		l := line{num: len(lines) + 1, offset: start}
+		end := bytes.IndexByte(data[start:], '\n')
+		if end < 0 {
+			l.text = string(data[start:])
+			start = len(data)
+		} else {
+			l.text, l.eol = string(data[start:start+end]), "\n"
+			start += end + 1
+		}
+		if l.eol != "" && strings.HasSuffix(l.text, "\r") {
+			l.text, l.eol = strings.TrimSuffix(l.text, "\r"), "\r\n"
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// A contentCheck reads the lines of the reST file at path in order,
+// sending any problems found to diags, which it must not close.
+type contentCheck func(path string, lines <-chan line, diags chan<- diagnostic)
+
+// The checks run against the content of every reST file.
+var contentChecks = []contentCheck{
+	checkAnchors,
+	indexToctrees,
+	indexRoles,
+	indexLabels,
+	checkAnchorConvention,
+	indexImages,
+	checkPlaceholder,
+	indexTitles,
+	indexIncludes,
+	indexDirectives,
+	indexOrphanMarkers,
+	indexGlossaries,
+	checkHeadingUnderlines,
+	checkHeadingHierarchy,
+	checkAdornments,
+	checkTrailingWhitespace,
+	checkWhitespaceLines,
+	checkBlankLines,
+	checkTabs,
+	checkLineLength,
+	checkFinalNewline,
+	checkLineEndings,
+	checkEncoding,
+	checkSuspiciousCharacters,
+	checkCurlyQuotes,
+	checkSyntax,
+	checkCodeLanguage,
+	checkCodeSamples,
+	checkDirectiveNames,
+	checkRawHTML,
+	checkDeprecated,
+	checkRoleNames,
+	checkSplitMarkup,
+	checkFloatingLabels,
+	checkRefText,
+	checkTables,
+	checkAdmonitions,
+	checkUILabels,
+	indexSubstitutions,
+	checkFootnotes,
+	indexCitations,
+	checkTodos,
+	checkDuplicateSections,
+	checkHeadingCase,
+	checkTerms,
+	checkVocabulary,
+	checkSpelling,
+	checkAcronyms,
+	checkFigureCaptions,
+	checkAltText,
+	checkScreenshotFigures,
+	checkVersions,
+	checkHTTPS,
+	checkDeniedDomains,
+	checkBareURLs,
+	indexLinks,
+}
+
+// httpsDomains are the domains the documentation commonly links to which are known to support HTTPS,
+// the default of the https-domains and tls-domains flags.
+const httpsDomains = "archivematica.org,artefactual.com,accesstomemory.org,github.com,wikipedia.org,python.org," +
+	"readthedocs.io,readthedocs.org,ubuntu.com,debian.org,docker.com,elastic.co,mysql.com,nginx.org,w3.org,loc.gov," +
+	"archives.gov,dpconline.org,nationalarchives.gov.uk"
+
 var (
 	pathFlag = flag.String("path", "", "The path to the directory you want to run the tool on. "+
 		"If not provided, the current working directory will be used.")
+	formatFlag   = flag.String("format", "text", "The output format. One of: "+formatNames()+".")
+	templateFlag = flag.String("template", "", "The Go text/template used for each problem by the template format, "+
+		"for example '{{.Path}}:{{.Line}}: {{.Message}}'. Available fields are Path, Line, Column, Rule, Severity and Message.")
+	quietFlag      = flag.Bool("quiet", false, "Don't print warnings about paths which couldn't be accessed.")
+	errorsOnlyFlag = flag.Bool("errors-only", false, "Only report problems with error severity, hiding warnings.")
+	summaryFlag    = flag.Bool("summary", true, "Print a summary of the run to stderr once all files are checked.")
+	groupByFlag    = flag.String("group-by", "", "Group the problems found by file or by rule, instead of reporting them as they're found.")
+	streamFlag     = flag.Bool("stream", false, "Print text output as problems are found, instead of sorted by path and line once all files are checked, unless fixing.")
+	outputFlag     = flag.String("o", "", "Write the report to this file instead of stdout.")
+	fixFlag        = flag.Bool("fix", false, "Fix the problems which rules can remedy automatically, rewriting the files before checking them, "+
+		"and print the fixes made to stderr.")
+	diffFlag        = flag.Bool("diff", false, "With the fix flag, print unified diffs of the fixes to stdout instead of rewriting the files, and the report to stderr.")
+	interactiveFlag = flag.Bool("interactive", false, "With the fix flag, show each change the fixes make and ask whether to apply it.")
+	enableFlag      = flag.String("enable", "", "Opt-in rules to check, by identifier or name, separated by commas.")
+	disableFlag     = flag.String("disable", "", "Rules not to check, by identifier or name, separated by commas.")
+	colorFlag       = flag.String("color", "auto", "Whether to color text output. One of: auto, always, never. "+
+		"With auto, color is used when printing to a terminal and the NO_COLOR environment variable is not set.")
 	// A version flag, which should be overwritten when building using ldflags.
 	version = "devel"
 )
 
+// Flags configuring the rules.
+var (
+	anchorConventionFlag = flag.String("anchor-convention", "", "The convention page anchors must follow, such as '<manual>-<chapter>-<page>'. "+
+		"<manual> is the manual directory without any '-manual' suffix, <chapter> the chapter directory, and <page> the file name. "+
+		"If not provided, anchor names aren't checked.")
+	pageAnchorsFlag = flag.Int("page-anchors", 1, "The number of anchors pages can begin with, such as labels kept so old links still work. "+
+		"The back to the top link refers to the first.")
+	maxDepthFlag = flag.Int("max-depth", 3, "The maximum depth .rst files can be nested below the root, counting the file itself. "+
+		"The default allows manual/chapter/page.rst. Use 0 to allow any depth.")
+	filenamePatternFlag = flag.String("filename-pattern", `^[a-z0-9]+(-[a-z0-9]+)*\.[a-z0-9]+$`,
+		"The regular expression the names of .rst files and images must match. "+
+			"The default requires lowercase names separated by hyphens.")
+
+	adornmentsFlag = flag.String("adornments", "=,-,~", "The adornment of each level of heading, from the page title down, separated by commas. "+
+		"Write an adornment twice, like '==', for it to have an overline. If not provided, adornments aren't checked.")
+	maxLineLengthFlag = flag.Int("max-line-length", 100, "The maximum length of lines in .rst files. "+
+		"Lines with URLs and table rows are exempt. Use 0 to allow any length.")
+	tabWidthFlag = flag.Int("tab-width", 8, "The number of columns between the tab stops tabs indenting .rst files advance to, "+
+		"when the fix flag replaces them with spaces. The default matches how docutils reads tabs.")
+	lineEndingsFlag   = flag.String("line-endings", "lf", "The line endings of .rst files, either lf or crlf.")
+	maxBlankLinesFlag = flag.Int("max-blank-lines", 2, "The maximum number of consecutive blank lines in .rst files. "+
+		"Use 0 to allow any number.")
+	symlinksFlag = flag.String("symlinks", "warn", "What to do with symbolic links. One of: forbid, warn, follow. "+
+		"Links pointing outside the repository are always reported.")
+	rolesFlag = flag.String("roles", "", "Roles to allow in addition to those of docutils and Sphinx, separated by commas, "+
+		"such as roles added by Sphinx extensions.")
+	refTextFlag = flag.String("ref-text", "", "Whether :ref: links must give their link text, either explicit or implicit. "+
+		"If not provided, only links with empty text are reported.")
+	rawHTMLFlag = flag.String("raw-html", "", "The pages which can use raw HTML, as paths relative to the root which can use wildcards, "+
+		"separated by commas.")
+	deprecatedFlag = flag.String("deprecated", "highlightlang::=highlight::,htmlonly::=only:: html,latexonly::=only:: latex",
+		"Deprecated directives like 'name::', roles like ':name:', and options like 'directive:: :option:', each optionally followed by "+
+			"'=' and how to migrate from it, separated by commas.")
+	extensionsFlag = flag.String("extensions", "", "The Sphinx extensions the project enables, separated by commas. "+
+		"If not provided, they're read from conf.py.")
+	toctreeMaxdepthFlag = flag.Int("toctree-maxdepth", 0, "The :maxdepth: every visible toctree must have. "+
+		"Use 0 for toctrees to have the most common maxdepth.")
+	toctreeHiddenFlag = flag.String("toctree-hidden", "", "The pages whose toctrees must be hidden, as paths relative to the root "+
+		"which can use wildcards, separated by commas.")
+	maxCrossManualFlag = flag.Int("max-cross-manual", 0, "The maximum number of references from one manual into another. "+
+		"Use 0 to allow any number.")
+	crossManualReportFlag = flag.String("cross-manual-report", "", "Write every reference crossing manual boundaries to this file.")
+	admonitionsFlag       = flag.String("admonitions", "note,warning,tip,important", "The admonitions pages can use, separated by commas.")
+	maxAdmonitionsFlag    = flag.Int("max-admonitions", 0, "The maximum number of admonitions in a page. Use 0 to allow any number.")
+	uiElementsFlag        = flag.String("ui-elements", "button,tab,menu,field,checkbox,dropdown,drop-down,dialog,icon,link,panel",
+		"The words which, following bold or quoted text, mark it as the name of an element of the user interface, separated by commas.")
+	failOnTodoFlag = flag.Bool("fail-on-todo", false, "Check the opt-in todo rule, reporting its problems as errors, "+
+		"so drafts aren't published accidentally.")
+	headingCaseFlag = flag.String("heading-case", "", "The capitalization of headings, either sentence or title. "+
+		"If not provided, the capitalization of headings isn't checked.")
+	headingWordsFlag = flag.String("heading-words", "Archivematica,AtoM,ArchivesSpace,DSpace,Dataverse,Fedora,Islandora,LibreOffice,Linux,Ubuntu,CentOS,Docker,Elasticsearch,MySQL,Python,Django",
+		"Names which keep their capitalization in headings, such as product names, separated by commas.")
+	termsFlag = flag.String("terms", "Archivematica,AtoM,METS,PREMIS,ArchivesSpace,DSpace,BagIt,Dataverse,LOCKSS,DuraCloud",
+		"The product and standard names which must be capitalized as given, separated by commas.")
+	vocabularyFlag = flag.String("vocabulary", "click on=click,e.g.=for example,i.e.=that is,etc.=and so on,utilize=use,in order to=to",
+		"The words and phrases to avoid in prose, each optionally followed by '=' and a suggested replacement, separated by commas.")
+	dictionariesFlag = flag.String("dictionaries", "", "Word lists for spell checking, one word per line, separated by commas, "+
+		"such as /usr/share/dict/words and a project dictionary of Archivematica vocabulary. If not provided, spelling isn't checked.")
+	acronymsFlag = flag.String("acronyms", "API,CPU,CSV,DNS,FAQ,FTP,HTML,HTTP,HTTPS,ID,IP,JSON,NFS,OK,OS,PDF,RAM,SQL,SSH,UI,URL,USB,UUID,XML",
+		"The acronyms which are well enough known not to be expanded, separated by commas.")
+	versionPatternFlag = flag.String("version-pattern", `\b(?:Archivematica|Storage Service)\s+v?\d+\.\d+(?:\.\d+)?\b`,
+		"The regular expression matching hard-coded versions in prose, which should use a substitution like |version|. "+
+			"Use an empty pattern not to check for versions.")
+	httpsDomainsFlag = flag.String("https-domains", httpsDomains, "The domains, including their subdomains, which links must use HTTPS for, "+
+		"separated by commas. Use * for every domain.")
+	httpDomainsFlag = flag.String("http-domains", "localhost,127.0.0.1,example.com,example.org",
+		"The domains which links can use HTTP for, as exceptions to the https-domains flag, separated by commas.")
+	tlsDomainsFlag = flag.String("tls-domains", httpsDomains, "The domains, including their subdomains, known to support HTTPS, "+
+		"whose links the fix flag changes from http:// to https://, separated by commas.")
+	verifyHTTPSFlag = flag.Bool("verify-https", false, "With the fix flag, request the https:// version of http:// links "+
+		"to domains not given with the tls-domains flag, and change the links which can be reached.")
+	deniedDomainsFlag = flag.String("denied-domains", "", "The domains, including their subdomains, which links must never point to, "+
+		"separated by commas.")
+	checkLinksFlag = flag.Bool("check-links", false, "Check the opt-in dead-link rule, requesting every external URL "+
+		"to report those which can't be reached.")
+	linkConcurrencyFlag = flag.Int("link-concurrency", 8, "The number of external URLs requested at once when checking links.")
+	linkTimeoutFlag     = flag.Duration("link-timeout", 10*time.Second, "How long to wait for each external URL when checking links.")
+	linkSkipDomainsFlag = flag.String("link-skip-domains", "", "The domains, including their subdomains, which aren't requested when checking links, "+
+		"such as flaky internal hosts, separated by commas.")
+	linkDelayFlag   = flag.Duration("link-delay", time.Second, "The minimum time between requests to the same host when checking links.")
+	linkRetriesFlag = flag.Int("link-retries", 2, "How many times to retry external URLs which time out, or return a 429 or 5xx status, "+
+		"when checking links. Each retry waits twice as long as the one before.")
+	linkCacheFlag = flag.String("link-cache", "", "A file to cache the results of checking links in, "+
+		"so external URLs aren't requested on every run. The cache isn't used if no file is given.")
+	linkCacheTTLFlag = flag.Duration("link-cache-ttl", 24*time.Hour, "How long the results in the link cache are reused for.")
+
+	// The prompt asking which fixes to apply, when the interactive flag is given.
+	prompt *fixPrompt
+	// The fixes previewed, when the diff flag is given.
+	preview *fixPreview
+
+	// The compiled filename-pattern flag.
+	filenamePattern *regexp.Regexp
+	// The compiled version-pattern flag, which is nil when versions aren't checked.
+	versionPattern *regexp.Regexp
+	// The words of the dictionaries flag, in lowercase.
+	dictionary map[string]bool
+)
+
 func init() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Docmatica\nVersion %v\n\n", version)
@@ -35,16 +272,187 @@ func init() {
 		fmt.Fprintln(os.Stderr, "    * index.rst files, which can be in the root of manuals or the root of the repository.")
 		fmt.Fprintln(os.Stderr, "    * contents.rst files, which can be in the root of the repository.")
 		fmt.Fprintln(os.Stderr, "- All .rst files have 'Back to Top' anchors.")
-		fmt.Fprintln(os.Stderr, "\nCommand line arguments:\n")
+		fmt.Fprintln(os.Stderr, "- All images directories are directly inside chapter directories.")
+		fmt.Fprintln(os.Stderr, "- All chapter directories contain an index.rst file.")
+		fmt.Fprintln(os.Stderr, "- No .rst files are nested deeper than the maximum depth.")
+		fmt.Fprintln(os.Stderr, "- All .rst files and images have lowercase, hyphen separated names, or match the filename pattern.")
+		fmt.Fprintln(os.Stderr, "- No .rst files are empty, or only have an anchor and a title.")
+		fmt.Fprintln(os.Stderr, "- No two pages in the same manual have the same title.")
+		fmt.Fprintln(os.Stderr, "- Pages only use images from their own chapter.")
+		fmt.Fprintln(os.Stderr, "- All include and literalinclude directives refer to files which exist, and line ranges are within the file.")
+		fmt.Fprintln(os.Stderr, "- Symbolic links follow the symlinks policy, and don't point outside the repository.")
+		fmt.Fprintln(os.Stderr, "- The toctree of contents.rst includes the index of every manual, and nothing else.")
+		fmt.Fprintln(os.Stderr, "- Every chapter is included in the toctree of its manual's index.rst.")
+		fmt.Fprintln(os.Stderr, "- Section title underlines and overlines are at least as long as the title.")
+		fmt.Fprintln(os.Stderr, "- Section levels are used in order, without skipping any.")
+		fmt.Fprintln(os.Stderr, "- No lines in .rst files have trailing whitespace.")
+		fmt.Fprintln(os.Stderr, "- No .rst files contain tab characters.")
+		fmt.Fprintln(os.Stderr, "- No lines in .rst files are longer than the maximum line length, except those with URLs and table rows.")
+		fmt.Fprintln(os.Stderr, "- All .rst files end with a newline.")
+		fmt.Fprintln(os.Stderr, "- Lines in .rst files end with the line endings given with the line-endings flag, Unix (LF) by default.")
+		fmt.Fprintln(os.Stderr, "- All .rst files are valid UTF-8, without a byte-order mark.")
+		fmt.Fprintln(os.Stderr, "- No .rst files contain non-breaking spaces or zero-width characters.")
+		fmt.Fprintln(os.Stderr, "- No .rst files contain curly quotes or apostrophes.")
+		fmt.Fprintln(os.Stderr, "- Directives, directive options, field lists and literal blocks are well formed.")
+		fmt.Fprintln(os.Stderr, "- Code blocks name a language Pygments knows.")
+		fmt.Fprintln(os.Stderr, "- Directive names aren't misspellings of docutils or Sphinx directives.")
+		fmt.Fprintln(os.Stderr, "- Roles are provided by docutils or Sphinx, defined in the page, or allowed by the roles flag.")
+		fmt.Fprintln(os.Stderr, "- Grid and simple tables are well formed.")
+		fmt.Fprintln(os.Stderr, "- Admonitions are of an allowed type, separated from their body by a blank line, and not overused.")
+		fmt.Fprintln(os.Stderr, "- Elements of the user interface are named with the :guilabel: or :menuselection: roles, not quotes or bold text.")
+		fmt.Fprintln(os.Stderr, "- Footnote references match a footnote in the same page, and citation references match a citation.")
+		fmt.Fprintln(os.Stderr, "- Pages have no todo directives or TODO and FIXME comments, when the todo rule is enabled.")
+		fmt.Fprintln(os.Stderr, "- No two sections in a page have the same title.")
+		fmt.Fprintln(os.Stderr, "- Headings follow the heading case, when one is given.")
+		fmt.Fprintln(os.Stderr, "- Product and standard names are capitalized as given with the terms flag.")
+		fmt.Fprintln(os.Stderr, "- Prose avoids the words and phrases given with the vocabulary flag.")
+		fmt.Fprintln(os.Stderr, "- Words in prose are spelled correctly, when dictionaries are given.")
+		fmt.Fprintln(os.Stderr, "- Acronyms are expanded the first time they're used in a page, when the acronym rule is enabled.")
+		fmt.Fprintln(os.Stderr, "- Figure directives have a caption.")
+		fmt.Fprintln(os.Stderr, "- Image and figure directives have alt text.")
+		fmt.Fprintln(os.Stderr, "- Screenshots in images directories use figure directives, not image directives.")
+		fmt.Fprintln(os.Stderr, "- Prose doesn't hard-code versions, which should use a substitution like |version|.")
+		fmt.Fprintln(os.Stderr, "- External links use HTTPS, for the domains given with the https-domains flag, by default domains known to support it.")
+		fmt.Fprintln(os.Stderr, "- External links don't point to the domains given with the denied-domains flag.")
+		fmt.Fprintln(os.Stderr, "- Prose links with named hyperlinks rather than bare URLs.")
+		fmt.Fprintln(os.Stderr, "- :ref: links have link text, and the text required by the ref-text flag, when given.")
+		fmt.Fprintln(os.Stderr, "- Headings use the adornment given with the adornments flag for their level.")
+		fmt.Fprintln(os.Stderr, "- Pages don't use raw HTML, except those given with the raw-html flag.")
+		fmt.Fprintln(os.Stderr, "- Pages don't use the directives, roles and options given with the deprecated flag.")
+		fmt.Fprintln(os.Stderr, "- Lines in directive bodies which look blank don't contain whitespace.")
+		fmt.Fprintln(os.Stderr, "- No .rst files have more consecutive blank lines than the max-blank-lines flag allows.")
+		fmt.Fprintln(os.Stderr, "- Inline markup isn't split across line breaks.")
+		fmt.Fprintln(os.Stderr, "- Labels are followed by a section heading or a figure.")
+		fmt.Fprintln(os.Stderr, "- Code samples in JSON, YAML, shell and INI are free of syntax errors.")
+		fmt.Fprintln(os.Stderr, "- All .rst files are included in a toctree, except index.rst and contents.rst in the root of the repository, and pages marked :orphan:.")
+		fmt.Fprintln(os.Stderr, "- All toctree entries refer to documents which exist.")
+		fmt.Fprintln(os.Stderr, "- All :doc: roles refer to documents which exist.")
+		fmt.Fprintln(os.Stderr, "- All :ref: roles refer to labels defined in the repository.")
+		fmt.Fprintln(os.Stderr, "- No label is defined more than once in the repository.")
+		fmt.Fprintln(os.Stderr, "- Page anchors follow the anchor convention, when one is given.")
+		fmt.Fprintln(os.Stderr, "- All files in images directories are used by an image or figure directive.")
+		fmt.Fprintln(os.Stderr, "- All image and figure directives refer to files which exist, with the same case.")
+		fmt.Fprintln(os.Stderr, "- All substitution references are defined in the page, a file it includes, or conf.py.")
+		fmt.Fprintln(os.Stderr, "- External links can be reached, when links are checked.")
+		fmt.Fprintln(os.Stderr, "- Directives and roles of Sphinx extensions are only used when the extension is enabled.")
+		fmt.Fprintln(os.Stderr, "- Toctrees have consistent options and no duplicate entries.")
+		fmt.Fprintln(os.Stderr, "- Pages aren't marked :orphan:, which hides them from the toctree check.")
+		fmt.Fprintln(os.Stderr, "- Manuals don't reference each other more than the max-cross-manual flag allows, when given.")
+		fmt.Fprintln(os.Stderr, "- :download: roles refer to files which exist.")
+		fmt.Fprintln(os.Stderr, "- :term: roles refer to terms defined in a glossary.")
+		fmt.Fprintln(os.Stderr, "- Glossary terms are referenced by a :term: role.")
+		fmt.Fprint(os.Stderr, "\nCommand line arguments:\n\n")
 		flag.PrintDefaults()
 	}
 }
 
 func main() {
 
+	start := time.Now()
+
 	// Process the flags.
 	flag.Parse()
 
+	format, ok := formatters[*formatFlag]
+	if !ok {
+		log.Fatalf("Error: Unknown output format %q, expected one of: %v.", *formatFlag, formatNames())
+	}
+
+	// The report is written to stdout, unless an output file is given.
+	// When the fixes are previewed, stdout is left to the diffs, so they can be applied, and the report goes to stderr.
+	out := os.Stdout
+	if *outputFlag != "" {
+		f, err := os.Create(*outputFlag)
+		if err != nil {
+			log.Fatalf("Error: Unable to create output file, exiting. %v", err)
+		}
+		out = f
+	} else if *fixFlag && *diffFlag {
+		out = os.Stderr
+	}
+
+	color, err := useColor(*colorFlag, out)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	var tmpl *template.Template
+	if *formatFlag == "template" {
+		if *templateFlag == "" {
+			log.Fatalf("Error: The template format needs a template, given with the template flag.")
+		}
+		var err error
+		tmpl, err = template.New("diagnostic").Parse(*templateFlag)
+		if err != nil {
+			log.Fatalf("Error: Unable to parse template. %v", err)
+		}
+	}
+
+	filenamePattern, err = regexp.Compile(*filenamePatternFlag)
+	if err != nil {
+		log.Fatalf("Error: Unable to parse filename pattern. %v", err)
+	}
+
+	enabledRules, err = parseRuleList(*enableFlag)
+	if err != nil {
+		log.Fatalf("Error: Unable to parse the rules to enable. %v", err)
+	}
+	disabledRules, err = parseRuleList(*disableFlag)
+	if err != nil {
+		log.Fatalf("Error: Unable to parse the rules to disable. %v", err)
+	}
+	if *failOnTodoFlag {
+		enabledRules[ruleTodo] = true
+	}
+	if *checkLinksFlag {
+		enabledRules[ruleDeadLink] = true
+	}
+
+	if *versionPatternFlag != "" {
+		versionPattern, err = regexp.Compile(*versionPatternFlag)
+		if err != nil {
+			log.Fatalf("Error: Unable to parse version pattern. %v", err)
+		}
+	}
+
+	dictionary, err = loadDictionary(splitList(*dictionariesFlag))
+	if err != nil {
+		log.Fatalf("Error: Unable to read dictionary. %v", err)
+	}
+
+	if *refTextFlag != "" && *refTextFlag != "explicit" && *refTextFlag != "implicit" {
+		log.Fatalf("Error: Unknown ref text convention %q, expected one of: explicit, implicit.", *refTextFlag)
+	}
+
+	if _, ok := lineEndings[*lineEndingsFlag]; !ok {
+		log.Fatalf("Error: Unknown line endings %q, expected one of: lf, crlf.", *lineEndingsFlag)
+	}
+
+	if *headingCaseFlag != "" && *headingCaseFlag != "sentence" && *headingCaseFlag != "title" {
+		log.Fatalf("Error: Unknown heading case %q, expected one of: sentence, title.", *headingCaseFlag)
+	}
+
+	if *symlinksFlag != "forbid" && *symlinksFlag != "warn" && *symlinksFlag != "follow" {
+		log.Fatalf("Error: Unknown symlinks policy %q, expected one of: forbid, warn, follow.", *symlinksFlag)
+	}
+
+	if *diffFlag && !*fixFlag {
+		log.Fatalf("Error: The diff flag previews the fixes of the fix flag, so it needs the fix flag too.")
+	}
+	if *interactiveFlag && (!*fixFlag || *diffFlag) {
+		log.Fatalf("Error: The interactive flag asks which fixes of the fix flag to apply, so it needs the fix flag, without the diff flag.")
+	}
+	if *interactiveFlag {
+		prompt = &fixPrompt{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+	}
+	if *fixFlag && *diffFlag {
+		preview = newFixPreview()
+	}
+
+	if *groupByFlag != "" && *groupByFlag != "file" && *groupByFlag != "rule" {
+		log.Fatalf("Error: Unknown grouping %q, expected one of: file, rule.", *groupByFlag)
+	}
+
 	root := *pathFlag
 
 	if root == "" {
@@ -55,13 +463,15 @@ func main() {
 		}
 		root = wd
 	}
+	root = filepath.Clean(root)
+	repo.root = root
 
 	// The tool spins up a new goroutine per file.
 	// Use a WaitGroup to ensure all processing completes before exiting.
 	var wg sync.WaitGroup
 
 	// The linter functions can send errors to this channel.
-	lintErrors := make(chan pathError)
+	lintErrors := make(chan diagnostic)
 
 	// These are the names of files we can ignore
 	// when we're in the "archivematica-docs" directory.
@@ -74,15 +484,25 @@ func main() {
 		"conf.py",
 	}
 
+	// The files which will be checked, in the order they were found.
+	var files []string
+
+	// The directories walked by following symbolic links, so links can't make the walk loop.
+	followed := make(map[string]bool)
+	if realRoot, err := filepath.EvalSymlinks(root); err == nil {
+		followed[realRoot] = true
+	}
+
 	// Recursively search the root directory and all subdirectories.
 	// Ignore files starting with "."
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+	var walk filepath.WalkFunc
+	walk = func(path string, info os.FileInfo, err error) error {
 
 		rpath := relPath(path, root)
 
 		// If an error occurred accessing this path, print it but don't stop processing.
 		if err != nil {
-			log.Printf("Error with path %v: %v", rpath, err)
+			warnf("Error with path %v: %v", rpath, err)
 			return nil
 		}
 
@@ -118,25 +538,107 @@ func main() {
 			}
 		}
 
+		// Symbolic links are reported, or followed, depending on the symlinks policy.
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, follow, d := checkSymlink(path, root, *symlinksFlag)
+			if d != nil {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					lintErrors <- *d
+				}()
+			}
+			if !follow {
+				return nil
+			}
+			targetInfo, err := os.Stat(path)
+			if err != nil {
+				warnf("Error with path %v: %v", rpath, err)
+				return nil
+			}
+			if targetInfo.IsDir() {
+				if followed[target] {
+					return nil
+				}
+				followed[target] = true
+				return filepath.Walk(target, func(p string, i os.FileInfo, err error) error {
+					return walk(filepath.Join(path, strings.TrimPrefix(p, target)), i, err)
+				})
+			}
+			info = targetInfo
+		}
+
+		if info.IsDir() {
+			repo.addDir(path)
+		} else {
+			files = append(files, path)
+			repo.addFile(path)
+		}
+
 		wg.Add(1)
 		go check(path, info, &wg, lintErrors)
 		return nil
-	})
+	}
+	err = filepath.Walk(root, walk)
 	if err != nil {
-		log.Printf("Warning: File access error during recursive search. %v", err)
+		warnf("Warning: File access error during recursive search. %v", err)
 	}
 
 	anyErrors := make(chan bool, 1)
 
-	// This goroutine prints any errors that into the lintErrors channel.
+	// When streaming, ungrouped text output is printed as the errors arrive.
+	// Otherwise everything is collected, sorted, and written once all processing is complete.
+	// Fixing doesn't stream, since the problems fixed across files are only left out once every file is checked.
+	stream := *streamFlag && *formatFlag == "text" && *groupByFlag == "" && !*fixFlag
+
+	// The problems fixed once every file has been checked, which are read once lintErrors is closed.
+	var fixedProblems map[fixedProblem]bool
+
+	// This goroutine handles any errors sent into the lintErrors channel.
 	go func() {
 		tripwire := false
-		for pe := range lintErrors {
-			fmt.Printf("%v: %v\n", relPath(pe.path, root), pe.err)
-			tripwire = true
+		var collected []diagnostic
+		for d := range lintErrors {
+			if !ruleEnabled(d.Rule) {
+				continue
+			}
+			if *errorsOnlyFlag && d.Severity() != severityError {
+				continue
+			}
+			if stream {
+				fmt.Fprintln(out, textLine(d, root, color))
+			}
+			collected = append(collected, d)
 		}
+		var kept []diagnostic
+		for _, d := range collected {
+			if fixedProblems[fixedProblem{d.Path, d.Line, d.Column, d.Rule}] {
+				continue
+			}
+			kept = append(kept, d)
+			if d.Severity() == severityError {
+				tripwire = true
+			}
+		}
+		collected = kept
 
-		// If even one error happened, pass false back to the parent thread.
+		r := report{root: root, files: files, diagnostics: collected, color: color, template: tmpl}
+		if !stream {
+			sortDiagnostics(r.diagnostics)
+			if *groupByFlag != "" {
+				groupDiagnostics(r.diagnostics, *groupByFlag)
+				r.groupBy = *groupByFlag
+			}
+			err := format(out, r)
+			if err != nil {
+				log.Printf("Error: Unable to write %v output. %v", *formatFlag, err)
+			}
+		}
+		if *summaryFlag {
+			writeSummary(os.Stderr, r, time.Since(start))
+		}
+
+		// If even one error happened, pass true back to the parent thread.
 		if tripwire {
 			anyErrors <- true
 		} else {
@@ -144,31 +646,79 @@ func main() {
 		}
 	}()
 
-	// Wait for the processing goroutines to finish.
+	// Wait for the processing goroutines to finish,
+	// then run the checks which look across the whole repository.
 	wg.Wait()
+	for _, c := range crossChecks {
+		c(repo, lintErrors)
+	}
+	// Fixes which span files, like renaming labels, can only be made once every file has been indexed,
+	// so the problems they fix have already been found, and are left out of the report.
+	// When previewing, they're made to the content the other fixes left, and each file's fixes are written as one diff.
+	if *fixFlag && *diffFlag {
+		runCrossFixers(repo, preview, nil)
+		if err := preview.write(os.Stdout, root); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	} else if *fixFlag {
+		fixedProblems = runCrossFixers(repo, nil, prompt)
+	}
 	close(lintErrors)
+	if *crossManualReportFlag != "" {
+		if err := saveCrossManualReport(*crossManualReportFlag, repo); err != nil {
+			log.Printf("Error: Unable to write the cross-manual report. %v", err)
+		}
+	}
 
 	// If any errors occurred, exit with a 1 error code.
 	wasThereErrors := <-anyErrors
+	if *outputFlag != "" {
+		if err := out.Close(); err != nil {
+			log.Fatalf("Error: Unable to write output file. %v", err)
+		}
+	}
 	if wasThereErrors {
 		os.Exit(1)
 	}
 }
 
-func check(path string, info os.FileInfo, wg *sync.WaitGroup, lintErrors chan<- pathError) {
+func check(path string, info os.FileInfo, wg *sync.WaitGroup, lintErrors chan<- diagnostic) {
 	defer wg.Done()
 	err := checkFileType(path, info)
 	if err != nil {
-		lintErrors <- pathError{path: path, err: err}
+		lintErrors <- diagnostic{Path: path, Rule: ruleFileType, Message: err.Error()}
+	}
+	if filepath.Ext(path) == ".rst" || isImage(path) {
+		err = checkFilename(info, filenamePattern)
+		if err != nil {
+			lintErrors <- diagnostic{Path: path, Rule: ruleFilename, Message: err.Error()}
+		}
+	}
+	err = checkImagesPlacement(path, info, repo.root)
+	if err != nil {
+		lintErrors <- diagnostic{Path: path, Rule: ruleImagesPlacement, Message: err.Error()}
 	}
 	if filepath.Ext(path) == ".rst" {
 		err = checkRstInChapters(path, info)
 		if err != nil {
-			lintErrors <- pathError{path: path, err: err}
+			lintErrors <- diagnostic{Path: path, Rule: ruleChapters, Message: err.Error()}
+		}
+		err = checkDepth(path, repo.root, *maxDepthFlag)
+		if err != nil {
+			lintErrors <- diagnostic{Path: path, Rule: ruleDepth, Message: err.Error()}
+		}
+		if *fixFlag {
+			fixes, err := fixFile(path, repo.root, preview, prompt)
+			if err != nil {
+				log.Printf("Error: %v", err)
+			}
+			if preview == nil {
+				writeFixes(os.Stderr, path, repo.root, fixes)
+			}
 		}
 		err = checkFileContent(path, lintErrors)
 		if err != nil {
-			lintErrors <- pathError{path: path, err: err}
+			lintErrors <- diagnostic{Path: path, Rule: ruleRead, Message: err.Error()}
 		}
 	}
 }
@@ -217,64 +767,231 @@ func checkRstInChapters(path string, info os.FileInfo) error {
 	return errors.New("Not found in chapter directory.")
 }
 
-func checkFileContent(path string, lintErrors chan<- pathError) error {
-	f, err := os.Open(path)
+// checkImagesPlacement ensures that images directories are only found directly
+// inside chapter directories, which are the directories inside each manual.
+func checkImagesPlacement(path string, info os.FileInfo, root string) error {
+	if !info.IsDir() || info.Name() != "images" {
+		return nil
+	}
+	if len(relParts(path, root)) == 3 {
+		return nil
+	}
+	return errors.New("Images directory not found directly inside a chapter directory.")
+}
+
+// checkSymlink applies the symlinks policy to the symbolic link at path, returning where it points,
+// whether it should be followed, and any problem found. Links are only followed when the policy is
+// "follow", and never when they're broken or point outside root.
+func checkSymlink(path, root, policy string) (string, bool, *diagnostic) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", false, &diagnostic{Path: path, Rule: ruleSymlink, Message: "Symbolic link is broken."}
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		realRoot = root
+	}
+	rel, err := filepath.Rel(realRoot, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return target, false, &diagnostic{Path: path, Rule: ruleSymlink, Message: "Symbolic link points outside of the repository."}
+	}
+	switch policy {
+	case "follow":
+		return target, true, nil
+	case "warn":
+		return target, false, &diagnostic{Path: path, Rule: ruleSymlink, Message: "Symbolic link found, it won't be checked.",
+			severity: severityWarning}
+	}
+	return target, false, &diagnostic{Path: path, Rule: ruleSymlink, Message: "Symbolic links aren't allowed."}
+}
+
+// checkFilename ensures the name of a file matches pattern.
+func checkFilename(info os.FileInfo, pattern *regexp.Regexp) error {
+	if info.IsDir() || pattern.MatchString(info.Name()) {
+		return nil
+	}
+	return fmt.Errorf("Filename doesn't match the pattern %v.", pattern)
+}
+
+// checkDepth ensures reST files aren't nested more than maxDepth levels below root,
+// counting the file itself. A maxDepth of 0 allows any depth.
+func checkDepth(path, root string, maxDepth int) error {
+	depth := len(relParts(path, root))
+	if maxDepth <= 0 || depth <= maxDepth {
+		return nil
+	}
+	return fmt.Errorf("Nested %v levels deep, more than the maximum of %v.", depth, maxDepth)
+}
+
+// checkFileContent runs each of the content checks over the lines of the file at path.
+func checkFileContent(path string, lintErrors chan<- diagnostic) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	anchorLines := make(chan string)
-	anchorError := make(chan error, 1)
-	go checkAnchors(anchorLines, anchorError)
+	// The checks don't know which file they're reading,
+	// so fill in the path of any problems they find.
+	found := make(chan diagnostic)
+	forwarded := make(chan struct{})
+	go func() {
+		for d := range found {
+			d.Path = path
+			lintErrors <- d
+		}
+		close(forwarded)
+	}()
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		anchorLines <- scanner.Text()
+	// Each check runs in its own goroutine, and is sent every line of the file.
+	var wg sync.WaitGroup
+	inputs := make([]chan line, len(contentChecks))
+	for i, c := range contentChecks {
+		inputs[i] = make(chan line)
+		wg.Add(1)
+		go func(c contentCheck, lines <-chan line) {
+			defer wg.Done()
+			c(path, lines, found)
+		}(c, inputs[i])
 	}
-	close(anchorLines)
-	err, errValid := <-anchorError
-	if errValid {
-		lintErrors <- pathError{path: path, err: err}
+
+	for _, l := range splitLines(data) {
+		for _, input := range inputs {
+			input <- l
+		}
 	}
-	if err := scanner.Err(); err != nil {
-		return err
+	for _, input := range inputs {
+		close(input)
 	}
+	wg.Wait()
+	close(found)
+	<-forwarded
 	return nil
 }
 
-// checkAnchors ensures all pages begin with an anchor and have a back to the top link
-// at the bottom of the page, which refers to the page anchor.
-func checkAnchors(lines <-chan string, errC chan<- error) {
-	defer close(errC)
-	firstLine := true
-	foundAnchor := false
-	matchingAnchor := false
+// pageAnchor returns the name of the anchor on text, if it's a line like ".. _name:".
+func pageAnchor(text string) (string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 2 &&
+		fields[0] == ".." &&
+		fields[1][0:1] == "_" &&
+		fields[1][len(fields[1])-1:] == ":" {
+		return fields[1][1 : len(fields[1])-1], true
+	}
+	return "", false
+}
+
+// checkAnchors ensures all pages begin with an anchor, or as many anchors as the page-anchors flag allows,
+// followed by a blank line, and end with a back to the top link, which refers to the first anchor.
+func checkAnchors(path string, lines <-chan line, diags chan<- diagnostic) {
+	// Whether the anchors at the top of the page are being read, and the number found.
+	top := true
+	anchors := 0
 	anchorText := ""
-	for line := range lines {
-		fields := strings.Fields(line)
-		if firstLine {
-			if len(fields) == 2 &&
-				fields[0] == ".." &&
-				fields[1][0:1] == "_" &&
-				fields[1][len(fields[1])-1:] == ":" {
-				anchorText = fields[1][1 : len(fields[1])-1]
-				foundAnchor = true
-			}
-			firstLine = false
+	lastLine := 0
+	// The last line with a back to the top link, and the last line which isn't blank.
+	linkLine := 0
+	lastText := 0
+	var previous line
+	for l := range lines {
+		lastLine = l.num
+		blank := strings.TrimSpace(l.text) == ""
+		if !blank {
+			lastText = l.num
 		}
-		if foundAnchor {
-			if !matchingAnchor {
-				if line == fmt.Sprintf(":ref:`Back to the top <%v>`", anchorText) {
-					matchingAnchor = true
+		if top {
+			if name, ok := pageAnchor(l.text); ok && (anchors > 0 || l.num == 1) {
+				anchors++
+				if anchors == 1 {
+					anchorText = name
+				} else if anchors > *pageAnchorsFlag {
+					diags <- diagnostic{Line: l.num, Column: 1, Rule: ruleAnchors,
+						Message: fmt.Sprintf("Page has more than %v anchors at the top.", *pageAnchorsFlag)}
+				}
+			} else if !blank || anchors == 0 {
+				top = false
+				if _, ok := pageAnchor(previous.text); ok && anchors > 0 {
+					// Without a blank line, Sphinx attaches the label to the wrong node.
+					diags <- diagnostic{Line: l.num, Column: 1, Rule: ruleAnchors, Message: "Anchor at top of page isn't followed by a blank line."}
 				}
 			}
 		}
+		previous = l
+		if anchors > 0 && l.text == fmt.Sprintf(":ref:`Back to the top <%v>`", anchorText) {
+			linkLine = l.num
+		}
 	}
-	if !foundAnchor {
-		errC <- errors.New("Anchor not found at top of page.")
-	} else if !matchingAnchor {
-		errC <- errors.New("'Back to top' link to anchor not found.")
+	switch {
+	case anchors == 0:
+		diags <- diagnostic{Line: 1, Column: 1, Rule: ruleAnchors, Message: "Anchor not found at top of page."}
+	case linkLine == 0:
+		diags <- diagnostic{Line: lastLine, Column: 1, Rule: ruleAnchors, Message: "'Back to top' link to the first anchor not found."}
+	case linkLine != lastText:
+		diags <- diagnostic{Line: linkLine, Column: 1, Rule: ruleAnchors,
+			Message: fmt.Sprintf("'Back to top' link is on line %v, but should be the last line of the page.", linkLine)}
+	}
+}
+
+// defaultAnchorConvention is the convention anchors inserted by fixAnchors follow, when no anchor convention is given.
+const defaultAnchorConvention = "<manual>-<chapter>-<page>"
+
+// fixAnchors inserts an anchor at the top of pages which don't begin with one, named after the page
+// following the anchor convention, followed by a blank line.
+func fixAnchors(path string, lines []line) ([]line, []fix) {
+	if len(lines) > 0 {
+		if _, ok := pageAnchor(lines[0].text); ok {
+			return lines, nil
+		}
+	}
+	convention := *anchorConventionFlag
+	if convention == "" {
+		convention = defaultAnchorConvention
+	}
+	name := conventionalAnchor(path, repo.root, convention)
+	eol := "\n"
+	if len(lines) > 0 && lines[0].eol != "" {
+		eol = lines[0].eol
+	}
+	inserted := []line{{text: fmt.Sprintf(".. _%v:", name), eol: eol}, {eol: eol}}
+	return append(inserted, lines...), []fix{{line: 1, message: fmt.Sprintf("Inserted anchor %q at the top of the page.", name)}}
+}
+
+// fixBackToTop appends a back to the top link referring to the first anchor to pages which begin
+// with an anchor but have no such link, separated from the page by a transition.
+func fixBackToTop(path string, lines []line) ([]line, []fix) {
+	if len(lines) == 0 {
+		return lines, nil
+	}
+	name, ok := pageAnchor(lines[0].text)
+	if !ok {
+		return lines, nil
+	}
+	link := fmt.Sprintf(":ref:`Back to the top <%v>`", name)
+	for _, l := range lines {
+		if l.text == link {
+			return lines, nil
+		}
+	}
+
+	eol := lines[0].eol
+	if eol == "" {
+		eol = "\n"
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1].text) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	lines[len(lines)-1].eol = eol
+	last := strings.TrimSpace(lines[len(lines)-1].text)
+	if len(last) < 4 || strings.Trim(last, "-") != "" {
+		lines = append(lines, line{eol: eol}, line{text: "----", eol: eol})
+	}
+	lines = append(lines, line{eol: eol}, line{text: link, eol: eol})
+	return lines, []fix{{line: len(lines), message: "Appended a 'Back to top' link to the first anchor."}}
+}
+
+// warnf logs a warning about file access, unless the quiet flag is set.
+func warnf(format string, v ...interface{}) {
+	if !*quietFlag {
+		log.Printf(format, v...)
 	}
 }
 
@@ -283,7 +1000,43 @@ func relPath(path, root string) string {
 	return fmt.Sprintf(".%v", strings.TrimPrefix(path, root))
 }
 
+// Split a path into its elements below root.
+func relParts(path, root string) []string {
+	return strings.Split(strings.TrimPrefix(filepath.ToSlash(relPath(path, root)), "./"), "/")
+}
+
+// Get the name of the manual a path is in, which is the first directory below root.
+// Paths directly in root are in no manual, so the empty string is returned.
+func manual(path, root string) string {
+	rel := relParts(path, root)
+	if len(rel) < 2 {
+		return ""
+	}
+	return rel[0]
+}
+
 // Get the name of the directory above the end of the path.
 func parent(path string) string {
 	return filepath.Base(filepath.Dir(path))
 }
+
+// contains reports whether s is one of list.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a flag's comma separated list, ignoring surrounding whitespace and empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
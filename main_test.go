@@ -1,9 +1,56 @@
 package main
 
 import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 )
 
+// runMainEnv is set in the environment of the test binary when runTool runs it as the tool.
+const runMainEnv = "DOCMATICA_RUN_MAIN"
+
+// TestMain runs the tool instead of the tests when the test binary is run by runTool.
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runTool runs the tool over the repository at root with the flags args, like it's run from the command line,
+// returning what it writes to stdout and stderr.
+func runTool(t *testing.T, root string, args ...string) (string, string) {
+	cmd := exec.Command(os.Args[0], append([]string{"-path", root}, args...)...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			t.Fatal(err)
+		}
+	}
+	return stdout.String(), stderr.String()
+}
+
+// writeTree writes the files of a repository in root, by their paths relative to it.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestRelPath(t *testing.T) {
 
 	testTable := []struct {
@@ -43,3 +90,363 @@ func TestParent(t *testing.T) {
 	}
 
 }
+
+func TestManual(t *testing.T) {
+
+	testTable := []struct {
+		path     string
+		root     string
+		expected string
+	}{
+		{"/a/user-manual/transfer/transfer.rst", "/a", "user-manual"},
+		{"/a/user-manual/index.rst", "/a", "user-manual"},
+		{"/a/index.rst", "/a", ""},
+	}
+
+	for _, r := range testTable {
+		result := manual(r.path, r.root)
+		if result != r.expected {
+			t.Errorf("manual(%v, %v) -> %v, not %v", r.path, r.root, result, r.expected)
+		}
+	}
+
+}
+
+// fileInfo is a minimal os.FileInfo for testing the checks of files and directories.
+type fileInfo struct {
+	name string
+	dir  bool
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return 0 }
+func (fi fileInfo) Mode() os.FileMode  { return 0 }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+func TestCheckImagesPlacement(t *testing.T) {
+
+	testTable := []struct {
+		path     string
+		dir      bool
+		expected bool
+	}{
+		{"/a/user-manual/transfer/images", true, true},
+		{"/a/images", true, false},
+		{"/a/user-manual/images", true, false},
+		{"/a/user-manual/transfer/extra/images", true, false},
+		{"/a/user-manual/images", false, true},
+	}
+
+	for _, r := range testTable {
+		err := checkImagesPlacement(r.path, fileInfo{name: filepath.Base(r.path), dir: r.dir}, "/a")
+		if (err == nil) != r.expected {
+			t.Errorf("checkImagesPlacement(%v) -> %v, expected valid: %v", r.path, err, r.expected)
+		}
+	}
+
+}
+
+func TestCheckDepth(t *testing.T) {
+
+	testTable := []struct {
+		path     string
+		maxDepth int
+		expected bool
+	}{
+		{"/a/user-manual/transfer/transfer.rst", 3, true},
+		{"/a/user-manual/transfer/sub/page.rst", 3, false},
+		{"/a/user-manual/transfer/sub/page.rst", 4, true},
+		{"/a/user-manual/transfer/sub/page.rst", 0, true},
+	}
+
+	for _, r := range testTable {
+		err := checkDepth(r.path, "/a", r.maxDepth)
+		if (err == nil) != r.expected {
+			t.Errorf("checkDepth(%v, /a, %v) -> %v, expected valid: %v", r.path, r.maxDepth, err, r.expected)
+		}
+	}
+
+}
+
+func TestCheckFilename(t *testing.T) {
+
+	pattern := regexp.MustCompile(*filenamePatternFlag)
+	testTable := []struct {
+		name     string
+		expected bool
+	}{
+		{"index.rst", true},
+		{"transfer-import.rst", true},
+		{"dashboard-1.png", true},
+		{"Transfer.rst", false},
+		{"transfer_import.rst", false},
+		{"transfer import.png", false},
+		{"transfer--import.rst", false},
+	}
+
+	for _, r := range testTable {
+		err := checkFilename(fileInfo{name: r.name}, pattern)
+		if (err == nil) != r.expected {
+			t.Errorf("checkFilename(%v) -> %v, expected valid: %v", r.name, err, r.expected)
+		}
+	}
+
+}
+
+func TestSplitLines(t *testing.T) {
+
+	testTable := []struct {
+		data     string
+		expected []line
+	}{
+		{"", nil},
+		{"a\nb\n", []line{{1, "a", "\n", 0}, {2, "b", "\n", 2}}},
+		{"a\r\nb", []line{{1, "a", "\r\n", 0}, {2, "b", "", 3}}},
+		{"\n\n", []line{{1, "", "\n", 0}, {2, "", "\n", 1}}},
+	}
+
+	for _, r := range testTable {
+		result := splitLines([]byte(r.data))
+		if len(result) != len(r.expected) {
+			t.Errorf("splitLines(%q) -> %v, not %v", r.data, result, r.expected)
+			continue
+		}
+		for i := range result {
+			if result[i] != r.expected[i] {
+				t.Errorf("splitLines(%q) line %v -> %v, not %v", r.data, i+1, result[i], r.expected[i])
+			}
+		}
+	}
+
+}
+
+// runContentCheck runs c over the lines of text, as if read from path, returning the problems found.
+func runContentCheck(c contentCheck, path, text string) []diagnostic {
+	lines := make(chan line)
+	diags := make(chan diagnostic)
+	go func() {
+		for _, l := range splitLines([]byte(text)) {
+			lines <- l
+		}
+		close(lines)
+	}()
+	go func() {
+		c(path, lines, diags)
+		close(diags)
+	}()
+	var found []diagnostic
+	for d := range diags {
+		found = append(found, d)
+	}
+	return found
+}
+
+func TestCheckAnchors(t *testing.T) {
+
+	defer func(anchors int) { *pageAnchorsFlag = anchors }(*pageAnchorsFlag)
+	*pageAnchorsFlag = 2
+	testTable := []struct {
+		text         string
+		expectedLine int
+	}{
+		{".. _a:\n\nTitle\n=====\n\n:ref:`Back to the top <a>`", 0},
+		{".. _a:\n.. _old-a:\n\nTitle\n=====\n\n:ref:`Back to the top <a>`", 0},
+		{".. _a:\n.. _old-a:\n\nTitle\n=====\n\n:ref:`Back to the top <old-a>`", 7},
+		{".. _a:\n\n.. _old-a:\n.. _older-a:\n\nTitle\n=====\n\n:ref:`Back to the top <a>`", 4},
+		{".. _a:\n.. _old-a:\nTitle\n=====\n\n:ref:`Back to the top <a>`", 3},
+		{"Title\n=====", 1},
+		{".. _a:\n\nTitle\n=====\n\n:ref:`Back to the top <b>`", 6},
+		{".. _a:\nTitle\n=====\n\n:ref:`Back to the top <a>`", 2},
+		{".. _a:\n\nTitle\n=====\n\nText.\n\n----\n\n:ref:`Back to the top <a>`\n\n", 0},
+		{".. _a:\n\nTitle\n=====\n\n:ref:`Back to the top <a>`\n\nMore text.", 6},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkAnchors, "/a/b/c.rst", r.text)
+		if r.expectedLine == 0 {
+			if len(found) != 0 {
+				t.Errorf("checkAnchors(%q) -> %v, expected no problems", r.text, found)
+			}
+			continue
+		}
+		if len(found) != 1 || found[0].Line != r.expectedLine {
+			t.Errorf("checkAnchors(%q) -> %v, expected one problem on line %v", r.text, found, r.expectedLine)
+		}
+	}
+
+}
+
+func TestFixAnchors(t *testing.T) {
+
+	defer func(convention string) { *anchorConventionFlag = convention }(*anchorConventionFlag)
+	defer func(r *index) { repo = r }(repo)
+	repo = &index{root: "/a"}
+	testTable := []struct {
+		convention string
+		text       string
+		expected   string
+	}{
+		{"", "Title\n=====\n", ".. _user-transfer-import:\n\nTitle\n=====\n"},
+		{"<chapter>-<page>", "Title\r\n=====\r\n", ".. _transfer-import:\r\n\r\nTitle\r\n=====\r\n"},
+		{"", ".. _import:\n\nTitle\n=====\n", ".. _import:\n\nTitle\n=====\n"},
+		{"", "", ".. _user-transfer-import:\n\n"},
+	}
+
+	for _, r := range testTable {
+		*anchorConventionFlag = r.convention
+		result, fixes := runFix(fixAnchors, "/a/user-manual/transfer/import.rst", r.text)
+		if result != r.expected || (len(fixes) == 1) != (r.text != r.expected) {
+			t.Errorf("fixAnchors(%q) -> %q with fixes %v, not %q", r.text, result, fixes, r.expected)
+		}
+	}
+
+}
+
+func TestFixBackToTop(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected string
+	}{
+		{".. _a:\n\nTitle\n=====\n\nText.\n\n\n", ".. _a:\n\nTitle\n=====\n\nText.\n\n----\n\n:ref:`Back to the top <a>`\n"},
+		{".. _a:\r\n\r\nText.", ".. _a:\r\n\r\nText.\r\n\r\n----\r\n\r\n:ref:`Back to the top <a>`\r\n"},
+		{".. _a:\n\nText.\n\n----\n", ".. _a:\n\nText.\n\n----\n\n:ref:`Back to the top <a>`\n"},
+		{".. _a:\n\n:ref:`Back to the top <a>`\n\nText.\n", ".. _a:\n\n:ref:`Back to the top <a>`\n\nText.\n"},
+		{"Title\n=====\n", "Title\n=====\n"},
+	}
+
+	for _, r := range testTable {
+		result, fixes := runFix(fixBackToTop, "/a/b/c.rst", r.text)
+		if result != r.expected || (len(fixes) == 1) != (r.text != r.expected) {
+			t.Errorf("fixBackToTop(%q) -> %q with fixes %v, not %q", r.text, result, fixes, r.expected)
+		}
+	}
+
+}
+
+func TestCheckSymlink(t *testing.T) {
+
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "chapter"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"inside":  filepath.Join(root, "chapter"),
+		"outside": outside,
+		"broken":  filepath.Join(root, "missing"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("Unable to create symbolic links: %v", err)
+		}
+	}
+
+	testTable := []struct {
+		name     string
+		policy   string
+		follow   bool
+		severity severity
+	}{
+		{"inside", "follow", true, 0},
+		{"inside", "warn", false, severityWarning},
+		{"inside", "forbid", false, severityError},
+		{"outside", "follow", false, severityError},
+		{"broken", "follow", false, severityError},
+	}
+
+	for _, r := range testTable {
+		_, follow, d := checkSymlink(filepath.Join(root, r.name), root, r.policy)
+		if follow != r.follow {
+			t.Errorf("checkSymlink(%v, %v) followed: %v, expected %v", r.name, r.policy, follow, r.follow)
+		}
+		if r.severity == 0 && d != nil {
+			t.Errorf("checkSymlink(%v, %v) -> %v, expected no problem", r.name, r.policy, d)
+		}
+		if r.severity != 0 && (d == nil || d.Severity() != r.severity) {
+			t.Errorf("checkSymlink(%v, %v) -> %v, expected a problem with severity %v", r.name, r.policy, d, r.severity)
+		}
+	}
+
+}
+
+func TestConfInArchivematicaDocs(t *testing.T) {
+
+	// In archivematica-docs, conf.py is left out of the walk, but still configures the checks.
+	root := filepath.Join(t.TempDir(), "archivematica-docs")
+	writeTree(t, root, map[string]string{
+		"conf.py":                 "extensions = []\nrst_epilog = \"\"\"\n.. |product| replace:: Archivematica\n\"\"\"\n",
+		"manual/chapter/page.rst": "|product|\n\n.. todo:: Finish this page.\n",
+	})
+
+	stdout, stderr := runTool(t, root, "-summary")
+	if strings.Contains(stdout, "Substitution |product| isn't defined.") {
+		t.Errorf("The tool reported %q, expected |product| to be defined by conf.py", stdout)
+	}
+	if !strings.Contains(stdout, "page.rst:3: Directive \"todo\" needs the sphinx.ext.todo extension") {
+		t.Errorf("The tool reported %q, expected the todo directive to need its extension", stdout)
+	}
+	if strings.Contains(stdout, "conf.py") {
+		t.Errorf("The tool reported %q, expected conf.py not to be checked", stdout)
+	}
+	if !strings.HasPrefix(stderr, "Scanned 1 files") {
+		t.Errorf("The tool summarized %q, expected only the page to be scanned", stderr)
+	}
+
+}
+
+func TestFixDiffApplies(t *testing.T) {
+
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git isn't available to apply the diff")
+	}
+	root := filepath.Join(t.TempDir(), "archivematica-docs")
+	writeTree(t, root, map[string]string{
+		"manual/chapter/page.rst": "Title  \r\n=\r\n\r\n\r\n\r\n\r\nText\tafter tab",
+		// Fixed both as it's read, and once every file has been checked.
+		"manual/chapter/links.rst": "Links\n====\n\nSee http://www.archivematica.org/.\n",
+	})
+
+	stdout, stderr := runTool(t, root, "-fix", "-diff")
+	if !strings.HasPrefix(stdout, "--- a/manual/chapter/links.rst\n") || strings.Count(stdout, "--- a/manual/chapter/links.rst\n") != 1 {
+		t.Fatalf("The tool printed %q to stdout, expected only the diff", stdout)
+	}
+	if !strings.Contains(stderr, "page.rst:1: Anchor not found at top of page.") {
+		t.Errorf("The tool printed %q to stderr, expected the report", stderr)
+	}
+
+	cmd := exec.Command(git, "apply", "-p1", "-")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(stdout)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git apply failed on the diff %q: %v %s", stdout, err, output)
+	}
+	if stdout, _ := runTool(t, root, "-fix", "-diff"); stdout != "" {
+		t.Errorf("The tool printed the diff %q once the first diff was applied, expected nothing left to fix", stdout)
+	}
+
+}
+
+func TestFixKeepsUnfixedProblems(t *testing.T) {
+
+	// Only the first of the links on the line is changed, so the second is still reported.
+	root := filepath.Join(t.TempDir(), "archivematica-docs")
+
+	// Streaming is ignored, since the fixed link is only known once every file is checked.
+	for _, stream := range []string{"-stream=false", "-stream"} {
+		writeTree(t, root, map[string]string{
+			"manual/chapter/page.rst": "See http://www.archivematica.org/a and http://unknown-host.test/b.\n",
+		})
+		stdout, _ := runTool(t, root, "-https-domains", "archivematica.org,unknown-host.test", "-fix", stream)
+		if strings.Contains(stdout, "Link \"http://www.archivematica.org/a\" should use HTTPS.") {
+			t.Errorf("The tool reported %q with %v, expected the fixed link to be left out", stdout, stream)
+		}
+		if !strings.Contains(stdout, "Link \"http://unknown-host.test/b\" should use HTTPS.") {
+			t.Errorf("The tool reported %q with %v, expected the link which wasn't fixed", stdout, stream)
+		}
+	}
+
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// A report holds the results of a run, for a formatter to write.
+// Paths are reported relative to root.
+type report struct {
+	root        string
+	files       []string
+	diagnostics []diagnostic
+	// Whether text output should be colored.
+	color bool
+	// How the diagnostics are grouped. One of "", "file" or "rule".
+	groupBy string
+	// The template used by the template format.
+	template *template.Template
+}
+
+// A formatter writes a report to w.
+type formatter func(w io.Writer, r report) error
+
+// The output formats which can be selected with the format flag.
+var formatters = map[string]formatter{
+	"text":     writeText,
+	"gitlab":   writeGitLab,
+	"tap":      writeTAP,
+	"rdjson":   writeRDJSON,
+	"html":     writeHTML,
+	"markdown": writeMarkdown,
+	"csv":      writeCSV,
+	"compiler": writeCompiler,
+	"template": writeTemplate,
+}
+
+// formatNames lists the available output formats, sorted.
+func formatNames() string {
+	var names []string
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// writeSummary writes the scope of the run and how many problems each rule found.
+func writeSummary(w io.Writer, r report, elapsed time.Duration) {
+	withProblems := make(map[string]bool)
+	perRule := make(map[string]int)
+	for _, d := range r.diagnostics {
+		withProblems[d.Path] = true
+		perRule[d.Rule]++
+	}
+
+	fmt.Fprintf(w, "Scanned %v files in %v, %v with problems.\n",
+		len(r.files), elapsed.Round(time.Millisecond), len(withProblems))
+
+	var ids []string
+	for id := range perRule {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(w, "  %v %v: %v\n", id, rules[id].name, perRule[id])
+	}
+}
+
+// ANSI escape sequences used to color text output.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+)
+
+// useColor decides whether text output written to f should be colored,
+// based on the value of the color flag.
+func useColor(mode string, f *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return false, nil
+		}
+		return info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("Unknown color mode %q, expected one of: auto, always, never.", mode)
+}
+
+// textLine formats a diagnostic for text output,
+// located by its path relative to root and its line.
+func textLine(d diagnostic, root string, color bool) string {
+	location := relPath(d.Path, root)
+	if d.Line > 0 {
+		location = fmt.Sprintf("%v:%v", location, d.Line)
+	}
+	return textMessage(location, d, color)
+}
+
+// textMessage formats a diagnostic at location. When color is true the location is bold,
+// and the message is red for errors and yellow for warnings.
+func textMessage(location string, d diagnostic, color bool) string {
+	if !color {
+		return fmt.Sprintf("%v: %v", location, d.Message)
+	}
+	messageColor := ansiRed
+	if d.Severity() == severityWarning {
+		messageColor = ansiYellow
+	}
+	return fmt.Sprintf("%v%v%v: %v%v%v", ansiBold, location, ansiReset, messageColor, d.Message, ansiReset)
+}
+
+// sortDiagnostics puts the diagnostics in a deterministic order,
+// by path, then position, then rule and message.
+func sortDiagnostics(diags []diagnostic) {
+	sort.Slice(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Message < b.Message
+	})
+}
+
+// groupDiagnostics sorts the diagnostics so those for the same file, or the same rule,
+// are together. Within a group, the order they were found in is kept.
+func groupDiagnostics(diags []diagnostic, by string) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		if by == "rule" {
+			return diags[i].Rule < diags[j].Rule
+		}
+		return diags[i].Path < diags[j].Path
+	})
+}
+
+// writeText writes one line per diagnostic. When the report is grouped,
+// each group starts with a heading naming the file or rule.
+// Within a file group, diagnostics are located by line alone.
+func writeText(w io.Writer, r report) error {
+	group := ""
+	for _, d := range r.diagnostics {
+		l := textLine(d, r.root, r.color)
+		switch r.groupBy {
+		case "file":
+			if d.Path != group {
+				group = d.Path
+				fmt.Fprintln(w, textHeading(relPath(d.Path, r.root), r.color))
+			}
+			location := "file"
+			if d.Line > 0 {
+				location = fmt.Sprintf("line %v", d.Line)
+			}
+			l = "  " + textMessage(location, d, r.color)
+		case "rule":
+			if d.Rule != group {
+				group = d.Rule
+				fmt.Fprintln(w, textHeading(fmt.Sprintf("%v %v", d.Rule, rules[d.Rule].name), r.color))
+			}
+			l = "  " + l
+		}
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// textHeading formats the heading of a group of diagnostics.
+func textHeading(heading string, color bool) string {
+	if !color {
+		return heading
+	}
+	return ansiBold + heading + ansiReset
+}
+
+// manualGroup holds the diagnostics for files in one manual.
+type manualGroup struct {
+	name        string
+	diagnostics []diagnostic
+}
+
+// groupByManual splits the diagnostics by manual, keeping the order
+// manuals first appear in. Files outside any manual are grouped as "Top level".
+func groupByManual(diags []diagnostic, root string) []*manualGroup {
+	var groups []*manualGroup
+	byName := make(map[string]*manualGroup)
+	for _, d := range diags {
+		name := manual(d.Path, root)
+		if name == "" {
+			name = "Top level"
+		}
+		g, ok := byName[name]
+		if !ok {
+			g = &manualGroup{name: name}
+			byName[name] = g
+			groups = append(groups, g)
+		}
+		g.diagnostics = append(g.diagnostics, d)
+	}
+	return groups
+}
+
+// writeMarkdown writes a table of the diagnostics for each manual,
+// suitable for pasting into an issue or pull request.
+func writeMarkdown(w io.Writer, r report) error {
+	fmt.Fprintln(w, "# Docmatica report")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%v files checked, %v problems found.\n", len(r.files), len(r.diagnostics))
+	for _, g := range groupByManual(r.diagnostics, r.root) {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "## %v\n", g.name)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| File | Line | Rule | Severity | Message |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | --- |")
+		for _, d := range g.diagnostics {
+			line := ""
+			if d.Line > 0 {
+				line = fmt.Sprint(d.Line)
+			}
+			_, err := fmt.Fprintf(w, "| `%v` | %v | [%v](%v) | %v | %v |\n",
+				reportPath(d.Path, r.root), line, d.Rule, ruleURL(d.Rule), d.Severity(), markdownEscape(d.Message))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// markdownEscape escapes text so it can be placed in a Markdown table cell.
+func markdownEscape(text string) string {
+	return strings.NewReplacer("|", "\\|", "`", "\\`", "*", "\\*", "_", "\\_", "<", "&lt;").Replace(text)
+}
+
+// writeCSV writes a header row, then a row per diagnostic.
+func writeCSV(w io.Writer, r report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"path", "line", "rule", "severity", "message"})
+	for _, d := range r.diagnostics {
+		line := ""
+		if d.Line > 0 {
+			line = fmt.Sprint(d.Line)
+		}
+		cw.Write([]string{reportPath(d.Path, r.root), line, d.Rule, d.Severity().String(), d.Message})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeCompiler writes each diagnostic as "path:line:col: [rule] message",
+// which editors such as Vim and Emacs can parse to jump to the problem.
+// Problems with a whole file are reported at its first line.
+func writeCompiler(w io.Writer, r report) error {
+	for _, d := range r.diagnostics {
+		line, col := d.Line, d.Column
+		if line < 1 {
+			line = 1
+		}
+		if col < 1 {
+			col = 1
+		}
+		_, err := fmt.Fprintf(w, "%v:%v:%v: [%v] %v\n", reportPath(d.Path, r.root), line, col, d.Rule, d.Message)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTemplate executes the report's template for each diagnostic, each followed by a newline.
+// Paths are relative to the root, and the severity is available as .Severity.
+func writeTemplate(w io.Writer, r report) error {
+	for _, d := range r.diagnostics {
+		d.Path = reportPath(d.Path, r.root)
+		if err := r.template.Execute(w, d); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gitlabIssue is a single entry in a GitLab Code Quality report.
+// See https://docs.gitlab.com/ee/ci/testing/code_quality.html
+type gitlabIssue struct {
+	Description string         `json:"description"`
+	CheckName   string         `json:"check_name"`
+	Fingerprint string         `json:"fingerprint"`
+	Severity    string         `json:"severity"`
+	Location    gitlabLocation `json:"location"`
+}
+
+type gitlabLocation struct {
+	Path  string      `json:"path"`
+	Lines gitlabLines `json:"lines"`
+}
+
+type gitlabLines struct {
+	Begin int `json:"begin"`
+}
+
+// writeGitLab writes the errors as a GitLab Code Quality JSON artifact.
+// GitLab shows one issue per fingerprint, so the same problem found more than once in a file is told apart
+// by how many times it was found before, rather than by its line, which changes as the file is edited.
+func writeGitLab(w io.Writer, r report) error {
+	issues := []gitlabIssue{}
+	occurrences := make(map[[3]string]int)
+	for _, d := range r.diagnostics {
+		path := reportPath(d.Path, r.root)
+		key := [3]string{path, d.Rule, d.Message}
+		occurrence := occurrences[key]
+		occurrences[key]++
+		begin := d.Line
+		if begin < 1 {
+			begin = 1
+		}
+		issues = append(issues, gitlabIssue{
+			Description: d.Message,
+			CheckName:   d.Rule,
+			Fingerprint: fingerprint(path, d.Rule, d.Message, strconv.Itoa(occurrence)),
+			Severity:    gitlabSeverity(d.Severity()),
+			Location: gitlabLocation{
+				Path:  path,
+				Lines: gitlabLines{Begin: begin},
+			},
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(issues)
+}
+
+// writeTAP writes the report in the Test Anything Protocol, with one test point per file.
+// The errors for a failing file follow its test point as diagnostic comments.
+func writeTAP(w io.Writer, r report) error {
+	byPath := make(map[string][]diagnostic)
+	for _, d := range r.diagnostics {
+		byPath[d.Path] = append(byPath[d.Path], d)
+	}
+
+	fmt.Fprintln(w, "TAP version 13")
+	fmt.Fprintf(w, "1..%v\n", len(r.files))
+	for i, path := range r.files {
+		status := "ok"
+		if len(byPath[path]) > 0 {
+			status = "not ok"
+		}
+		fmt.Fprintf(w, "%v %v - %v\n", status, i+1, reportPath(path, r.root))
+		for _, d := range byPath[path] {
+			fmt.Fprintf(w, "# %v[%v] %v\n", tapLine(d), d.Rule, d.Message)
+		}
+	}
+
+	// Problems not tied to a found file, such as one for a directory, still need reporting.
+	found := make(map[string]bool)
+	for _, path := range r.files {
+		found[path] = true
+	}
+	for _, d := range r.diagnostics {
+		if !found[d.Path] {
+			_, err := fmt.Fprintf(w, "# %v: %v[%v] %v\n", reportPath(d.Path, r.root), tapLine(d), d.Rule, d.Message)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tapLine describes the line of a diagnostic for a TAP comment.
+func tapLine(d diagnostic) string {
+	if d.Line > 0 {
+		return fmt.Sprintf("line %v: ", d.Line)
+	}
+	return ""
+}
+
+// rdjsonResult is a Reviewdog Diagnostic Format result.
+// See https://github.com/reviewdog/reviewdog/tree/master/proto/rdf
+type rdjsonResult struct {
+	Source      rdjsonSource       `json:"source"`
+	Diagnostics []rdjsonDiagnostic `json:"diagnostics"`
+}
+
+type rdjsonSource struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type rdjsonDiagnostic struct {
+	Message     string             `json:"message"`
+	Location    rdjsonLocation     `json:"location"`
+	Severity    string             `json:"severity"`
+	Code        rdjsonCode         `json:"code"`
+	Suggestions []rdjsonSuggestion `json:"suggestions,omitempty"`
+}
+
+type rdjsonLocation struct {
+	Path  string       `json:"path"`
+	Range *rdjsonRange `json:"range,omitempty"`
+}
+
+type rdjsonRange struct {
+	Start rdjsonPosition  `json:"start"`
+	End   *rdjsonPosition `json:"end,omitempty"`
+}
+
+type rdjsonPosition struct {
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+type rdjsonCode struct {
+	Value string `json:"value"`
+}
+
+// rdjsonSuggestion replaces the text in Range with Text.
+type rdjsonSuggestion struct {
+	Range rdjsonRange `json:"range"`
+	Text  string      `json:"text"`
+}
+
+// writeRDJSON writes the report in the Reviewdog Diagnostic JSON format, with the fixes of the rules which have fixers
+// as suggestions, for reviewdog to suggest in pull request reviews.
+func writeRDJSON(w io.Writer, r report) error {
+	result := rdjsonResult{
+		Source:      rdjsonSource{Name: "docmatica", URL: "https://github.com/kevinbowrin/docmatica"},
+		Diagnostics: []rdjsonDiagnostic{},
+	}
+	fixes := make(map[[2]string][]hunk)
+	for _, d := range r.diagnostics {
+		location := rdjsonLocation{Path: reportPath(d.Path, r.root)}
+		if d.Line > 0 {
+			location.Range = &rdjsonRange{Start: rdjsonPosition{Line: d.Line, Column: d.Column}}
+		}
+		result.Diagnostics = append(result.Diagnostics, rdjsonDiagnostic{
+			Message:     d.Message,
+			Location:    location,
+			Severity:    strings.ToUpper(d.Severity().String()),
+			Code:        rdjsonCode{Value: d.Rule},
+			Suggestions: rdjsonSuggestions(d, fixes),
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// rdjsonSuggestions returns the changes the fixers of the rule of d make to the line it's on, suggested
+// as replacements of whole lines. The changes made to each file for each rule are kept in fixes, so they're made once.
+func rdjsonSuggestions(d diagnostic, fixes map[[2]string][]hunk) []rdjsonSuggestion {
+	if d.Line == 0 || !hasFixer(d.Rule) {
+		return nil
+	}
+	key := [2]string{d.Path, d.Rule}
+	hunks, ok := fixes[key]
+	if !ok {
+		if data, err := os.ReadFile(d.Path); err == nil {
+			hunks = ruleFixes(d.Path, d.Rule, data)
+		}
+		fixes[key] = hunks
+	}
+	var suggestions []rdjsonSuggestion
+	for _, h := range hunks {
+		if !h.changes(d.Line) {
+			continue
+		}
+		old, _ := h.lengths()
+		var text strings.Builder
+		for _, e := range h.edits {
+			if e.op != '-' {
+				text.WriteString(e.text)
+			}
+		}
+		suggestions = append(suggestions, rdjsonSuggestion{
+			Range: rdjsonRange{Start: rdjsonPosition{Line: h.oldStart, Column: 1}, End: &rdjsonPosition{Line: h.oldStart + old, Column: 1}},
+			Text:  text.String(),
+		})
+	}
+	return suggestions
+}
+
+// gitlabSeverity maps a rule severity onto the GitLab Code Quality severities.
+func gitlabSeverity(s severity) string {
+	if s == severityWarning {
+		return "minor"
+	}
+	return "major"
+}
+
+// fingerprint makes a stable identifier for a finding,
+// so the same problem can be tracked across runs.
+func fingerprint(parts ...string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(parts, "\x00"))))
+}
+
+// reportPath makes a slash separated path relative to root, without a leading "./".
+func reportPath(path, root string) string {
+	return strings.TrimPrefix(filepath.ToSlash(relPath(path, root)), "./")
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestWriteGitLab(t *testing.T) {
+
+	diags := []diagnostic{
+		{Path: "/a/b/c.rst", Line: 1, Column: 1, Rule: ruleAnchors, Message: "Anchor not found at top of page."},
+	}
+
+	var buf bytes.Buffer
+	if err := writeGitLab(&buf, report{root: "/a", diagnostics: diags}); err != nil {
+		t.Fatalf("writeGitLab returned an error: %v", err)
+	}
+
+	var issues []gitlabIssue
+	if err := json.Unmarshal(buf.Bytes(), &issues); err != nil {
+		t.Fatalf("writeGitLab wrote invalid JSON: %v", err)
+	}
+	if len(issues) != 1 {
+		t.Fatalf("writeGitLab wrote %v issues, not 1", len(issues))
+	}
+	issue := issues[0]
+	if issue.Location.Path != "b/c.rst" {
+		t.Errorf("location path is %v, not b/c.rst", issue.Location.Path)
+	}
+	if issue.CheckName != ruleAnchors {
+		t.Errorf("check name is %v, not %v", issue.CheckName, ruleAnchors)
+	}
+	if issue.Location.Lines.Begin != 1 {
+		t.Errorf("location begins on line %v, not 1", issue.Location.Lines.Begin)
+	}
+	if issue.Severity != "major" {
+		t.Errorf("severity is %v, not major", issue.Severity)
+	}
+	if issue.Fingerprint != fingerprint("b/c.rst", ruleAnchors, "Anchor not found at top of page.", "0") {
+		t.Errorf("fingerprint %v is not stable", issue.Fingerprint)
+	}
+
+	// The same problem found twice in a file has a fingerprint for each.
+	diags = []diagnostic{
+		{Path: "/a/b/c.rst", Line: 4, Column: 5, Rule: ruleTrailingWhitespace, Message: "Line has trailing whitespace."},
+		{Path: "/a/b/c.rst", Line: 6, Column: 5, Rule: ruleTrailingWhitespace, Message: "Line has trailing whitespace."},
+	}
+	buf.Reset()
+	if err := writeGitLab(&buf, report{root: "/a", diagnostics: diags}); err != nil {
+		t.Fatalf("writeGitLab returned an error: %v", err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &issues); err != nil {
+		t.Fatalf("writeGitLab wrote invalid JSON: %v", err)
+	}
+	if len(issues) != 2 || issues[0].Fingerprint == issues[1].Fingerprint {
+		t.Errorf("writeGitLab wrote %+v, expected two issues with different fingerprints", issues)
+	}
+
+}
+
+func TestWriteGitLabEmpty(t *testing.T) {
+
+	var buf bytes.Buffer
+	if err := writeGitLab(&buf, report{root: "/a"}); err != nil {
+		t.Fatalf("writeGitLab returned an error: %v", err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("writeGitLab with no errors -> %q, not an empty array", buf.String())
+	}
+
+}
+
+func TestWriteTAP(t *testing.T) {
+
+	r := report{
+		root:  "/a",
+		files: []string{"/a/b/c.rst", "/a/b/d.rst"},
+		diagnostics: []diagnostic{
+			{Path: "/a/b/d.rst", Line: 1, Column: 1, Rule: ruleAnchors, Message: "Anchor not found at top of page."},
+		},
+	}
+	expected := "TAP version 13\n" +
+		"1..2\n" +
+		"ok 1 - b/c.rst\n" +
+		"not ok 2 - b/d.rst\n" +
+		"# line 1: [DM003] Anchor not found at top of page.\n"
+
+	var buf bytes.Buffer
+	if err := writeTAP(&buf, r); err != nil {
+		t.Fatalf("writeTAP returned an error: %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("writeTAP -> %q, not %q", buf.String(), expected)
+	}
+
+}
+
+func TestWriteRDJSON(t *testing.T) {
+
+	diags := []diagnostic{
+		{Path: "/a/b/c.rst", Line: 1, Column: 1, Rule: ruleAnchors, Message: "Anchor not found at top of page."},
+	}
+
+	var buf bytes.Buffer
+	if err := writeRDJSON(&buf, report{root: "/a", diagnostics: diags}); err != nil {
+		t.Fatalf("writeRDJSON returned an error: %v", err)
+	}
+
+	var result rdjsonResult
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("writeRDJSON wrote invalid JSON: %v", err)
+	}
+	if result.Source.Name != "docmatica" {
+		t.Errorf("source name is %v, not docmatica", result.Source.Name)
+	}
+	if len(result.Diagnostics) != 1 {
+		t.Fatalf("writeRDJSON wrote %v diagnostics, not 1", len(result.Diagnostics))
+	}
+	d := result.Diagnostics[0]
+	if d.Location.Path != "b/c.rst" || d.Severity != "ERROR" || d.Code.Value != ruleAnchors {
+		t.Errorf("writeRDJSON wrote unexpected diagnostic %+v", d)
+	}
+
+}
+
+func TestWriteRDJSONSuggestions(t *testing.T) {
+
+	root := t.TempDir()
+	path := filepath.Join(root, "page.rst")
+	if err := os.WriteFile(path, []byte("Title\n====\n\nText  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diags := []diagnostic{
+		{Path: path, Line: 2, Column: 1, Rule: ruleHeadingUnderline, Message: "Underline of \"Title\" is 4 characters, shorter than the title's 5."},
+		{Path: path, Line: 4, Column: 5, Rule: ruleTrailingWhitespace, Message: "Line ends in whitespace."},
+		{Path: path, Line: 4, Column: 1, Rule: ruleSpelling, Message: "Possibly misspelled word \"Text\"."},
+	}
+
+	var buf bytes.Buffer
+	if err := writeRDJSON(&buf, report{root: root, diagnostics: diags}); err != nil {
+		t.Fatalf("writeRDJSON returned an error: %v", err)
+	}
+	var result rdjsonResult
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("writeRDJSON wrote invalid JSON: %v", err)
+	}
+
+	testTable := []struct {
+		line     int
+		expected string
+	}{
+		{2, "=====\n"},
+		{4, "Text\n"},
+	}
+	for i, r := range testTable {
+		s := result.Diagnostics[i].Suggestions
+		if len(s) != 1 || s[0].Text != r.expected || s[0].Range.Start.Line != r.line || s[0].Range.End == nil || s[0].Range.End.Line != r.line+1 {
+			t.Errorf("writeRDJSON suggested %+v for %v, expected line %v to be replaced with %q", s, diags[i].Rule, r.line, r.expected)
+		}
+	}
+	if s := result.Diagnostics[2].Suggestions; len(s) != 0 {
+		t.Errorf("writeRDJSON suggested %+v for a rule without a fixer, expected no suggestions", s)
+	}
+
+}
+
+func TestTextLine(t *testing.T) {
+
+	d := diagnostic{Path: "/a/b/c.rst", Line: 1, Column: 1, Rule: ruleAnchors, Message: "Anchor not found at top of page."}
+
+	testTable := []struct {
+		color    bool
+		expected string
+	}{
+		{false, "./b/c.rst:1: Anchor not found at top of page."},
+		{true, "\x1b[1m./b/c.rst:1\x1b[0m: \x1b[31mAnchor not found at top of page.\x1b[0m"},
+	}
+
+	for _, r := range testTable {
+		result := textLine(d, "/a", r.color)
+		if result != r.expected {
+			t.Errorf("textLine(%v, /a, %v) -> %q, not %q", d, r.color, result, r.expected)
+		}
+	}
+
+}
+
+func TestWriteSummary(t *testing.T) {
+
+	r := report{
+		root:  "/a",
+		files: []string{"/a/b/c.rst", "/a/b/d.rst", "/a/b/e.txt"},
+		diagnostics: []diagnostic{
+			{Path: "/a/b/d.rst", Line: 1, Rule: ruleAnchors, Message: "Anchor not found at top of page."},
+			{Path: "/a/b/e.txt", Rule: ruleFileType, Message: "Does not have a .rst file extension."},
+		},
+	}
+	expected := "Scanned 3 files in 2s, 2 with problems.\n" +
+		"  DM001 file-type: 1\n" +
+		"  DM003 back-to-top-anchors: 1\n"
+
+	var buf bytes.Buffer
+	writeSummary(&buf, r, 2*time.Second)
+	if buf.String() != expected {
+		t.Errorf("writeSummary -> %q, not %q", buf.String(), expected)
+	}
+
+}
+
+func TestWriteTextGrouped(t *testing.T) {
+
+	diags := []diagnostic{
+		{Path: "/a/b/d.rst", Line: 3, Rule: ruleAnchors, Message: "'Back to top' link to anchor not found."},
+		{Path: "/a/b/c.txt", Rule: ruleFileType, Message: "Does not have a .rst file extension."},
+		{Path: "/a/b/d.rst", Rule: ruleChapters, Message: "Not found in chapter directory."},
+	}
+
+	testTable := []struct {
+		groupBy  string
+		expected string
+	}{
+		{"file", "./b/c.txt\n" +
+			"  file: Does not have a .rst file extension.\n" +
+			"./b/d.rst\n" +
+			"  line 3: 'Back to top' link to anchor not found.\n" +
+			"  file: Not found in chapter directory.\n"},
+		{"rule", "DM001 file-type\n" +
+			"  ./b/c.txt: Does not have a .rst file extension.\n" +
+			"DM002 rst-in-chapters\n" +
+			"  ./b/d.rst: Not found in chapter directory.\n" +
+			"DM003 back-to-top-anchors\n" +
+			"  ./b/d.rst:3: 'Back to top' link to anchor not found.\n"},
+	}
+
+	for _, r := range testTable {
+		grouped := append([]diagnostic(nil), diags...)
+		groupDiagnostics(grouped, r.groupBy)
+		var buf bytes.Buffer
+		if err := writeText(&buf, report{root: "/a", diagnostics: grouped, groupBy: r.groupBy}); err != nil {
+			t.Fatalf("writeText returned an error: %v", err)
+		}
+		if buf.String() != r.expected {
+			t.Errorf("writeText grouped by %v -> %q, not %q", r.groupBy, buf.String(), r.expected)
+		}
+	}
+
+}
+
+func TestSortDiagnostics(t *testing.T) {
+
+	diags := []diagnostic{
+		{Path: "/a/c.rst", Line: 2, Rule: ruleAnchors},
+		{Path: "/a/b.rst", Line: 9, Rule: ruleAnchors},
+		{Path: "/a/c.rst", Line: 0, Rule: ruleChapters},
+		{Path: "/a/b.rst", Line: 1, Rule: ruleAnchors},
+	}
+	expected := []diagnostic{
+		{Path: "/a/b.rst", Line: 1, Rule: ruleAnchors},
+		{Path: "/a/b.rst", Line: 9, Rule: ruleAnchors},
+		{Path: "/a/c.rst", Line: 0, Rule: ruleChapters},
+		{Path: "/a/c.rst", Line: 2, Rule: ruleAnchors},
+	}
+
+	sortDiagnostics(diags)
+	for i := range expected {
+		if diags[i] != expected[i] {
+			t.Errorf("sortDiagnostics position %v -> %v, not %v", i, diags[i], expected[i])
+		}
+	}
+
+}
+
+func TestWriteMarkdown(t *testing.T) {
+
+	r := report{
+		root:  "/a",
+		files: []string{"/a/index.rst", "/a/user-manual/b/c.rst"},
+		diagnostics: []diagnostic{
+			{Path: "/a/user-manual/b/c.rst", Line: 4, Rule: ruleAnchors, Message: "'Back to top' link to anchor not found."},
+			{Path: "/a/index.rst", Line: 1, Rule: ruleAnchors, Message: "Anchor | not found."},
+		},
+	}
+	expected := "# Docmatica report\n\n" +
+		"2 files checked, 2 problems found.\n\n" +
+		"## user-manual\n\n" +
+		"| File | Line | Rule | Severity | Message |\n" +
+		"| --- | --- | --- | --- | --- |\n" +
+		"| `user-manual/b/c.rst` | 4 | [DM003](https://github.com/kevinbowrin/docmatica#dm003) | error | 'Back to top' link to anchor not found. |\n\n" +
+		"## Top level\n\n" +
+		"| File | Line | Rule | Severity | Message |\n" +
+		"| --- | --- | --- | --- | --- |\n" +
+		"| `index.rst` | 1 | [DM003](https://github.com/kevinbowrin/docmatica#dm003) | error | Anchor \\| not found. |\n"
+
+	var buf bytes.Buffer
+	if err := writeMarkdown(&buf, r); err != nil {
+		t.Fatalf("writeMarkdown returned an error: %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("writeMarkdown -> %q, not %q", buf.String(), expected)
+	}
+
+}
+
+func TestWriteCSV(t *testing.T) {
+
+	r := report{
+		root: "/a",
+		diagnostics: []diagnostic{
+			{Path: "/a/b/c.rst", Line: 4, Rule: ruleAnchors, Message: "'Back to top' link to anchor not found."},
+			{Path: "/a/b/d.txt", Rule: ruleFileType, Message: "Does not have a .rst file extension, or a .png."},
+		},
+	}
+	expected := "path,line,rule,severity,message\n" +
+		"b/c.rst,4,DM003,error,'Back to top' link to anchor not found.\n" +
+		"b/d.txt,,DM001,error,\"Does not have a .rst file extension, or a .png.\"\n"
+
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, r); err != nil {
+		t.Fatalf("writeCSV returned an error: %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("writeCSV -> %q, not %q", buf.String(), expected)
+	}
+
+}
+
+func TestWriteCompiler(t *testing.T) {
+
+	r := report{
+		root: "/a",
+		diagnostics: []diagnostic{
+			{Path: "/a/b/c.rst", Line: 4, Column: 3, Rule: ruleAnchors, Message: "'Back to top' link to anchor not found."},
+			{Path: "/a/b/d.txt", Rule: ruleFileType, Message: "Does not have a .rst file extension."},
+		},
+	}
+	expected := "b/c.rst:4:3: [DM003] 'Back to top' link to anchor not found.\n" +
+		"b/d.txt:1:1: [DM001] Does not have a .rst file extension.\n"
+
+	var buf bytes.Buffer
+	if err := writeCompiler(&buf, r); err != nil {
+		t.Fatalf("writeCompiler returned an error: %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("writeCompiler -> %q, not %q", buf.String(), expected)
+	}
+
+}
+
+func TestWriteTemplate(t *testing.T) {
+
+	r := report{
+		root: "/a",
+		diagnostics: []diagnostic{
+			{Path: "/a/b/c.rst", Line: 4, Rule: ruleAnchors, Message: "'Back to top' link to anchor not found."},
+		},
+		template: template.Must(template.New("t").Parse("{{.Path}}|{{.Rule}}|{{.Severity}}|{{.Message}}")),
+	}
+	expected := "b/c.rst|DM003|error|'Back to top' link to anchor not found.\n"
+
+	var buf bytes.Buffer
+	if err := writeTemplate(&buf, r); err != nil {
+		t.Fatalf("writeTemplate returned an error: %v", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("writeTemplate -> %q, not %q", buf.String(), expected)
+	}
+
+}
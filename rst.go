@@ -0,0 +1,561 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// directivePattern matches the first line of a directive, such as ".. image:: images/a.png".
+var directivePattern = regexp.MustCompile(`^(\s*)\.\.\s+([A-Za-z0-9][\w:.+-]*)::(?:\s+(.*))?$`)
+
+// optionPattern matches a directive option, such as ":maxdepth: 2".
+var optionPattern = regexp.MustCompile(`^\s+:([^:]+):(?:\s+(.*))?$`)
+
+// fieldPattern matches the first line of a field in a field list, such as ":Author: Artefactual".
+var fieldPattern = regexp.MustCompile("^\\s*:([^:\\s`][^:`]*):(?:\\s+(.*))?$")
+
+// fieldNoSpacePattern matches a field missing the space after its name, such as ":Author:Artefactual",
+// which isn't a field. Roles, like ":ref:`page`", aren't matched.
+var fieldNoSpacePattern = regexp.MustCompile("^\\s*:([^:\\s`][^:`]*):[^\\s:`]")
+
+// A directive found in a reST file.
+type directive struct {
+	name string
+	// The argument given on the same line as the directive name.
+	arg string
+	// The line the directive starts on.
+	line int
+	// The indentation of the directive marker.
+	indent  int
+	options map[string]string
+	// The content of the directive, following any options.
+	// This includes the lines of nested directives.
+	body []line
+}
+
+// directiveReader follows the directives in a reST file as its lines are read in order,
+// including directives nested in the bodies of other directives.
+type directiveReader struct {
+	open []*directive
+	// Whether the innermost open directive can still have options.
+	inOptions bool
+}
+
+// next reads a line, returning the directives it closed, innermost first.
+func (r *directiveReader) next(l line) []*directive {
+	var closed []*directive
+	if strings.TrimSpace(l.text) != "" {
+		indent := indentation(l.text)
+		for len(r.open) > 0 && indent <= r.open[len(r.open)-1].indent {
+			closed = append(closed, r.open[len(r.open)-1])
+			r.open = r.open[:len(r.open)-1]
+			r.inOptions = false
+		}
+	}
+
+	if r.inOptions && len(r.open) > 0 {
+		d := r.open[len(r.open)-1]
+		if m := optionPattern.FindStringSubmatch(l.text); m != nil {
+			d.options[m[1]] = strings.TrimSpace(m[2])
+			return closed
+		}
+		r.inOptions = false
+	}
+
+	for _, d := range r.open {
+		d.body = append(d.body, l)
+	}
+
+	if m := directivePattern.FindStringSubmatch(l.text); m != nil {
+		r.open = append(r.open, &directive{
+			name:    strings.ToLower(m[2]),
+			arg:     strings.TrimSpace(m[3]),
+			line:    l.num,
+			indent:  len(m[1]),
+			options: make(map[string]string),
+		})
+		r.inOptions = true
+	}
+	return closed
+}
+
+// end is called when there are no more lines, returning the directives still open, innermost first.
+func (r *directiveReader) end() []*directive {
+	var closed []*directive
+	for i := len(r.open) - 1; i >= 0; i-- {
+		closed = append(closed, r.open[i])
+	}
+	r.open = nil
+	return closed
+}
+
+// inBody reports whether l, the line most recently read, is in the body of
+// an open directive with one of the given names.
+func (r *directiveReader) inBody(l line, names ...string) bool {
+	for _, d := range r.open {
+		if d.line == l.num {
+			continue
+		}
+		for _, name := range names {
+			if d.name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The directives whose bodies are literal text rather than reST.
+var literalDirectives = []string{"code-block", "code", "sourcecode", "literalinclude", "highlight", "raw", "math", "parsed-literal"}
+
+// content returns the non-blank lines of the directive's body, with surrounding whitespace removed.
+func (d *directive) content() []line {
+	var lines []line
+	for _, l := range d.body {
+		text := strings.TrimSpace(l.text)
+		if text != "" {
+			lines = append(lines, line{num: l.num, text: text})
+		}
+	}
+	return lines
+}
+
+// labelPattern matches a label, such as ".. _anchor:", which :ref: roles can refer to.
+// Hyperlink targets, which have a URL following the colon, are not matched.
+var labelPattern = regexp.MustCompile("^\\s*\\.\\.\\s+_(`[^`]+`|[^:`\\s][^:]*):\\s*$")
+
+// label returns the name of the label defined on text, if any.
+func label(text string) (string, bool) {
+	m := labelPattern.FindStringSubmatch(text)
+	if m == nil || m[1] == "_" {
+		return "", false
+	}
+	return strings.Trim(m[1], "`"), true
+}
+
+// rolePattern matches an interpreted text role, such as :ref:`Back to the top <anchor>`.
+var rolePattern = regexp.MustCompile("(?:^|[^\\w`]):([A-Za-z][\\w.+-]*(?::[A-Za-z][\\w.+-]*)*):`([^`]+)`")
+
+// explicitTargetPattern matches text with an explicit target, such as "Title <target>".
+var explicitTargetPattern = regexp.MustCompile(`^(?s)(.*?)\s*<([^<>]+)>$`)
+
+// A role used in a reST file.
+type role struct {
+	name string
+	// The text between the backquotes.
+	text string
+	// The column the role starts at, from 1.
+	column int
+}
+
+// roles finds the roles used in text.
+func roles(text string) []role {
+	var found []role
+	for _, m := range rolePattern.FindAllStringSubmatchIndex(text, -1) {
+		found = append(found, role{
+			name:   text[m[2]:m[3]],
+			text:   text[m[4]:m[5]],
+			column: m[2],
+		})
+	}
+	return found
+}
+
+// target returns the target of a role, which is either given explicitly as in
+// "Title <target>", or is the whole text of the role.
+func (r role) target() string {
+	if m := explicitTargetPattern.FindStringSubmatch(r.text); m != nil {
+		return strings.TrimSpace(m[2])
+	}
+	return strings.TrimPrefix(strings.TrimSpace(r.text), "~")
+}
+
+// adornmentChars are the characters which can adorn section titles.
+const adornmentChars = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// isAdornment reports whether text is a line of a single repeated adornment character,
+// as used above and below section titles.
+func isAdornment(text string) bool {
+	text = strings.TrimRight(text, " \t")
+	if len(text) < 2 || !strings.ContainsRune(adornmentChars, rune(text[0])) {
+		return false
+	}
+	return strings.Count(text, text[:1]) == len(text)
+}
+
+// A section heading found in a reST file.
+type heading struct {
+	title string
+	// The line the title is on.
+	line int
+	// The adornment character.
+	char byte
+	// The adornment lines. The overline is empty when there isn't one.
+	overline, underline string
+}
+
+// headingReader finds the section headings in a reST file as its lines are read in order.
+type headingReader struct {
+	// The two lines before the current one.
+	before, previous line
+}
+
+// next reads a line, returning the heading it completes, if any.
+// A heading is a title followed by an underline, optionally with a matching overline.
+// Underlines shorter than their title are still recognized when at least four characters long,
+// as docutils does.
+func (r *headingReader) next(l line) *heading {
+	before, previous := r.before, r.previous
+	r.before, r.previous = previous, l
+
+	if !isAdornment(l.text) || strings.TrimSpace(previous.text) == "" || isAdornment(previous.text) {
+		return nil
+	}
+	title := strings.TrimSpace(previous.text)
+	if indentation(previous.text) > 0 && !(isAdornment(before.text) && before.text[0] == l.text[0]) {
+		return nil
+	}
+	underline := strings.TrimRight(l.text, " \t")
+	if len(underline) < len([]rune(title)) && len(underline) < 4 {
+		return nil
+	}
+	h := &heading{title: title, line: previous.num, char: underline[0], underline: underline}
+	if isAdornment(before.text) && before.text[0] == underline[0] && before.num == previous.num-1 {
+		h.overline = strings.TrimRight(before.text, " \t")
+	} else if strings.TrimSpace(before.text) != "" && before.num > 0 {
+		// A title which isn't separated from the text before it is part of a paragraph.
+		return nil
+	}
+	return h
+}
+
+// indentation counts the leading spaces of text, with tabs advancing to the next multiple of 8.
+func indentation(text string) int {
+	n := 0
+	for _, c := range text {
+		switch c {
+		case ' ':
+			n++
+		case '\t':
+			n += 8 - n%8
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// knownDirectives are the directives provided by docutils and Sphinx.
+var knownDirectives = []string{
+	// docutils
+	"attention", "caution", "danger", "error", "hint", "important", "note", "tip", "warning", "admonition",
+	"image", "figure", "topic", "sidebar", "line-block", "parsed-literal", "code", "math", "rubric",
+	"epigraph", "highlights", "pull-quote", "compound", "container", "table", "csv-table", "list-table",
+	"contents", "sectnum", "section-numbering", "header", "footer", "target-notes", "meta", "replace",
+	"unicode", "date", "include", "raw", "class", "role", "default-role", "title",
+	// Sphinx
+	"toctree", "versionadded", "versionchanged", "deprecated", "seealso", "centered", "hlist",
+	"highlight", "code-block", "sourcecode", "literalinclude", "glossary", "productionlist",
+	"index", "only", "tabularcolumns", "sectionauthor", "codeauthor", "moduleauthor",
+}
+
+// An extension is the directives and roles a Sphinx extension provides.
+type extension struct {
+	directives, roles []string
+}
+
+// knownExtensions are the Sphinx extensions, by module name, whose directives and roles pages are likely to use.
+var knownExtensions = map[string]extension{
+	"sphinx.ext.autodoc": {directives: []string{"automodule", "autoclass", "autoexception", "autofunction",
+		"autodecorator", "autodata", "automethod", "autoattribute", "autoproperty"}},
+	"sphinx.ext.autosummary":         {directives: []string{"autosummary"}},
+	"sphinx.ext.doctest":             {directives: []string{"testsetup", "testcleanup", "doctest", "testcode", "testoutput"}},
+	"sphinx.ext.graphviz":            {directives: []string{"graphviz", "graph", "digraph"}},
+	"sphinx.ext.ifconfig":            {directives: []string{"ifconfig"}},
+	"sphinx.ext.inheritance_diagram": {directives: []string{"inheritance-diagram"}},
+	"sphinx.ext.todo":                {directives: []string{"todo", "todolist"}},
+	"sphinx_design": {directives: []string{"grid", "grid-item", "grid-item-card", "card", "card-carousel",
+		"dropdown", "tab-set", "tab-item"}, roles: []string{"octicon"}},
+	"sphinx_tabs.tabs":      {directives: []string{"tabs", "tab", "group-tab", "code-tab"}},
+	"sphinxcontrib.bibtex":  {directives: []string{"bibliography"}, roles: []string{"cite"}},
+	"sphinxcontrib.mermaid": {directives: []string{"mermaid"}},
+}
+
+// extensionNames returns the directives, or the roles, the knownExtensions provide, sorted by name.
+func extensionNames(roles bool) []string {
+	var names []string
+	for _, e := range knownExtensions {
+		if roles {
+			names = append(names, e.roles...)
+		} else {
+			names = append(names, e.directives...)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providingExtension returns the extension providing the directive, or role, name, if it's one of the knownExtensions.
+func providingExtension(name string, role bool) (string, bool) {
+	for module, e := range knownExtensions {
+		if (role && contains(e.roles, name)) || (!role && contains(e.directives, name)) {
+			return module, true
+		}
+	}
+	return "", false
+}
+
+// isKnownDirective reports whether name is one of the knownDirectives, is provided by one of the knownExtensions,
+// or belongs to a Sphinx domain as in "py:function".
+func isKnownDirective(name string) bool {
+	_, ok := providingExtension(name, false)
+	return strings.Contains(name, ":") || contains(knownDirectives, name) || ok
+}
+
+// codeDirectives are the directives for blocks of highlighted code, which take the language as their argument.
+var codeDirectives = []string{"code-block", "code", "sourcecode"}
+
+// pygmentsLexers are the aliases of the Pygments lexers, and the special languages Sphinx accepts,
+// which code blocks in the documentation are likely to use.
+var pygmentsLexers = []string{
+	"none", "text", "default", "guess",
+	"apache", "apacheconf", "bash", "bat", "batch", "c", "c++", "cfg", "console", "cpp", "css", "diff",
+	"django", "docker", "dockerfile", "dosini", "go", "html", "http", "ini", "java", "javascript", "jinja",
+	"js", "json", "make", "makefile", "mysql", "nginx", "patch", "perl", "php", "postgresql", "powershell",
+	"ps1", "psql", "py", "py3", "pycon", "python", "python3", "rb", "rest", "restructuredtext", "rst",
+	"ruby", "sh", "shell", "shell-session", "sql", "toml", "udiff", "xml", "xslt", "yaml", "yml", "zsh",
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current := make([]int, len(rb)+1)
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = current[j-1] + 1
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if previous[j-1]+cost < current[j] {
+				current[j] = previous[j-1] + cost
+			}
+		}
+		previous = current
+	}
+	return previous[len(rb)]
+}
+
+// closest returns the one of candidates name is most likely a misspelling of, if any.
+// Names of up to four characters can be one edit away, and longer names two.
+func closest(name string, candidates []string) (string, bool) {
+	allowed := 2
+	if len(name) <= 4 {
+		allowed = 1
+	}
+	found, best := "", allowed+1
+	for _, c := range candidates {
+		if distance := editDistance(name, c); distance < best {
+			found, best = c, distance
+		}
+	}
+	return found, found != ""
+}
+
+// closestDirective returns the known directive name is most likely a misspelling of, if it isn't known.
+func closestDirective(name string) (string, bool) {
+	if isKnownDirective(name) {
+		return "", false
+	}
+	return closest(name, append(append([]string{}, knownDirectives...), extensionNames(false)...))
+}
+
+// knownRoles are the interpreted text roles provided by docutils and Sphinx.
+var knownRoles = []string{
+	// docutils
+	"emphasis", "literal", "code", "math", "pep-reference", "pep", "rfc-reference", "rfc", "strong",
+	"subscript", "sub", "superscript", "sup", "title-reference", "title", "t", "raw",
+	// Sphinx
+	"any", "ref", "doc", "download", "numref", "envvar", "token", "keyword", "option", "term",
+	"abbr", "command", "dfn", "file", "guilabel", "kbd", "mailheader", "makevar", "manpage",
+	"menuselection", "mimetype", "newsgroup", "program", "regexp", "samp", "index", "eq",
+}
+
+// roleDefinitionPattern matches the directive defining a custom role, such as ".. role:: red".
+var roleDefinitionPattern = regexp.MustCompile(`^\s*\.\.\s+role::\s+([A-Za-z][\w.+-]*)`)
+
+// parseLineRanges parses the lines option of a literalinclude directive, such as "1,3,5-10,20-",
+// into the first and last line of each range. The last line is 0 for ranges running to the end of the file.
+func parseLineRanges(spec string) ([][2]int, error) {
+	var ranges [][2]int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		first, last := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			first, last = part[:i], part[i+1:]
+		}
+		var r [2]int
+		var err error
+		if first == "" {
+			r[0] = 1
+		} else if r[0], err = strconv.Atoi(first); err != nil || r[0] < 1 {
+			return nil, fmt.Errorf("invalid line number %q", first)
+		}
+		if last != "" {
+			if r[1], err = strconv.Atoi(last); err != nil || r[1] < r[0] {
+				return nil, fmt.Errorf("invalid line range %q", part)
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// admonitionDirectives are the directives for admonitions set apart from the text, such as notes and warnings.
+var admonitionDirectives = []string{"attention", "caution", "danger", "error", "hint", "important", "note", "tip", "warning", "admonition"}
+
+// substitutionDefinitionPattern matches a substitution definition, such as ".. |version| replace:: 1.13".
+var substitutionDefinitionPattern = regexp.MustCompile(`^\s*\.\.\s+\|([^|\s](?:[^|]*[^|\s])?)\|\s+[A-Za-z][\w:.+-]*::`)
+
+// confSubstitutionPattern matches substitution definitions in the rst_prolog or rst_epilog of a conf.py.
+var confSubstitutionPattern = regexp.MustCompile(`\.\.\s+\|([^|\s](?:[^|\n]*[^|\s])?)\|\s+[A-Za-z][\w:.+-]*::`)
+
+// confExtensionsPattern matches the extensions set in a conf.py, such as "extensions = ['sphinx.ext.todo']",
+// or added to them with "+=".
+var confExtensionsPattern = regexp.MustCompile(`(?m)^extensions\s*\+?=\s*\[([^\]]*)\]`)
+
+// confAppendPattern matches an extension appended to the extensions of a conf.py.
+var confAppendPattern = regexp.MustCompile(`(?m)^extensions\.append\(\s*['"]([\w.]+)['"]\s*\)`)
+
+// quotedNamePattern matches a quoted module name in a Python list.
+var quotedNamePattern = regexp.MustCompile(`['"]([\w.]+)['"]`)
+
+// confExtensions returns the extensions enabled by the conf.py with the contents data.
+func confExtensions(data string) []string {
+	var found []string
+	for _, m := range confExtensionsPattern.FindAllStringSubmatch(data, -1) {
+		for _, q := range quotedNamePattern.FindAllStringSubmatch(m[1], -1) {
+			found = append(found, q[1])
+		}
+	}
+	for _, m := range confAppendPattern.FindAllStringSubmatch(data, -1) {
+		found = append(found, m[1])
+	}
+	return found
+}
+
+// markupSpanPattern matches inline markup, which can run across line breaks: inline literals, roles,
+// hyperlink references and interpreted text, strong emphasis, and emphasis. As in reST, the markup
+// starts at the start of the text or after whitespace or opening punctuation.
+var markupSpanPattern = regexp.MustCompile("(?:^|[\\s(\\[{<'\"/-])(``[^`]+?``|:[A-Za-z][\\w.+-]*(?::[A-Za-z][\\w.+-]*)*:`[^`]+`|" +
+	"`[^`]+`_{0,2}|\\*\\*[^\\s*](?:[^*]*[^\\s*])?\\*\\*|\\*[^\\s*](?:[^*]*[^\\s*])?\\*)")
+
+// markupKind describes the kind of inline markup span is.
+func markupKind(span string) string {
+	switch {
+	case strings.HasPrefix(span, "``"):
+		return "Inline literal"
+	case strings.HasPrefix(span, ":"):
+		return "Role"
+	case strings.HasPrefix(span, "`"):
+		return "Hyperlink reference"
+	case strings.HasPrefix(span, "**"):
+		return "Strong emphasis"
+	}
+	return "Emphasis"
+}
+
+// substitutionRefPattern matches a substitution reference, such as "|version|" or "|logo|_".
+var substitutionRefPattern = regexp.MustCompile(`(?:^|[\s(\[{'"/:-])\|([^|\s](?:[^|]*[^|\s])?)\|(?:__?)?(?:$|[\s)\]}'".,;:!?/-])`)
+
+// inlineLiteralPattern matches inline literal text, which is enclosed in pairs of backquotes.
+var inlineLiteralPattern = regexp.MustCompile("``[^`]+``")
+
+// substitutionRefs finds the substitution references in text, outside of inline literals.
+func substitutionRefs(text string) []nameRef {
+	text = inlineLiteralPattern.ReplaceAllStringFunc(text, func(s string) string { return strings.Repeat(" ", len(s)) })
+	var found []nameRef
+	for _, m := range substitutionRefPattern.FindAllStringSubmatchIndex(text, -1) {
+		found = append(found, nameRef{name: text[m[2]:m[3]], column: m[2]})
+	}
+	return found
+}
+
+// footnoteRefPattern matches a footnote or citation reference, such as "[#f1]_" or "[CIT2002]_".
+var footnoteRefPattern = regexp.MustCompile(`(?:^|[^\w\[\]])\[([^\[\]\s]+)\]_(?:$|[^\w])`)
+
+// footnotePattern matches a footnote or citation, such as ".. [#f1] Text".
+var footnotePattern = regexp.MustCompile(`^\s*\.\.\s+\[([^\[\]\s]+)\](?:\s|$)`)
+
+// isCitation reports whether the label of a footnote or citation is a citation's.
+// Footnote labels are numbers, "#" optionally followed by a name, or "*".
+func isCitation(label string) bool {
+	if strings.HasPrefix(label, "#") || label == "*" {
+		return false
+	}
+	for _, c := range label {
+		if c < '0' || c > '9' {
+			return true
+		}
+	}
+	return false
+}
+
+// footnoteRefs finds the footnote and citation references in text, outside of inline literals.
+func footnoteRefs(text string) []nameRef {
+	text = inlineLiteralPattern.ReplaceAllStringFunc(text, func(s string) string { return strings.Repeat(" ", len(s)) })
+	var found []nameRef
+	for _, m := range footnoteRefPattern.FindAllStringSubmatchIndex(text, -1) {
+		found = append(found, nameRef{name: text[m[2]:m[3]], column: m[2]})
+	}
+	return found
+}
+
+// urlFindPattern matches an external URL in text.
+var urlFindPattern = regexp.MustCompile("\\bhttps?://[^\\s<>`\"'|\\\\]+")
+
+// findURLs returns the start and end offsets of the external URLs in text, outside of inline literals.
+// Punctuation ending a sentence, or closing brackets the URL opened in, aren't part of the URL.
+func findURLs(text string) [][2]int {
+	text = inlineLiteralPattern.ReplaceAllStringFunc(text, func(s string) string { return strings.Repeat(" ", len(s)) })
+	var found [][2]int
+	for _, m := range urlFindPattern.FindAllStringIndex(text, -1) {
+		end := m[1]
+		for end > m[0] {
+			c := text[end-1]
+			if strings.IndexByte(".,;:!?", c) >= 0 ||
+				c == ')' && strings.Count(text[m[0]:end], "(") < strings.Count(text[m[0]:end], ")") ||
+				c == ']' && strings.Count(text[m[0]:end], "[") < strings.Count(text[m[0]:end], "]") {
+				end--
+				continue
+			}
+			break
+		}
+		found = append(found, [2]int{m[0], end})
+	}
+	return found
+}
+
+// hostMatches reports whether host is one of domains, or a subdomain of one.
+// The domain "*" matches every host.
+func hostMatches(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if d == "*" || host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// readDirectives reads the directives in text, in the order they close.
+func readDirectives(text string) []*directive {
+	var r directiveReader
+	var found []*directive
+	for i, t := range strings.Split(text, "\n") {
+		found = append(found, r.next(line{num: i + 1, text: t})...)
+	}
+	return append(found, r.end()...)
+}
+
+func TestDirectiveReader(t *testing.T) {
+
+	text := ".. toctree::\n" +
+		"   :maxdepth: 2\n" +
+		"\n" +
+		"   transfer/index\n" +
+		"   ingest/index\n" +
+		"\n" +
+		"Some text.\n" +
+		"\n" +
+		".. note::\n" +
+		"\n" +
+		"   .. image:: images/a.png\n" +
+		"      :alt: A screenshot"
+
+	found := readDirectives(text)
+	if len(found) != 3 {
+		t.Fatalf("read %v directives, not 3", len(found))
+	}
+
+	toctree := found[0]
+	if toctree.name != "toctree" || toctree.line != 1 || toctree.options["maxdepth"] != "2" {
+		t.Errorf("unexpected toctree %+v", toctree)
+	}
+	content := toctree.content()
+	if len(content) != 2 || content[0].text != "transfer/index" || content[1].num != 5 {
+		t.Errorf("unexpected toctree content %v", content)
+	}
+
+	image := found[1]
+	if image.name != "image" || image.arg != "images/a.png" || image.options["alt"] != "A screenshot" {
+		t.Errorf("unexpected image %+v", image)
+	}
+
+	note := found[2]
+	if note.name != "note" || len(note.content()) != 1 {
+		t.Errorf("unexpected note %+v", note)
+	}
+
+}
+
+func TestIndentation(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected int
+	}{
+		{"text", 0},
+		{"   text", 3},
+		{"\ttext", 8},
+		{"  \ttext", 8},
+		{"    ", 4},
+	}
+
+	for _, r := range testTable {
+		result := indentation(r.text)
+		if result != r.expected {
+			t.Errorf("indentation(%q) -> %v, not %v", r.text, result, r.expected)
+		}
+	}
+
+}
+
+func TestRoles(t *testing.T) {
+
+	found := roles("See :ref:`Back to the top <anchor>` and :doc:`/user-manual/index`, not ``:ref:`x```.")
+	if len(found) != 2 {
+		t.Fatalf("roles found %v, expected 2", found)
+	}
+	if found[0].name != "ref" || found[0].target() != "anchor" || found[0].column != 5 {
+		t.Errorf("unexpected first role %+v", found[0])
+	}
+	if found[1].name != "doc" || found[1].target() != "/user-manual/index" {
+		t.Errorf("unexpected second role %+v", found[1])
+	}
+
+}
+
+func TestLabel(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected string
+		ok       bool
+	}{
+		{".. _transfer:", "transfer", true},
+		{"   .. _transfer-tab: ", "transfer-tab", true},
+		{".. _`with: colon`:", "with: colon", true},
+		{".. _archivematica: https://www.archivematica.org", "", false},
+		{".. __: https://www.archivematica.org", "", false},
+		{".. note::", "", false},
+	}
+
+	for _, r := range testTable {
+		result, ok := label(r.text)
+		if result != r.expected || ok != r.ok {
+			t.Errorf("label(%q) -> %q, %v, not %q, %v", r.text, result, ok, r.expected, r.ok)
+		}
+	}
+
+}
+
+// readHeadings reads the headings in text.
+func readHeadings(text string) []*heading {
+	var r headingReader
+	var found []*heading
+	for i, t := range strings.Split(text, "\n") {
+		if h := r.next(line{num: i + 1, text: t}); h != nil {
+			found = append(found, h)
+		}
+	}
+	return found
+}
+
+func TestHeadingReader(t *testing.T) {
+
+	text := "=====\n" +
+		"Title\n" +
+		"=====\n" +
+		"\n" +
+		"Section\n" +
+		"-------\n" +
+		"\n" +
+		"A paragraph\n" +
+		"with text.\n" +
+		"---\n" +
+		"\n" +
+		"Short underline\n" +
+		"~~~~\n" +
+		"\n" +
+		"==  ==\n" +
+		"a   b\n" +
+		"==  ==\n"
+
+	found := readHeadings(text)
+	if len(found) != 3 {
+		t.Fatalf("read headings %v, expected 3", found)
+	}
+	if found[0].title != "Title" || found[0].overline != "=====" || found[0].line != 2 {
+		t.Errorf("unexpected first heading %+v", found[0])
+	}
+	if found[1].title != "Section" || found[1].char != '-' || found[1].overline != "" {
+		t.Errorf("unexpected second heading %+v", found[1])
+	}
+	if found[2].title != "Short underline" || found[2].underline != "~~~~" {
+		t.Errorf("unexpected third heading %+v", found[2])
+	}
+
+}
+
+func TestEditDistance(t *testing.T) {
+
+	testTable := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"note", "note", 0},
+		{"nnote", "note", 1},
+		{"code-blok", "code-block", 1},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, r := range testTable {
+		result := editDistance(r.a, r.b)
+		if result != r.expected {
+			t.Errorf("editDistance(%v, %v) -> %v, not %v", r.a, r.b, result, r.expected)
+		}
+	}
+
+}
+
+func TestClosestDirective(t *testing.T) {
+
+	testTable := []struct {
+		name     string
+		expected string
+	}{
+		{"note", ""},
+		{"py:function", ""},
+		{"nnote", "note"},
+		{"code-blok", "code-block"},
+		{"toctre", "toctree"},
+		{"tabs", ""},
+		{"mermaid", ""},
+	}
+
+	for _, r := range testTable {
+		result, _ := closestDirective(r.name)
+		if result != r.expected {
+			t.Errorf("closestDirective(%v) -> %q, not %q", r.name, result, r.expected)
+		}
+	}
+
+}
+
+func TestParseLineRanges(t *testing.T) {
+
+	testTable := []struct {
+		spec     string
+		expected [][2]int
+	}{
+		{"1", [][2]int{{1, 1}}},
+		{"1,3,5-10,20-", [][2]int{{1, 1}, {3, 3}, {5, 10}, {20, 0}}},
+		{"-5", [][2]int{{1, 5}}},
+		{"a", nil},
+		{"10-5", nil},
+	}
+
+	for _, r := range testTable {
+		result, err := parseLineRanges(r.spec)
+		if r.expected == nil {
+			if err == nil {
+				t.Errorf("parseLineRanges(%v) -> %v, expected an error", r.spec, result)
+			}
+			continue
+		}
+		if err != nil || fmt.Sprint(result) != fmt.Sprint(r.expected) {
+			t.Errorf("parseLineRanges(%v) -> %v, %v, not %v", r.spec, result, err, r.expected)
+		}
+	}
+
+}
+
+func TestSubstitutionRefs(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected []string
+	}{
+		{"Archivematica |version| is out.", []string{"version"}},
+		{"See |logo|_ and (|release|).", []string{"logo", "release"}},
+		{"Use ``|literal|`` text.", nil},
+		{"| A | B |", nil},
+		{"a|b|c", nil},
+	}
+
+	for _, r := range testTable {
+		var names []string
+		for _, ref := range substitutionRefs(r.text) {
+			names = append(names, ref.name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(r.expected) {
+			t.Errorf("substitutionRefs(%q) -> %v, not %v", r.text, names, r.expected)
+		}
+	}
+
+}
+
+func TestFindURLs(t *testing.T) {
+
+	testTable := []struct {
+		text     string
+		expected []string
+	}{
+		{"See https://www.archivematica.org/ for more.", []string{"https://www.archivematica.org/"}},
+		{"See http://a.org/x.", []string{"http://a.org/x"}},
+		{"(see https://en.wikipedia.org/wiki/METS_(standard)).", []string{"https://en.wikipedia.org/wiki/METS_(standard)"}},
+		{"`Archivematica <https://www.archivematica.org>`_", []string{"https://www.archivematica.org"}},
+		{"Run ``curl http://localhost``.", nil},
+	}
+
+	for _, r := range testTable {
+		var urls []string
+		for _, m := range findURLs(r.text) {
+			urls = append(urls, r.text[m[0]:m[1]])
+		}
+		if fmt.Sprint(urls) != fmt.Sprint(r.expected) {
+			t.Errorf("findURLs(%q) -> %v, not %v", r.text, urls, r.expected)
+		}
+	}
+
+}
+
+func TestHostMatches(t *testing.T) {
+
+	testTable := []struct {
+		host     string
+		domains  []string
+		expected bool
+	}{
+		{"archivematica.org", []string{"archivematica.org"}, true},
+		{"wiki.Archivematica.org", []string{"archivematica.org"}, true},
+		{"notarchivematica.org", []string{"archivematica.org"}, false},
+		{"anything.com", []string{"*"}, true},
+		{"anything.com", nil, false},
+	}
+
+	for _, r := range testTable {
+		result := hostMatches(r.host, r.domains)
+		if result != r.expected {
+			t.Errorf("hostMatches(%v, %v) -> %v, not %v", r.host, r.domains, result, r.expected)
+		}
+	}
+
+}
+
+func TestConfExtensions(t *testing.T) {
+
+	testTable := []struct {
+		conf     string
+		expected []string
+	}{
+		{"extensions = ['sphinx.ext.todo', \"sphinx_tabs.tabs\"]\n", []string{"sphinx.ext.todo", "sphinx_tabs.tabs"}},
+		{"extensions = [\n    'sphinx.ext.ifconfig',  # For the versions.\n]\nextensions += ['sphinx_design']\n",
+			[]string{"sphinx.ext.ifconfig", "sphinx_design"}},
+		{"extensions = []\nextensions.append('sphinxcontrib.mermaid')\n", []string{"sphinxcontrib.mermaid"}},
+		{"project = 'Archivematica'\n", nil},
+	}
+
+	for _, r := range testTable {
+		result := confExtensions(r.conf)
+		if fmt.Sprint(result) != fmt.Sprint(r.expected) {
+			t.Errorf("confExtensions(%q) -> %v, not %v", r.conf, result, r.expected)
+		}
+	}
+
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The severity of a rule determines how its findings are reported
+// and whether they cause docmatica to exit with an error code.
+type severity int
+
+// The zero severity is used by diagnostics which have the severity of their rule.
+const (
+	severityError severity = iota + 1
+	severityWarning
+)
+
+func (s severity) String() string {
+	if s == severityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// The identifiers of all the rules docmatica checks.
+const (
+	ruleRead                = "DM000"
+	ruleFileType            = "DM001"
+	ruleChapters            = "DM002"
+	ruleAnchors             = "DM003"
+	ruleOrphan              = "DM004"
+	ruleToctreeTarget       = "DM005"
+	ruleDocReference        = "DM006"
+	ruleRefLabel            = "DM007"
+	ruleDuplicateLabel      = "DM008"
+	ruleAnchorConvention    = "DM009"
+	ruleImagesPlacement     = "DM010"
+	ruleUnusedImage         = "DM011"
+	ruleImageTarget         = "DM012"
+	ruleChapterIndex        = "DM013"
+	ruleDepth               = "DM014"
+	ruleFilename            = "DM015"
+	rulePlaceholder         = "DM016"
+	ruleDuplicateTitle      = "DM017"
+	ruleImageRelativity     = "DM018"
+	ruleIncludeTarget       = "DM019"
+	ruleSymlink             = "DM020"
+	ruleContents            = "DM021"
+	ruleChapterRegistered   = "DM022"
+	ruleHeadingUnderline    = "DM023"
+	ruleHeadingHierarchy    = "DM024"
+	ruleTrailingWhitespace  = "DM025"
+	ruleTabs                = "DM026"
+	ruleLineLength          = "DM027"
+	ruleFinalNewline        = "DM028"
+	ruleLineEndings         = "DM029"
+	ruleEncoding            = "DM030"
+	ruleSuspiciousCharacter = "DM031"
+	ruleSyntax              = "DM032"
+	ruleCodeLanguage        = "DM033"
+	ruleDirectiveName       = "DM034"
+	ruleRoleName            = "DM035"
+	ruleTable               = "DM036"
+	ruleAdmonition          = "DM037"
+	ruleUILabel             = "DM038"
+	ruleSubstitution        = "DM039"
+	ruleFootnote            = "DM040"
+	ruleTodo                = "DM041"
+	ruleDuplicateSection    = "DM042"
+	ruleHeadingCase         = "DM043"
+	ruleTerm                = "DM044"
+	ruleVocabulary          = "DM045"
+	ruleSpelling            = "DM046"
+	ruleAcronym             = "DM047"
+	ruleFigureCaption       = "DM048"
+	ruleAltText             = "DM049"
+	ruleScreenshotFigure    = "DM050"
+	ruleVersion             = "DM051"
+	ruleHTTPS               = "DM052"
+	ruleDeadLink            = "DM053"
+	ruleDeniedDomain        = "DM054"
+	ruleBareURL             = "DM055"
+	ruleRefText             = "DM056"
+	ruleAdornment           = "DM057"
+	ruleRawHTML             = "DM058"
+	ruleDeprecated          = "DM059"
+	ruleExtension           = "DM060"
+	ruleToctreeOptions      = "DM061"
+	ruleOrphanMarker        = "DM062"
+	ruleCurlyQuote          = "DM063"
+	ruleWhitespaceLine      = "DM064"
+	ruleBlankLines          = "DM065"
+	ruleSplitMarkup         = "DM066"
+	ruleFloatingLabel       = "DM067"
+	ruleCrossManual         = "DM068"
+	ruleDownload            = "DM069"
+	ruleGlossaryTerm        = "DM070"
+	ruleUnusedGlossaryTerm  = "DM071"
+	ruleCodeSample          = "DM072"
+)
+
+// A rule describes one of the checks docmatica performs.
+type rule struct {
+	name        string
+	description string
+	severity    severity
+	// Whether the rule is only checked when it's enabled with the enable flag.
+	optIn bool
+}
+
+var rules = map[string]rule{
+	ruleRead: {
+		name:        "read-error",
+		description: "The file could not be read.",
+		severity:    severityError,
+	},
+	ruleFileType: {
+		name:        "file-type",
+		description: "All files found have extension .rst or .svg or .png in an images directory.",
+		severity:    severityError,
+	},
+	ruleChapters: {
+		name:        "rst-in-chapters",
+		description: "All .rst files are nested within chapter directories.",
+		severity:    severityError,
+	},
+	ruleAnchors: {
+		name:        "back-to-top-anchors",
+		description: "All .rst files have 'Back to Top' anchors.",
+		severity:    severityError,
+	},
+	ruleOrphan: {
+		name:        "orphan-page",
+		description: "All .rst files are included in a toctree.",
+		severity:    severityWarning,
+	},
+	ruleToctreeTarget: {
+		name:        "toctree-target",
+		description: "All toctree entries refer to documents which exist.",
+		severity:    severityError,
+	},
+	ruleDocReference: {
+		name:        "doc-reference",
+		description: "All :doc: roles refer to documents which exist.",
+		severity:    severityError,
+	},
+	ruleRefLabel: {
+		name:        "ref-label",
+		description: "All :ref: roles refer to labels defined in the repository.",
+		severity:    severityError,
+	},
+	ruleDuplicateLabel: {
+		name:        "duplicate-label",
+		description: "No label is defined more than once in the repository.",
+		severity:    severityError,
+	},
+	ruleAnchorConvention: {
+		name:        "anchor-convention",
+		description: "Page anchors follow the anchor convention.",
+		severity:    severityWarning,
+	},
+	ruleImagesPlacement: {
+		name:        "images-placement",
+		description: "All images directories are directly inside chapter directories.",
+		severity:    severityError,
+	},
+	ruleUnusedImage: {
+		name:        "unused-image",
+		description: "All files in images directories are used by an image or figure directive.",
+		severity:    severityWarning,
+	},
+	ruleImageTarget: {
+		name:        "image-target",
+		description: "All image and figure directives refer to files which exist, with the same case.",
+		severity:    severityError,
+	},
+	ruleChapterIndex: {
+		name:        "chapter-index",
+		description: "All chapter directories contain an index.rst file.",
+		severity:    severityError,
+	},
+	ruleDepth: {
+		name:        "max-depth",
+		description: "No .rst files are nested deeper than the maximum depth.",
+		severity:    severityWarning,
+	},
+	ruleFilename: {
+		name:        "filename",
+		description: "All .rst files and images have names matching the filename pattern.",
+		severity:    severityWarning,
+	},
+	rulePlaceholder: {
+		name:        "placeholder-page",
+		description: "No .rst files are empty, or only have an anchor and a title.",
+		severity:    severityWarning,
+	},
+	ruleDuplicateTitle: {
+		name:        "duplicate-title",
+		description: "No two pages in the same manual have the same title.",
+		severity:    severityWarning,
+	},
+	ruleImageRelativity: {
+		name:        "image-relativity",
+		description: "Pages only use images from their own chapter.",
+		severity:    severityWarning,
+	},
+	ruleIncludeTarget: {
+		name:        "include-target",
+		description: "All include and literalinclude directives refer to files which exist.",
+		severity:    severityError,
+	},
+	ruleSymlink: {
+		name:        "symlink",
+		description: "Symbolic links follow the symlinks policy, and don't point outside the repository.",
+		severity:    severityError,
+	},
+	ruleContents: {
+		name:        "contents-completeness",
+		description: "The toctree of contents.rst includes the index of every manual, and nothing else.",
+		severity:    severityError,
+	},
+	ruleChapterRegistered: {
+		name:        "chapter-registered",
+		description: "Every chapter is included in the toctree of its manual's index.rst.",
+		severity:    severityError,
+	},
+	ruleHeadingUnderline: {
+		name:        "heading-underline",
+		description: "Section title underlines and overlines are at least as long as the title.",
+		severity:    severityError,
+	},
+	ruleHeadingHierarchy: {
+		name:        "heading-hierarchy",
+		description: "Section levels are used in order, without skipping any.",
+		severity:    severityError,
+	},
+	ruleTrailingWhitespace: {
+		name:        "trailing-whitespace",
+		description: "No lines in .rst files have trailing whitespace.",
+		severity:    severityWarning,
+	},
+	ruleTabs: {
+		name:        "no-tabs",
+		description: "No .rst files contain tab characters.",
+		severity:    severityWarning,
+	},
+	ruleLineLength: {
+		name:        "line-length",
+		description: "No lines in .rst files are longer than the maximum line length.",
+		severity:    severityWarning,
+	},
+	ruleFinalNewline: {
+		name:        "final-newline",
+		description: "All .rst files end with a newline.",
+		severity:    severityWarning,
+	},
+	ruleLineEndings: {
+		name:        "line-endings",
+		description: "Lines in .rst files end with Unix line endings.",
+		severity:    severityWarning,
+	},
+	ruleEncoding: {
+		name:        "encoding",
+		description: "All .rst files are valid UTF-8, without a byte-order mark.",
+		severity:    severityError,
+	},
+	ruleSuspiciousCharacter: {
+		name:        "suspicious-character",
+		description: "No .rst files contain non-breaking spaces or zero-width characters.",
+		severity:    severityWarning,
+	},
+	ruleSyntax: {
+		name:        "syntax",
+		description: "Directives, directive options, field lists and literal blocks are well formed.",
+		severity:    severityError,
+	},
+	ruleCodeLanguage: {
+		name:        "code-language",
+		description: "Code blocks name a language Pygments knows.",
+		severity:    severityWarning,
+	},
+	ruleDirectiveName: {
+		name:        "directive-name",
+		description: "Directive names aren't misspellings of docutils or Sphinx directives.",
+		severity:    severityError,
+	},
+	ruleRoleName: {
+		name:        "role-name",
+		description: "Roles are provided by docutils or Sphinx, defined in the page, or allowed by the roles flag.",
+		severity:    severityError,
+	},
+	ruleTable: {
+		name:        "table",
+		description: "Grid and simple tables are well formed.",
+		severity:    severityError,
+	},
+	ruleAdmonition: {
+		name:        "admonition",
+		description: "Admonitions are of an allowed type, separated from their body by a blank line, and not overused.",
+		severity:    severityWarning,
+	},
+	ruleUILabel: {
+		name:        "ui-label",
+		description: "Elements of the user interface are named with the guilabel or menuselection roles.",
+		severity:    severityWarning,
+	},
+	ruleSubstitution: {
+		name:        "substitution",
+		description: "All substitution references have a definition.",
+		severity:    severityError,
+	},
+	ruleFootnote: {
+		name:        "footnote",
+		description: "Footnote and citation references match a footnote or citation.",
+		severity:    severityError,
+	},
+	ruleTodo: {
+		name:        "todo",
+		description: "Pages have no todo directives or TODO and FIXME comments.",
+		severity:    severityWarning,
+		optIn:       true,
+	},
+	ruleDuplicateSection: {
+		name:        "duplicate-section",
+		description: "No two sections in a page have the same title.",
+		severity:    severityWarning,
+	},
+	ruleHeadingCase: {
+		name:        "heading-case",
+		description: "Headings follow the capitalization given with the heading-case flag.",
+		severity:    severityWarning,
+	},
+	ruleTerm: {
+		name:        "terminology",
+		description: "Product and standard names are capitalized as given with the terms flag.",
+		severity:    severityWarning,
+	},
+	ruleVocabulary: {
+		name:        "vocabulary",
+		description: "Prose avoids the words and phrases given with the vocabulary flag.",
+		severity:    severityWarning,
+	},
+	ruleSpelling: {
+		name:        "spelling",
+		description: "Words in prose are in the dictionaries given with the dictionaries flag.",
+		severity:    severityWarning,
+	},
+	ruleAcronym: {
+		name:        "acronym",
+		description: "Acronyms are expanded the first time they're used in a page.",
+		severity:    severityWarning,
+		optIn:       true,
+	},
+	ruleFigureCaption: {
+		name:        "figure-caption",
+		description: "Figure directives have a caption.",
+		severity:    severityWarning,
+	},
+	ruleAltText: {
+		name:        "alt-text",
+		description: "Image and figure directives have alt text.",
+		severity:    severityWarning,
+	},
+	ruleScreenshotFigure: {
+		name:        "screenshot-figure",
+		description: "Screenshots in images directories use figure directives, not image directives.",
+		severity:    severityWarning,
+	},
+	ruleVersion: {
+		name:        "hard-coded-version",
+		description: "Prose doesn't hard-code versions matching the version pattern.",
+		severity:    severityWarning,
+	},
+	ruleHTTPS: {
+		name:        "https",
+		description: "External links to domains known to support HTTPS use it.",
+		severity:    severityWarning,
+	},
+	ruleDeadLink: {
+		name:        "dead-link",
+		description: "External links can be reached.",
+		severity:    severityError,
+		optIn:       true,
+	},
+	ruleDeniedDomain: {
+		name:        "denied-domain",
+		description: "External links don't point to denied domains.",
+		severity:    severityError,
+	},
+	ruleBareURL: {
+		name:        "bare-url",
+		description: "Prose links with named hyperlinks rather than bare URLs.",
+		severity:    severityWarning,
+	},
+	ruleRefText: {
+		name:        "ref-text",
+		description: ":ref: links have the link text required by the ref-text flag.",
+		severity:    severityWarning,
+	},
+	ruleAdornment: {
+		name:        "heading-adornment",
+		description: "Headings use the adornment given with the adornments flag for their level.",
+		severity:    severityWarning,
+	},
+	ruleRawHTML: {
+		name:        "raw-html",
+		description: "Pages don't use raw HTML, except those given with the raw-html flag.",
+		severity:    severityError,
+	},
+	ruleDeprecated: {
+		name:        "deprecated",
+		description: "Pages don't use the directives, roles and options given with the deprecated flag.",
+		severity:    severityWarning,
+	},
+	ruleExtension: {
+		name:        "extension",
+		description: "Directives and roles of Sphinx extensions are only used when the extension is enabled.",
+		severity:    severityError,
+	},
+	ruleToctreeOptions: {
+		name:        "toctree-options",
+		description: "Toctrees have consistent options and no duplicate entries.",
+		severity:    severityWarning,
+	},
+	ruleOrphanMarker: {
+		name:        "orphan-marker",
+		description: "Pages aren't marked :orphan:.",
+		severity:    severityWarning,
+	},
+	ruleCurlyQuote: {
+		name:        "curly-quote",
+		description: "No .rst files contain curly quotes or apostrophes.",
+		severity:    severityWarning,
+	},
+	ruleWhitespaceLine: {
+		name:        "whitespace-only-line",
+		description: "Lines in directive bodies which look blank don't contain whitespace.",
+		severity:    severityWarning,
+	},
+	ruleBlankLines: {
+		name:        "blank-lines",
+		description: "No .rst files have more consecutive blank lines than the max-blank-lines flag allows.",
+		severity:    severityWarning,
+	},
+	ruleSplitMarkup: {
+		name:        "split-markup",
+		description: "Inline markup isn't split across line breaks.",
+		severity:    severityWarning,
+	},
+	ruleFloatingLabel: {
+		name:        "floating-label",
+		description: "Labels are followed by a section heading or a figure.",
+		severity:    severityWarning,
+	},
+	ruleCrossManual: {
+		name:        "cross-manual",
+		description: "Manuals don't reference each other more than the max-cross-manual flag allows.",
+		severity:    severityWarning,
+	},
+	ruleDownload: {
+		name:        "download-target",
+		description: ":download: roles refer to files which exist.",
+		severity:    severityError,
+	},
+	ruleGlossaryTerm: {
+		name:        "glossary-term",
+		description: ":term: roles refer to terms defined in a glossary.",
+		severity:    severityError,
+	},
+	ruleUnusedGlossaryTerm: {
+		name:        "unused-glossary-term",
+		description: "Glossary terms are referenced by a :term: role.",
+		severity:    severityWarning,
+	},
+	ruleCodeSample: {
+		name:        "code-sample",
+		description: "Code samples in JSON, YAML, shell and INI are free of syntax errors.",
+		severity:    severityWarning,
+	},
+}
+
+// The rules enabled and disabled with the enable and disable flags.
+var enabledRules, disabledRules map[string]bool
+
+// parseRuleList parses a comma separated list of rules, given by identifier or name, into a set of identifiers.
+func parseRuleList(list string) (map[string]bool, error) {
+	set := make(map[string]bool)
+	for _, item := range splitList(list) {
+		found := false
+		for id, r := range rules {
+			if strings.EqualFold(item, id) || item == r.name {
+				set[id] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown rule %q", item)
+		}
+	}
+	return set, nil
+}
+
+// ruleEnabled reports whether problems found by the rule with the given identifier are reported.
+// Rules are enabled unless disabled, except opt-in rules, which must be enabled.
+func ruleEnabled(id string) bool {
+	if disabledRules[id] {
+		return false
+	}
+	return !rules[id].optIn || enabledRules[id]
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestParseRuleList(t *testing.T) {
+
+	set, err := parseRuleList("DM025, no-tabs,dm041")
+	if err != nil || len(set) != 3 || !set[ruleTrailingWhitespace] || !set[ruleTabs] || !set[ruleTodo] {
+		t.Errorf("parseRuleList -> %v, %v, expected DM025, DM026 and DM041", set, err)
+	}
+	if _, err := parseRuleList("DM999"); err == nil {
+		t.Errorf("parseRuleList(DM999) succeeded, expected an unknown rule")
+	}
+
+}
+
+func TestRuleEnabled(t *testing.T) {
+
+	defer func() { enabledRules, disabledRules = nil, nil }()
+	enabledRules, disabledRules = map[string]bool{}, map[string]bool{ruleTabs: true}
+
+	testTable := []struct {
+		id       string
+		enabled  bool
+		expected bool
+	}{
+		{ruleTrailingWhitespace, false, true},
+		{ruleTabs, false, false},
+		{ruleTodo, false, false},
+		{ruleTodo, true, true},
+	}
+
+	for _, r := range testTable {
+		enabledRules[r.id] = r.enabled
+		result := ruleEnabled(r.id)
+		if result != r.expected {
+			t.Errorf("ruleEnabled(%v) with enabled %v -> %v, not %v", r.id, r.enabled, result, r.expected)
+		}
+	}
+
+}
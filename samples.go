@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// A sampleProblem is a syntax error found in a code sample, on a line of the sample's body.
+type sampleProblem struct {
+	line    line
+	column  int
+	message string
+}
+
+// A sampleChecker finds the first syntax error in the lines of a code sample, with their indentation removed.
+type sampleChecker func(lines []line) (sampleProblem, bool)
+
+// sampleCheckers are the syntax checks for code samples, by the language of the code block.
+var sampleCheckers = map[string]sampleChecker{
+	"json":   checkJSONSample,
+	"yaml":   checkYAMLSample,
+	"yml":    checkYAMLSample,
+	"bash":   checkShellSample,
+	"sh":     checkShellSample,
+	"shell":  checkShellSample,
+	"ini":    checkINISample,
+	"cfg":    checkINISample,
+	"dosini": checkINISample,
+}
+
+// dedent removes the indentation the lines have in common, returning their columns' offset.
+func dedent(body []line) ([]line, int) {
+	common := -1
+	for _, l := range body {
+		if strings.TrimSpace(l.text) == "" {
+			continue
+		}
+		if n := len(l.text) - len(strings.TrimLeft(l.text, " \t")); common < 0 || n < common {
+			common = n
+		}
+	}
+	if common < 0 {
+		return nil, 0
+	}
+	var lines []line
+	for _, l := range body {
+		text := ""
+		if len(l.text) > common {
+			text = l.text[common:]
+		}
+		lines = append(lines, line{num: l.num, text: text})
+	}
+	// Blank lines closing the body aren't part of the sample.
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1].text) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, common
+}
+
+// checkJSONSample parses the sample as JSON. Samples eliding part of a document with "..." aren't checked.
+func checkJSONSample(lines []line) (sampleProblem, bool) {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(l.text)
+		b.WriteString("\n")
+	}
+	text := b.String()
+	if len(lines) == 0 || strings.Contains(text, "...") {
+		return sampleProblem{}, false
+	}
+	var v interface{}
+	err := json.Unmarshal([]byte(text), &v)
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return sampleProblem{}, false
+	}
+	offset := int(syntaxErr.Offset)
+	for _, l := range lines {
+		if offset <= len(l.text)+1 {
+			if offset > len(l.text) {
+				offset = len(l.text)
+			}
+			return sampleProblem{line: l, column: utf8.RuneCountInString(l.text[:offset]),
+				message: fmt.Sprintf("JSON sample is invalid: %v.", syntaxErr)}, true
+		}
+		offset -= len(l.text) + 1
+	}
+	last := lines[len(lines)-1]
+	return sampleProblem{line: last, column: utf8.RuneCountInString(last.text),
+		message: fmt.Sprintf("JSON sample is invalid: %v.", syntaxErr)}, true
+}
+
+// A bracket is an unclosed bracket, or quote, and where it was opened.
+type bracket struct {
+	char   byte
+	line   line
+	column int
+}
+
+// closingBrackets are the closing brackets of YAML flow collections, by their opening bracket.
+var closingBrackets = map[byte]byte{'[': ']', '{': '}'}
+
+// checkYAMLSample lints the sample as YAML, without parsing it fully: indentation can't use tabs,
+// the brackets of flow collections must match, and quoted scalars must be closed.
+func checkYAMLSample(lines []line) (sampleProblem, bool) {
+	var open []bracket
+	for _, l := range lines {
+		leading := l.text[:len(l.text)-len(strings.TrimLeft(l.text, " \t"))]
+		if strings.Contains(leading, "\t") {
+			return sampleProblem{line: l, column: strings.IndexByte(leading, '\t') + 1,
+				message: "YAML sample is indented with tabs, which YAML doesn't allow."}, true
+		}
+		for i := 0; i < len(l.text); i++ {
+			c := l.text[i]
+			var quote byte
+			if len(open) > 0 && (open[len(open)-1].char == '\'' || open[len(open)-1].char == '"') {
+				quote = open[len(open)-1].char
+			}
+			switch {
+			case quote == '"' && c == '\\':
+				i++
+			case quote != 0:
+				if c == quote {
+					// Single quotes are escaped by doubling them.
+					if quote == '\'' && i+1 < len(l.text) && l.text[i+1] == '\'' {
+						i++
+					} else {
+						open = open[:len(open)-1]
+					}
+				}
+			case c == '#' && (i == 0 || l.text[i-1] == ' ' || l.text[i-1] == '\t'):
+				i = len(l.text)
+			case (c == '\'' || c == '"') && (i == 0 || strings.IndexByte(" \t[{,:-?", l.text[i-1]) >= 0):
+				open = append(open, bracket{char: c, line: l, column: i + 1})
+			case c == '[' || c == '{':
+				open = append(open, bracket{char: c, line: l, column: i + 1})
+			case c == ']' || c == '}':
+				if len(open) == 0 || closingBrackets[open[len(open)-1].char] != c {
+					return sampleProblem{line: l, column: i + 1,
+						message: fmt.Sprintf("YAML sample has a %q which doesn't close a flow collection.", string(c))}, true
+				}
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	if len(open) > 0 {
+		b := open[0]
+		what := "flow collection"
+		if b.char == '\'' || b.char == '"' {
+			what = "quoted scalar"
+		}
+		return sampleProblem{line: b.line, column: b.column,
+			message: fmt.Sprintf("YAML sample has a %v opened with %q which isn't closed.", what, string(b.char))}, true
+	}
+	return sampleProblem{}, false
+}
+
+// heredocPattern matches the start of a here-document in a shell command, such as "<<EOF" or "<<-'END'".
+var heredocPattern = regexp.MustCompile(`<<-?\s*['"]?([A-Za-z_][A-Za-z0-9_]*)['"]?`)
+
+// shellOpeners are the shell keywords opening compound commands, and the keywords closing them.
+var shellOpeners = map[string]string{"if": "fi", "case": "esac", "do": "done"}
+
+// A shellKeyword is a keyword opening a compound command in a shell sample, and where it was used.
+type shellKeyword struct {
+	word   string
+	line   line
+	column int
+}
+
+// checkShellSample lints the sample as a shell script: quotes must be closed, and compound commands
+// like "if" and "for" must be closed by their keyword. Prompts like "$ " starting a line, and the
+// bodies of here-documents, are ignored.
+func checkShellSample(lines []line) (sampleProblem, bool) {
+	var open []bracket
+	var compound []shellKeyword
+	// The delimiter ending the here-document being read, if any.
+	heredoc := ""
+	for _, l := range lines {
+		text := l.text
+		if heredoc != "" {
+			if strings.TrimSpace(text) == heredoc {
+				heredoc = ""
+			}
+			continue
+		}
+		offset := 0
+		if strings.HasPrefix(text, "$ ") && len(open) == 0 {
+			text, offset = text[2:], 2
+		}
+
+		// Whether the next word is in command position, where keywords are recognized.
+		start := len(open) == 0
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			var quote byte
+			if len(open) > 0 {
+				quote = open[len(open)-1].char
+			}
+			switch {
+			case quote != '\'' && c == '\\':
+				i++
+			case quote != 0:
+				if c == quote {
+					open = open[:len(open)-1]
+				}
+			case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+				i = len(text)
+			case c == '\'' || c == '"' || c == '`':
+				open = append(open, bracket{char: c, line: l, column: offset + i + 1})
+				start = false
+			case c == ';' || c == '|' || c == '&' || c == '(':
+				start = true
+			case c == ' ' || c == '\t':
+			case c == '<' && strings.HasPrefix(text[i:], "<<") && heredocPattern.MatchString(text[i:]):
+				heredoc = heredocPattern.FindStringSubmatch(text[i:])[1]
+				i++
+			case start:
+				end := i
+				for end < len(text) && strings.IndexByte(" \t;|&()<>'\"`", text[end]) < 0 {
+					end++
+				}
+				word := text[i:end]
+				switch word {
+				case "if", "case", "do":
+					compound = append(compound, shellKeyword{word: word, line: l, column: offset + i + 1})
+				case "fi", "esac", "done":
+					if len(compound) == 0 || shellOpeners[compound[len(compound)-1].word] != word {
+						return sampleProblem{line: l, column: offset + i + 1,
+							message: fmt.Sprintf("Shell sample has a %q which doesn't close a compound command.", word)}, true
+					}
+					compound = compound[:len(compound)-1]
+				}
+				start = word == "then" || word == "else" || word == "elif" || word == "do" || word == "!"
+				i = end - 1
+			}
+		}
+	}
+	if len(open) > 0 {
+		b := open[0]
+		return sampleProblem{line: b.line, column: b.column,
+			message: fmt.Sprintf("Shell sample has a %q which isn't closed.", string(b.char))}, true
+	}
+	if len(compound) > 0 {
+		k := compound[len(compound)-1]
+		return sampleProblem{line: k.line, column: k.column,
+			message: fmt.Sprintf("Shell sample has a %q which isn't closed by %q.", k.word, shellOpeners[k.word])}, true
+	}
+	return sampleProblem{}, false
+}
+
+// checkINISample lints the sample as an INI file: each line is a section header, a key given a value
+// with "=" or ":", a comment, or an indented continuation of the value before it.
+func checkINISample(lines []line) (sampleProblem, bool) {
+	value := false
+	for _, l := range lines {
+		text := strings.TrimSpace(l.text)
+		switch {
+		case text == "" || text == "..." || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";"):
+			continue
+		case indentation(l.text) > 0 && value:
+			continue
+		case strings.HasPrefix(text, "["):
+			if !strings.HasSuffix(text, "]") {
+				return sampleProblem{line: l, column: utf8.RuneCountInString(l.text),
+					message: "INI sample has a section header which isn't closed with \"]\"."}, true
+			}
+			value = false
+		case strings.IndexAny(text, "=:") > 0:
+			value = true
+		default:
+			return sampleProblem{line: l, column: indentation(l.text) + 1,
+				message: "INI sample has a line which isn't a section header, a key and value, or a comment."}, true
+		}
+	}
+	return sampleProblem{}, false
+}
+
+// checkCodeSamples checks the syntax of code blocks in the languages of the sampleCheckers,
+// since samples of configuration and commands are copied by readers verbatim.
+func checkCodeSamples(path string, lines <-chan line, diags chan<- diagnostic) {
+	var r directiveReader
+	check := func(closed []*directive) {
+		for _, d := range closed {
+			checker, ok := sampleCheckers[strings.ToLower(d.arg)]
+			if !ok || !contains(codeDirectives, d.name) {
+				continue
+			}
+			sample, offset := dedent(d.body)
+			if p, found := checker(sample); found {
+				diags <- diagnostic{Line: p.line.num, Column: offset + p.column, Rule: ruleCodeSample, Message: p.message}
+			}
+		}
+	}
+	for l := range lines {
+		check(r.next(l))
+	}
+	check(r.end())
+}
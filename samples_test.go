@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// sampleLines splits text into the lines of a code sample, numbered from 1.
+func sampleLines(text string) []line {
+	var lines []line
+	for i, t := range strings.Split(text, "\n") {
+		lines = append(lines, line{num: i + 1, text: t})
+	}
+	return lines
+}
+
+func TestSampleCheckers(t *testing.T) {
+
+	testTable := []struct {
+		language       string
+		text           string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"json", "{\n  \"a\": [1, 2],\n  \"b\": null\n}", 0, 0},
+		{"json", "{\n  \"a\": 1,\n}", 3, 1},
+		{"json", "{\n  \"a\": 1\n  \"b\": 2\n}", 3, 3},
+		{"json", "{\n  \"a\": 1,\n  ...\n}", 0, 0},
+		{"yaml", "a:\n  - b\n  - [c, d]\nname: 'it''s'", 0, 0},
+		{"yaml", "a:\n\t- b", 2, 1},
+		{"yaml", "a: [b, c\nd: e", 1, 4},
+		{"yaml", "a: b]", 1, 5},
+		{"yaml", "a: \"b\nc: d", 1, 4},
+		{"yaml", "a: it's # don't", 0, 0},
+		{"bash", "if [ -f a ]; then\n  echo \"a\"\nfi", 0, 0},
+		{"bash", "for f in *; do\n  echo $f\ndone", 0, 0},
+		{"bash", "if [ -f a ]; then\n  echo a", 1, 1},
+		{"bash", "echo \"a", 1, 6},
+		{"bash", "$ echo 'a", 1, 8},
+		{"bash", "echo a\nfi", 2, 1},
+		{"bash", "echo \"it's\" # don't", 0, 0},
+		{"bash", "cat <<EOF\nit's\nEOF\necho a", 0, 0},
+		{"bash", "echo done; echo fi", 0, 0},
+		{"ini", "[server]\nhost = localhost\nports =\n    8000\n; comment", 0, 0},
+		{"ini", "[server\nhost = localhost", 1, 7},
+		{"ini", "[server]\nlocalhost", 2, 1},
+	}
+
+	for _, r := range testTable {
+		p, found := sampleCheckers[r.language](sampleLines(r.text))
+		if r.expectedLine == 0 {
+			if found {
+				t.Errorf("checking %v sample %q -> %v, expected no problems", r.language, r.text, p.message)
+			}
+			continue
+		}
+		if !found || p.line.num != r.expectedLine || p.column != r.expectedColumn {
+			t.Errorf("checking %v sample %q -> line %v column %v %q, expected line %v column %v",
+				r.language, r.text, p.line.num, p.column, p.message, r.expectedLine, r.expectedColumn)
+		}
+	}
+
+}
+
+func TestCheckCodeSamples(t *testing.T) {
+
+	text := "Configure the server:\n" +
+		"\n" +
+		".. code-block:: json\n" +
+		"\n" +
+		"   {\n" +
+		"     \"host\": \"localhost\",\n" +
+		"   }\n" +
+		"\n" +
+		".. code-block:: python\n" +
+		"\n" +
+		"   print('a\n" +
+		"\n" +
+		".. code:: yaml\n" +
+		"\n" +
+		"   host: localhost\n"
+	found := runContentCheck(checkCodeSamples, "/a/b/c.rst", text)
+	if len(found) != 1 || found[0].Line != 7 || found[0].Column != 4 {
+		t.Errorf("checkCodeSamples found %v, expected a problem on line 7, column 4", found)
+	}
+
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Malformed directive markers, which docutils renders as comments or plain text rather than directives.
+var (
+	// Such as "..note::".
+	directiveNoSpacePattern = regexp.MustCompile(`^\s*\.\.([A-Za-z][\w.+-]*)::`)
+	// Such as ".. note ::".
+	directiveSpacedPattern = regexp.MustCompile(`^\s*\.\.\s+([A-Za-z][\w.+-]*)\s+::`)
+	// Such as ".. note: Text", which is a comment.
+	directiveOneColonPattern = regexp.MustCompile(`^\s*\.\.\s+([A-Za-z][\w.+-]*):(?:\s|$)`)
+)
+
+// checkDirectiveMarker returns a description of what's wrong with a malformed directive marker on text, if any.
+func checkDirectiveMarker(text string) (string, bool) {
+	if m := directiveNoSpacePattern.FindStringSubmatch(text); m != nil {
+		return fmt.Sprintf("Directive %q is missing the space after \"..\", so it renders as text.", m[1]), true
+	}
+	if m := directiveSpacedPattern.FindStringSubmatch(text); m != nil {
+		return fmt.Sprintf("Directive %q has a space before \"::\", so it's a comment.", m[1]), true
+	}
+	if m := directiveOneColonPattern.FindStringSubmatch(text); m != nil && isKnownDirective(strings.ToLower(m[1])) {
+		return fmt.Sprintf("Directive %q has only one colon, so it's a comment.", m[1]), true
+	}
+	return "", false
+}
+
+// quote returns the punctuation character text starts with, which could start a quoted literal block,
+// an unindented block with each line starting with the same character.
+func quote(text string) (byte, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" || !strings.ContainsRune(adornmentChars, rune(text[0])) {
+		return 0, false
+	}
+	return text[0], true
+}
+
+// introducesLiteral reports whether l ends in "::", introducing a literal block
+// when it's the last line of a paragraph.
+func introducesLiteral(l line) bool {
+	text := strings.TrimSpace(l.text)
+	return strings.HasSuffix(text, "::") && !strings.HasPrefix(text, "..")
+}
+
+// missingLiteral reports that the paragraph ending on l with "::" isn't followed by a literal block.
+func missingLiteral(l line) diagnostic {
+	return diagnostic{Line: l.num, Column: utf8.RuneCountInString(strings.TrimRight(l.text, " \t")) - 1, Rule: ruleSyntax,
+		Message: "Literal block expected after \"::\", but none was found."}
+}
+
+// checkSyntax reports reST syntax errors which docutils rejects, or silently renders differently
+// than intended: malformed directive markers, directive options which aren't fields, field lists
+// which don't end with a blank line, and paragraphs ending in "::" without a literal block.
+func checkSyntax(path string, lines <-chan line, diags chan<- diagnostic) {
+	var directives directiveReader
+	var previous line
+	// The line ending a paragraph with "::", while the literal block it introduces is expected.
+	var expecting *line
+	// While in a literal block, the indentation of the paragraph introducing it,
+	// and for a quoted literal block, the character starting each line.
+	literal := -1
+	var quoted byte
+	// While a directive's options can follow, the indentation of the directive.
+	options := -1
+	// While in a field list, the indentation of its fields.
+	fields := -1
+	for l := range lines {
+		directives.next(l)
+		blank := strings.TrimSpace(l.text) == ""
+		indent := indentation(l.text)
+		last := previous
+		previous = l
+
+		if blank {
+			options, fields = -1, -1
+			if expecting == nil && literal < 0 && introducesLiteral(last) && !directives.inBody(last, literalDirectives...) {
+				introducing := last
+				expecting = &introducing
+			}
+			continue
+		}
+
+		if expecting != nil {
+			c, ok := quote(l.text)
+			if indent > indentation(expecting.text) {
+				literal, quoted = indentation(expecting.text), 0
+			} else if indent == indentation(expecting.text) && ok {
+				literal, quoted = indent, c
+			} else {
+				diags <- missingLiteral(*expecting)
+			}
+			expecting = nil
+		}
+		if literal >= 0 {
+			if c, _ := quote(l.text); (quoted == 0 && indent > literal) || (quoted != 0 && indent == literal && c == quoted) {
+				continue
+			}
+			literal = -1
+		}
+		if options >= 0 && indent > options {
+			text := strings.TrimSpace(l.text)
+			if optionPattern.MatchString(l.text) {
+				continue
+			}
+			if strings.HasPrefix(text, ":") && !strings.HasPrefix(text, "::") && !rolePattern.MatchString(text) {
+				diags <- diagnostic{Line: l.num, Column: indent + 1, Rule: ruleSyntax,
+					Message: fmt.Sprintf("Directive option %q isn't a field like \":name: value\".", text)}
+			}
+		}
+		options = -1
+		if directives.inBody(l, literalDirectives...) {
+			continue
+		}
+
+		// Docutils ends a field list at the first line which isn't indented as a field body,
+		// and warns when it isn't separated from the field list by a blank line.
+		if fields >= 0 {
+			if indent > fields || (indent == fields && fieldPattern.MatchString(l.text)) {
+				continue
+			}
+			message := "Field list ends without a blank line."
+			if m := fieldNoSpacePattern.FindStringSubmatch(l.text); m != nil && indent == fields {
+				message = fmt.Sprintf("Field %q has no space after its name, so it ends the field list.", m[1])
+			}
+			diags <- diagnostic{Line: l.num, Column: indent + 1, Rule: ruleSyntax, Message: message}
+			fields = -1
+		} else if fieldPattern.MatchString(l.text) && strings.TrimSpace(last.text) == "" {
+			fields = indent
+			continue
+		}
+
+		if directivePattern.MatchString(l.text) {
+			options = indent
+			continue
+		}
+
+		if message, ok := checkDirectiveMarker(l.text); ok {
+			diags <- diagnostic{Line: l.num, Column: indent + 1, Rule: ruleSyntax, Message: message}
+		}
+	}
+
+	if expecting != nil {
+		diags <- missingLiteral(*expecting)
+	} else if literal < 0 && introducesLiteral(previous) && !directives.inBody(previous, literalDirectives...) {
+		diags <- missingLiteral(previous)
+	}
+}
+
+// gridBorderPattern matches the border of a grid table, such as "+-----+-----+", or the "="
+// border separating its header.
+var gridBorderPattern = regexp.MustCompile(`^\s*\+([-=]+\+)+\s*$`)
+
+// simpleBorderPattern matches the border of a simple table, such as "=====  =====".
+// A single column border isn't matched, since it can't be told apart from a heading's adornment.
+var simpleBorderPattern = regexp.MustCompile(`^\s*=+( +=+)+\s*$`)
+
+// columns returns the start and end of each run of c in border, counting runes.
+func columns(border string, c rune) [][2]int {
+	var found [][2]int
+	start := -1
+	i := 0
+	for _, r := range border {
+		if r == c && start < 0 {
+			start = i
+		} else if r != c && start >= 0 {
+			found = append(found, [2]int{start, i})
+			start = -1
+		}
+		i++
+	}
+	if start >= 0 {
+		found = append(found, [2]int{start, i})
+	}
+	return found
+}
+
+// runePositions returns the positions of c in text, counting runes.
+func runePositions(text string, c rune) []int {
+	var found []int
+	i := 0
+	for _, r := range text {
+		if r == c {
+			found = append(found, i)
+		}
+		i++
+	}
+	return found
+}
+
+// A gridTable is a grid table being read.
+type gridTable struct {
+	start int
+	// The width of the top border, and the positions of its column separators.
+	width int
+	joins map[int]bool
+	// Whether the last line read was a border.
+	closed bool
+}
+
+// A simpleTable is a simple table being read.
+type simpleTable struct {
+	start   int
+	columns [][2]int
+	// The number of borders read, and whether the last line read was one.
+	borders int
+	border  bool
+}
+
+// checkTables ensures grid tables have rows as wide as their borders, closed by "|" or "+", and borders
+// whose column separators line up, and that simple tables are closed, with borders matching the first
+// and no text in the margins between columns.
+func checkTables(path string, lines <-chan line, diags chan<- diagnostic) {
+	var directives directiveReader
+	var grid *gridTable
+	var simple *simpleTable
+	for l := range lines {
+		directives.next(l)
+		text := strings.TrimRight(l.text, " \t")
+		trimmed := strings.TrimSpace(text)
+
+		if grid != nil {
+			if trimmed != "" && (trimmed[0] == '+' || trimmed[0] == '|') {
+				grid.closed = gridBorderPattern.MatchString(text)
+				width := utf8.RuneCountInString(text)
+				switch {
+				case width != grid.width:
+					diags <- diagnostic{Line: l.num, Column: 1, Rule: ruleTable,
+						Message: fmt.Sprintf("Grid table row is %v characters wide, but its border is %v.", width, grid.width)}
+				case text[len(text)-1] != '|' && text[len(text)-1] != '+':
+					diags <- diagnostic{Line: l.num, Column: width, Rule: ruleTable,
+						Message: "Grid table row isn't closed with \"|\"."}
+				case grid.closed:
+					for _, j := range runePositions(text, '+') {
+						if !grid.joins[j] {
+							diags <- diagnostic{Line: l.num, Column: j + 1, Rule: ruleTable,
+								Message: "Grid table border doesn't line up with the columns of the table's first border."}
+							break
+						}
+					}
+				}
+				continue
+			}
+			if !grid.closed {
+				diags <- diagnostic{Line: grid.start, Column: 1, Rule: ruleTable, Message: "Grid table isn't closed with a border."}
+			}
+			grid = nil
+		}
+
+		if simple != nil {
+			switch {
+			case simpleBorderPattern.MatchString(text) || (strings.Trim(trimmed, "= ") == "" && strings.Contains(trimmed, "=")):
+				simple.borders++
+				simple.border = true
+				if fmt.Sprint(columns(text, '=')) != fmt.Sprint(simple.columns) {
+					diags <- diagnostic{Line: l.num, Column: 1, Rule: ruleTable,
+						Message: "Simple table border doesn't match the columns of the table's first border."}
+				}
+				continue
+			case trimmed == "" && simple.border && simple.borders > 1:
+				simple = nil
+				continue
+			}
+			simple.border = false
+			for i := 0; i+1 < len(simple.columns); i++ {
+				from, to := simple.columns[i][1], simple.columns[i+1][0]
+				for j, r := range []rune(text) {
+					if j >= from && j < to && r != ' ' {
+						diags <- diagnostic{Line: l.num, Column: j + 1, Rule: ruleTable,
+							Message: fmt.Sprintf("Simple table has text in the margin between columns %v and %v.", i+1, i+2)}
+						break
+					}
+				}
+			}
+			continue
+		}
+
+		if directives.inBody(l, literalDirectives...) {
+			continue
+		}
+		if gridBorderPattern.MatchString(text) {
+			grid = &gridTable{start: l.num, width: utf8.RuneCountInString(text), joins: make(map[int]bool)}
+			for _, j := range runePositions(text, '+') {
+				grid.joins[j] = true
+			}
+		} else if simpleBorderPattern.MatchString(text) {
+			simple = &simpleTable{start: l.num, columns: columns(text, '='), borders: 1, border: true}
+		}
+	}
+
+	if grid != nil && !grid.closed {
+		diags <- diagnostic{Line: grid.start, Column: 1, Rule: ruleTable, Message: "Grid table isn't closed with a border."}
+	}
+	if simple != nil && !(simple.border && simple.borders > 1) {
+		diags <- diagnostic{Line: simple.start, Column: 1, Rule: ruleTable, Message: "Simple table isn't closed with a border."}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+func TestCheckSyntax(t *testing.T) {
+
+	testTable := []struct {
+		text         string
+		expectedLine int
+	}{
+		{".. note::\n\n   Text.\n", 0},
+		{"..note::\n\n   Text.\n", 1},
+		{".. note ::\n\n   Text.\n", 1},
+		{".. note: Text.\n", 1},
+		{".. Just a comment: text.\n", 0},
+		{".. toctree::\n   :maxdepth: 2\n   :glob:\n\n   *\n", 0},
+		{".. toctree::\n   :maxdepth 2\n\n   *\n", 2},
+		{".. image:: a.png\n   :alt: A long\n      description\n", 0},
+		{"For example::\n\n   $ ls\n\nText.\n", 0},
+		{"For example::\n\n> quoted\n> literal\n", 0},
+		{"For example::\n\nText.\n", 1},
+		{"For example::\n", 1},
+		{"For example::\n   continued.\n", 0},
+		{".. code-block:: rst\n\n   For example::\n\n   ..note::\n", 0},
+		{"Literal::\n\n   ..note::\n\nText.\n", 0},
+		{":orphan:\n\nText.\n", 0},
+		{":Author: Artefactual\n:Date: 2024\n   continued.\n\nText.\n", 0},
+		{".. note::\n\n   :Author: Artefactual\n   :Date: 2024\n", 0},
+		{"See :ref:`page`\n:ref:`other` too.\n", 0},
+		{"Text\n:Author: Artefactual\n", 0},
+		{":Author: Artefactual\nText.\n", 2},
+		{":Author: Artefactual\n:Date:2024\n", 2},
+		{".. note::\n\n   :Author: Artefactual\n   Text.\n", 4},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkSyntax, "/a/b/c.rst", r.text)
+		if r.expectedLine == 0 {
+			if len(found) != 0 {
+				t.Errorf("checkSyntax(%q) -> %v, expected no problems", r.text, found)
+			}
+			continue
+		}
+		if len(found) != 1 || found[0].Line != r.expectedLine {
+			t.Errorf("checkSyntax(%q) -> %v, expected one problem on line %v", r.text, found, r.expectedLine)
+		}
+	}
+
+}
+
+func TestCheckTables(t *testing.T) {
+
+	testTable := []struct {
+		text         string
+		expectedLine int
+	}{
+		{"+-----+-----+\n| A   | B   |\n+=====+=====+\n| 1   | 2   |\n+-----+-----+\n", 0},
+		{"+-----+-----+\n| A   | B  |\n+-----+-----+\n", 2},
+		{"+-----+-----+\n| A   | B   \n+-----+-----+\n", 2},
+		{"+-----+-----+\n| A   | B   |\n+----+------+\n", 3},
+		{"+-----+-----+\n| A   | B   |\n\nText.\n", 1},
+		{"=====  =====\nA      B\n=====  =====\n1      2\n=====  =====\n\nText.\n", 0},
+		{"=====  =====\nA      B\n=====  =====\n", 0},
+		{"=====  =====\nA      B\n====== =====\n", 3},
+		{"=====  =====\nA      B\nLonger text  C\n=====  =====\n", 3},
+		{"=====  =====\nA      B\n\nText.\n", 1},
+		{"Title\n=====\n\nText.\n", 0},
+		{".. code-block:: rst\n\n   +-----+\n   | A\n", 0},
+	}
+
+	for _, r := range testTable {
+		found := runContentCheck(checkTables, "/a/b/c.rst", r.text)
+		if r.expectedLine == 0 {
+			if len(found) != 0 {
+				t.Errorf("checkTables(%q) -> %v, expected no problems", r.text, found)
+			}
+			continue
+		}
+		if len(found) != 1 || found[0].Line != r.expectedLine {
+			t.Errorf("checkTables(%q) -> %v, expected one problem on line %v", r.text, found, r.expectedLine)
+		}
+	}
+
+}